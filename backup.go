@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/yesakov/lukyasha-tracker/backup"
+	"github.com/yesakov/lukyasha-tracker/database"
+)
+
+// runBackup implements the `backup` subcommand and returns the exit code
+func runBackup(args []string) int {
+	cfg := backup.ConfigFromEnv()
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	fs.StringVar(&cfg.Dir, "dir", cfg.Dir, "directory to write the snapshot into")
+	fs.IntVar(&cfg.Keep, "keep", cfg.Keep, "number of snapshots to keep (0 keeps all)")
+	noGzip := fs.Bool("no-gzip", !cfg.Compress, "write an uncompressed .db file")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	cfg.Compress = !*noGzip
+
+	InitDB()
+	res, err := backup.Snapshot(context.Background(), DB, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "backup:", err)
+		return 1
+	}
+	fmt.Printf("backup written to %s (%d bytes)\n", res.Path, res.Size)
+	return 0
+}
+
+// runRestore implements the `restore` subcommand. It replaces the configured
+// SQLite file, so the server must be stopped first.
+func runRestore(args []string) int {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: lukyasha-tracker restore [-check] <snapshot.db[.gz]>")
+		fs.PrintDefaults()
+	}
+	checkOnly := fs.Bool("check", false, "only validate the snapshot, do not restore it")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	src := fs.Arg(0)
+
+	cfg := database.ConfigFromEnv()
+	if cfg.Driver != database.DriverSQLite {
+		fmt.Fprintln(os.Stderr, "restore:", backup.ErrUnsupported)
+		return 1
+	}
+	dst := sqlitePath(cfg.DSN)
+
+	if *checkOnly {
+		version, err := backup.Check(src)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "restore:", err)
+			return 1
+		}
+		fmt.Printf("%s is a valid snapshot at schema version %d\n", src, version)
+		return 0
+	}
+
+	version, err := backup.Restore(src, dst)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "restore:", err)
+		return 1
+	}
+	fmt.Printf("restored %s into %s (schema version %d)\n", src, dst, version)
+	return 0
+}
+
+// sqlitePath strips the URI prefix and options from a SQLite DSN
+func sqlitePath(dsn string) string {
+	dsn = strings.TrimPrefix(dsn, "file:")
+	if i := strings.Index(dsn, "?"); i >= 0 {
+		dsn = dsn[:i]
+	}
+	return dsn
+}
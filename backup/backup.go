@@ -0,0 +1,334 @@
+// Package backup takes consistent online snapshots of the SQLite database
+// with VACUUM INTO, keeps a bounded number of them and restores them after
+// checking they carry a schema this build understands.
+package backup
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yesakov/lukyasha-tracker/database"
+	"github.com/yesakov/lukyasha-tracker/migrations"
+	"gorm.io/gorm"
+)
+
+const filePrefix = "lukyasha-"
+
+// ErrUnsupported is returned for backends that are not SQLite
+var ErrUnsupported = errors.New("online backups are only supported for SQLite; use pg_dump for PostgreSQL")
+
+type Config struct {
+	Dir      string
+	Interval time.Duration // 0 disables scheduled backups
+	Keep     int           // 0 keeps everything
+	Compress bool
+}
+
+// ConfigFromEnv reads BACKUP_DIR, BACKUP_INTERVAL, BACKUP_KEEP and BACKUP_GZIP
+func ConfigFromEnv() Config {
+	cfg := Config{Dir: "backups", Keep: 7, Compress: true}
+	if v := os.Getenv("BACKUP_DIR"); v != "" {
+		cfg.Dir = v
+	}
+	if v := os.Getenv("BACKUP_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			cfg.Interval = d
+		} else {
+			log.Printf("invalid BACKUP_INTERVAL %q, scheduled backups disabled", v)
+		}
+	}
+	if v := os.Getenv("BACKUP_KEEP"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.Keep = n
+		}
+	}
+	if v := os.Getenv("BACKUP_GZIP"); v == "false" || v == "0" {
+		cfg.Compress = false
+	}
+	return cfg
+}
+
+// Result describes a written snapshot
+type Result struct {
+	Path string    `json:"path"`
+	Size int64     `json:"size"`
+	At   time.Time `json:"created_at"`
+}
+
+// Snapshot writes a consistent copy of the live database into cfg.Dir and
+// applies the retention policy
+func Snapshot(ctx context.Context, db *gorm.DB, cfg Config) (Result, error) {
+	if !database.IsSQLite(db) {
+		return Result{}, ErrUnsupported
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return Result{}, err
+	}
+
+	now := time.Now()
+	name := filePrefix + now.Format("20060102-150405") + ".db"
+	raw := filepath.Join(cfg.Dir, name)
+	// VACUUM INTO refuses to overwrite, and two snapshots can land in the same second
+	for i := 1; fileExists(raw) || fileExists(raw+".gz"); i++ {
+		raw = filepath.Join(cfg.Dir, fmt.Sprintf("%s%s-%d.db", filePrefix, now.Format("20060102-150405"), i))
+	}
+
+	if err := db.WithContext(ctx).Exec("VACUUM INTO ?", raw).Error; err != nil {
+		os.Remove(raw)
+		return Result{}, fmt.Errorf("vacuum into %s: %w", raw, err)
+	}
+
+	out := raw
+	if cfg.Compress {
+		out = raw + ".gz"
+		if err := gzipFile(raw, out); err != nil {
+			os.Remove(out)
+			os.Remove(raw)
+			return Result{}, err
+		}
+		os.Remove(raw)
+	}
+
+	info, err := os.Stat(out)
+	if err != nil {
+		return Result{}, err
+	}
+	if err := Prune(cfg.Dir, cfg.Keep); err != nil {
+		log.Printf("backup retention: %v", err)
+	}
+	return Result{Path: out, Size: info.Size(), At: now}, nil
+}
+
+// List returns the snapshots in dir, newest first
+func List(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var out []string
+	for _, e := range entries {
+		n := e.Name()
+		if e.IsDir() || !strings.HasPrefix(n, filePrefix) || !(strings.HasSuffix(n, ".db") || strings.HasSuffix(n, ".db.gz")) {
+			continue
+		}
+		out = append(out, filepath.Join(dir, n))
+	}
+	// By timestamp, then by the suffix snapshots of the same second get
+	sort.Slice(out, func(i, j int) bool {
+		a, an := snapshotOrder(out[i])
+		b, bn := snapshotOrder(out[j])
+		if a != b {
+			return a > b
+		}
+		return an > bn
+	})
+	return out, nil
+}
+
+// snapshotOrder splits a snapshot name into its timestamp and same-second
+// counter: "lukyasha-20060102-150405-2.db.gz" is ("20060102-150405", 2)
+func snapshotOrder(path string) (string, int) {
+	n := strings.TrimPrefix(filepath.Base(path), filePrefix)
+	n = strings.TrimSuffix(strings.TrimSuffix(n, ".gz"), ".db")
+	stamp, counter := n, 0
+	if parts := strings.Split(n, "-"); len(parts) == 3 {
+		if i, err := strconv.Atoi(parts[2]); err == nil {
+			stamp, counter = parts[0]+"-"+parts[1], i
+		}
+	}
+	return stamp, counter
+}
+
+// Prune deletes all but the newest keep snapshots
+func Prune(dir string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	files, err := List(dir)
+	if err != nil {
+		return err
+	}
+	for i := keep; i < len(files); i++ {
+		if err := os.Remove(files[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Schedule takes a snapshot every cfg.Interval until ctx is cancelled
+func Schedule(ctx context.Context, db *gorm.DB, cfg Config) {
+	if cfg.Interval <= 0 {
+		return
+	}
+	if !database.IsSQLite(db) {
+		log.Printf("BACKUP_INTERVAL ignored: %v", ErrUnsupported)
+		return
+	}
+	log.Printf("scheduled backups every %s into %s (keeping %d)", cfg.Interval, cfg.Dir, cfg.Keep)
+	t := time.NewTicker(cfg.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			res, err := Snapshot(ctx, db, cfg)
+			if err != nil {
+				log.Printf("scheduled backup failed: %v", err)
+				continue
+			}
+			log.Printf("backup written to %s (%d bytes)", res.Path, res.Size)
+		}
+	}
+}
+
+// Check validates a snapshot (compressed or not) without restoring it
+func Check(src string) (int, error) {
+	tmp, err := unpack(src, os.TempDir())
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp)
+	return Validate(tmp)
+}
+
+// Restore validates the snapshot at src and swaps it in place of the SQLite
+// file at dst. The previous database is kept next to it. The server must not
+// be running while restoring.
+func Restore(src, dst string) (int, error) {
+	tmp, err := unpack(src, filepath.Dir(dst))
+	if err != nil {
+		return 0, err
+	}
+	version, err := Validate(tmp)
+	if err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+
+	if fileExists(dst) {
+		keep := dst + ".pre-restore-" + time.Now().Format("20060102-150405")
+		if err := os.Rename(dst, keep); err != nil {
+			os.Remove(tmp)
+			return 0, err
+		}
+		log.Printf("previous database moved to %s", keep)
+	}
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		os.Remove(dst + suffix)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	return version, nil
+}
+
+// unpack copies src into a temporary file in dir, decompressing .gz files
+func unpack(src, dir string) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	var r io.Reader = in
+	if strings.HasSuffix(src, ".gz") {
+		gz, err := gzip.NewReader(in)
+		if err != nil {
+			return "", fmt.Errorf("read %s: %w", src, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tmp, err := os.CreateTemp(dir, ".restore-*.db")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(tmp, r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// Validate opens an uncompressed snapshot read-only and checks its
+// integrity and schema version
+func Validate(path string) (int, error) {
+	db, err := database.Open(database.Config{Driver: database.DriverSQLite, DSN: "file:" + path + "?mode=ro"})
+	if err != nil {
+		return 0, err
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+
+	var integrity string
+	if err := db.Raw("PRAGMA integrity_check").Scan(&integrity).Error; err != nil {
+		return 0, fmt.Errorf("not a SQLite database: %w", err)
+	}
+	if integrity != "ok" {
+		return 0, fmt.Errorf("integrity check failed: %s", integrity)
+	}
+
+	if !db.Migrator().HasTable(&migrations.SchemaMigration{}) {
+		return 0, errors.New("snapshot has no schema_migrations table")
+	}
+	var version int
+	if err := db.Model(&migrations.SchemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error; err != nil {
+		return 0, err
+	}
+	if version == 0 {
+		return 0, errors.New("snapshot has no applied migrations")
+	}
+	if version > migrations.Latest() {
+		return 0, fmt.Errorf("%w: snapshot is at version %d, this build knows up to %d", migrations.ErrSchemaTooNew, version, migrations.Latest())
+	}
+	return version, nil
+}
+
+func gzipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
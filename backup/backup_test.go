@@ -0,0 +1,62 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListNewestFirst(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{
+		"lukyasha-20240101-120000.db.gz",
+		"lukyasha-20240101-120000-1.db.gz",
+		"lukyasha-20240101-120000-2.db",
+		"lukyasha-20231231-235959.db.gz",
+		"lukyasha-20240101-120000-10.db.gz",
+		"other.db",
+	}
+	for _, n := range names {
+		if err := os.WriteFile(filepath.Join(dir, n), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := List(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"lukyasha-20240101-120000-10.db.gz",
+		"lukyasha-20240101-120000-2.db",
+		"lukyasha-20240101-120000-1.db.gz",
+		"lukyasha-20240101-120000.db.gz",
+		"lukyasha-20231231-235959.db.gz",
+	}
+	if len(files) != len(want) {
+		t.Fatalf("got %d snapshots, want %d: %v", len(files), len(want), files)
+	}
+	for i, w := range want {
+		if got := filepath.Base(files[i]); got != w {
+			t.Errorf("snapshot %d = %s, want %s", i, got, w)
+		}
+	}
+}
+
+func TestPruneKeepsNewestOfSameSecond(t *testing.T) {
+	dir := t.TempDir()
+	for _, n := range []string{"lukyasha-20240101-120000.db.gz", "lukyasha-20240101-120000-1.db.gz"} {
+		if err := os.WriteFile(filepath.Join(dir, n), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Prune(dir, 1); err != nil {
+		t.Fatal(err)
+	}
+	files, err := List(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || filepath.Base(files[0]) != "lukyasha-20240101-120000-1.db.gz" {
+		t.Fatalf("kept %v, want the -1 snapshot", files)
+	}
+}
@@ -0,0 +1,137 @@
+// Package database opens the configured storage backend and hides the few
+// places where SQLite and PostgreSQL need different SQL.
+package database
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"gorm.io/driver/postgres"
+	moderncSqlite "gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	_ "modernc.org/sqlite"
+)
+
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// Config selects the backend. DSN is a file path for SQLite and a
+// connection URL or key=value string for PostgreSQL.
+type Config struct {
+	Driver string
+	DSN    string
+}
+
+// ConfigFromEnv reads DB_DRIVER and DB_DSN (DATABASE_URL is accepted for
+// PostgreSQL). Without configuration it falls back to ./data.db.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Driver: strings.ToLower(strings.TrimSpace(os.Getenv("DB_DRIVER"))),
+		DSN:    os.Getenv("DB_DSN"),
+	}
+	if cfg.Driver == "" {
+		cfg.Driver = DriverSQLite
+	}
+	if cfg.Driver == "postgresql" {
+		cfg.Driver = DriverPostgres
+	}
+	if cfg.DSN == "" {
+		switch cfg.Driver {
+		case DriverPostgres:
+			cfg.DSN = os.Getenv("DATABASE_URL")
+		case DriverSQLite:
+			cfg.DSN = "data.db"
+		}
+	}
+	return cfg
+}
+
+// Open connects to the configured backend
+func Open(cfg Config) (*gorm.DB, error) {
+	switch cfg.Driver {
+	case DriverSQLite:
+		return gorm.Open(moderncSqlite.New(moderncSqlite.Config{
+			DSN:        sqliteDSN(cfg.DSN),
+			DriverName: "sqlite",
+		}), &gorm.Config{})
+	case DriverPostgres:
+		if cfg.DSN == "" {
+			return nil, fmt.Errorf("postgres requires DB_DSN or DATABASE_URL")
+		}
+		return gorm.Open(postgres.Open(cfg.DSN), &gorm.Config{TranslateError: true})
+	default:
+		return nil, fmt.Errorf("unsupported DB_DRIVER %q (use %q or %q)", cfg.Driver, DriverSQLite, DriverPostgres)
+	}
+}
+
+// sqliteDSN adds per-connection pragmas. A one-off "PRAGMA foreign_keys"
+// only affects whichever pooled connection happens to run it.
+func sqliteDSN(path string) string {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return path + sep + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+}
+
+// Driver reports which backend a connection uses
+func Driver(db *gorm.DB) string {
+	if db.Dialector.Name() == DriverPostgres {
+		return DriverPostgres
+	}
+	return DriverSQLite
+}
+
+// IsSQLite is a shorthand for backend-specific code paths
+func IsSQLite(db *gorm.DB) bool {
+	return Driver(db) == DriverSQLite
+}
+
+// Increment builds a portable "column = column + delta" expression for UpdateColumn
+func Increment(column string, delta int) clause.Expr {
+	return gorm.Expr("? + ?", clause.Column{Name: column}, delta)
+}
+
+// SQLite extended result codes for constraint failures
+const (
+	sqliteConstraintForeignKey = 787
+	sqliteConstraintPrimaryKey = 1555
+	sqliteConstraintTrigger    = 1811
+	sqliteConstraintUnique     = 2067
+)
+
+func sqliteCode(err error) int {
+	var coder interface{ Code() int }
+	if errors.As(err, &coder) {
+		return coder.Code()
+	}
+	return 0
+}
+
+// IsUniqueViolation reports whether err was caused by a unique constraint
+func IsUniqueViolation(err error) bool {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
+	}
+	code := sqliteCode(err)
+	return code == sqliteConstraintUnique || code == sqliteConstraintPrimaryKey
+}
+
+// IsForeignKeyViolation reports whether err was caused by a foreign key constraint.
+// SQLite enforces ON DELETE RESTRICT with an internal trigger, which fails
+// with the trigger code and the foreign key message.
+func IsForeignKeyViolation(err error) bool {
+	switch sqliteCode(err) {
+	case sqliteConstraintForeignKey:
+		return true
+	case sqliteConstraintTrigger:
+		return strings.Contains(err.Error(), "FOREIGN KEY constraint failed")
+	}
+	return errors.Is(err, gorm.ErrForeignKeyViolated)
+}
@@ -0,0 +1,57 @@
+package database_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/yesakov/lukyasha-tracker/database"
+	"github.com/yesakov/lukyasha-tracker/database/dbtest"
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(dbtest.Main(m))
+}
+
+func TestIncrement(t *testing.T) {
+	dbtest.EachBackend(t, func(t *testing.T, db *gorm.DB) {
+		event := models.Event{Name: "Cup", Date: "2024-06-01"}
+		must(t, db.Create(&event).Error)
+		home, away := models.Team{Name: "Home", EventID: event.ID}, models.Team{Name: "Away", EventID: event.ID}
+		must(t, db.Create(&home).Error)
+		must(t, db.Create(&away).Error)
+		game := models.Game{EventID: event.ID, HomeTeamID: home.ID, AwayTeamID: away.ID}
+		must(t, db.Create(&game).Error)
+
+		for _, delta := range []int{1, 1, -1} {
+			must(t, db.Model(&game).UpdateColumn("home_team_goals", database.Increment("home_team_goals", delta)).Error)
+		}
+		must(t, db.First(&game, game.ID).Error)
+		if game.HomeTeamGoals != 1 || game.AwayTeamGoals != 0 {
+			t.Fatalf("score %d:%d, want 1:0", game.HomeTeamGoals, game.AwayTeamGoals)
+		}
+	})
+}
+
+func TestUniqueNames(t *testing.T) {
+	dbtest.EachBackend(t, func(t *testing.T, db *gorm.DB) {
+		event := models.Event{Name: "Cup", Date: "2024-06-01"}
+		must(t, db.Create(&event).Error)
+		team := models.Team{Name: "Red", EventID: event.ID}
+		must(t, db.Create(&team).Error)
+		if err := db.Create(&models.Team{Name: "Red", EventID: event.ID}).Error; err == nil {
+			t.Fatal("second team named Red in one event")
+		}
+		// the index is partial: a deleted team's name is free again
+		must(t, db.Delete(&team).Error)
+		must(t, db.Create(&models.Team{Name: "Red", EventID: event.ID}).Error)
+	})
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
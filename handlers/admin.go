@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yesakov/lukyasha-tracker/backup"
+	"gorm.io/gorm"
+)
+
+// RequireAdminToken guards admin routes with a bearer token. Without a
+// configured token the admin routes are disabled entirely.
+func RequireAdminToken(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Admin endpoints are disabled (set ADMIN_TOKEN)"})
+			return
+		}
+		got := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid admin token"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// CreateBackup takes an online snapshot of the database
+func CreateBackup(db *gorm.DB, cfg backup.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res, err := backup.Snapshot(c.Request.Context(), db, cfg)
+		if errors.Is(err, backup.ErrUnsupported) {
+			c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, res)
+	}
+}
+
+// ListBackups returns the snapshots kept in the backup directory
+func ListBackups(cfg backup.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		files, err := backup.List(cfg.Dir)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if files == nil {
+			files = []string{}
+		}
+		c.JSON(http.StatusOK, files)
+	}
+}
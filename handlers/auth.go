@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yesakov/lukyasha-tracker/models"
+	"github.com/yesakov/lukyasha-tracker/services"
+)
+
+// sessionCookie holds a browser's session token; API clients send it as a
+// bearer token instead
+const sessionCookie = "session"
+
+// deviceCookie tells browsers apart for votes that need no account (the
+// API only takes votes from signed-in users)
+const deviceCookie = "device"
+
+// deviceTTL keeps the device cookie for a year
+const deviceTTL = 365 * 24 * time.Hour
+
+// userKey is where LoadUser leaves the signed-in user in the context
+const userKey = "user"
+
+var errLoginFirst = &services.Error{Kind: services.ErrUnauthorized, Msg: "Log in first"}
+
+// LoadUser resolves the session token, if any, to the signed-in user. It
+// never refuses a request; handlers that need a user call requireUser.
+func LoadUser(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token := sessionToken(c); token != "" {
+			if user, err := svc.Users.ByToken(token); err == nil {
+				c.Set(userKey, user)
+			}
+		}
+		c.Next()
+	}
+}
+
+func sessionToken(c *gin.Context) string {
+	if token, err := c.Cookie(sessionCookie); err == nil && token != "" {
+		return token
+	}
+	return strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+}
+
+// currentUser is the signed-in user, or nil for visitors
+func currentUser(c *gin.Context) *models.User {
+	if v, ok := c.Get(userKey); ok {
+		return v.(*models.User)
+	}
+	return nil
+}
+
+// userID is the signed-in user's ID, 0 for visitors
+func userID(c *gin.Context) uint {
+	if user := currentUser(c); user != nil {
+		return user.ID
+	}
+	return 0
+}
+
+// requireUser answers 401 for visitors; it reports whether there is a user
+func requireUser(c *gin.Context) (*models.User, bool) {
+	user := currentUser(c)
+	if user == nil {
+		respondError(c, errLoginFirst)
+		return nil, false
+	}
+	return user, true
+}
+
+// safeNext keeps redirects after login on this site
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+// deviceToken returns the browser's device token; with create it hands a
+// new one to browsers without
+func deviceToken(c *gin.Context, create bool) string {
+	if token, err := c.Cookie(deviceCookie); err == nil && token != "" {
+		return token
+	}
+	if isAPI(c) || !create {
+		return ""
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	token := hex.EncodeToString(b)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(deviceCookie, token, int(deviceTTL.Seconds()), "/", "", c.Request.TLS != nil, true)
+	return token
+}
+
+func setSession(c *gin.Context, token string) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(sessionCookie, token, int(services.SessionTTL.Seconds()), "/", "", c.Request.TLS != nil, true)
+}
+
+// ShowLogin has the login and sign-up forms, or the signed-in user
+func ShowLogin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.HTML(http.StatusOK, "login.html", gin.H{
+			"Title":     "Account",
+			"User":      currentUser(c),
+			"Next":      safeNext(c.Query("next")),
+			"ActiveTab": "account",
+			"Content":   "content_login",
+		})
+	}
+}
+
+// Credentials are the login and sign-up fields
+type Credentials struct {
+	Name     string `form:"name" json:"name"`
+	Password string `form:"password" json:"password"`
+}
+
+// Login signs in from the login form and redirects to ?next=
+func Login(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var in Credentials
+		if err := c.ShouldBind(&in); err != nil {
+			c.String(http.StatusBadRequest, "Invalid data")
+			return
+		}
+		_, token, err := svc.Users.Login(in.Name, in.Password)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		setSession(c, token)
+		c.Header("HX-Redirect", safeNext(c.PostForm("next")))
+		c.Status(http.StatusOK)
+	}
+}
+
+// Register creates an account from the sign-up form and signs it in
+func Register(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var in Credentials
+		if err := c.ShouldBind(&in); err != nil {
+			c.String(http.StatusBadRequest, "Invalid data")
+			return
+		}
+		_, token, err := svc.Users.Register(in.Name, in.Password)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		setSession(c, token)
+		c.Header("HX-Redirect", safeNext(c.PostForm("next")))
+		c.Status(http.StatusOK)
+	}
+}
+
+// Logout ends the session of the cookie or bearer token
+func Logout(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token := sessionToken(c); token != "" {
+			if err := svc.Users.Logout(token); err != nil {
+				respondError(c, err)
+				return
+			}
+		}
+		c.SetCookie(sessionCookie, "", -1, "/", "", c.Request.TLS != nil, true)
+		if isAPI(c) {
+			c.Status(http.StatusOK)
+			return
+		}
+		c.Header("HX-Redirect", "/login")
+		c.Status(http.StatusOK)
+	}
+}
+
+// JSON API
+
+func LoginJSON(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var in Credentials
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		user, token, err := svc.Users.Login(in.Name, in.Password)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"token": token, "user": user})
+	}
+}
+
+func RegisterJSON(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var in Credentials
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		user, token, err := svc.Users.Register(in.Name, in.Password)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"token": token, "user": user})
+	}
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yesakov/lukyasha-tracker/models"
+	"github.com/yesakov/lukyasha-tracker/services"
+)
+
+// ShowAwards is the event's awards with their winners and the award
+// definitions
+func ShowAwards(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		sheet, err := svc.Awards.Results(id)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.HTML(http.StatusOK, "event_awards.html", gin.H{
+			"Title":     "Awards",
+			"Sheet":     sheet,
+			"Kinds":     services.AwardKinds,
+			"ActiveTab": "events",
+			"Content":   "content_event_awards",
+		})
+	}
+}
+
+// ShowCertificates prints a certificate for each winner of the event's
+// awards
+func ShowCertificates(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		sheet, err := svc.Awards.Results(id)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.HTML(http.StatusOK, "award_certificates.html", gin.H{
+			"Title":   sheet.Event.Name + " awards",
+			"EventID": sheet.Event.ID,
+			"Awards":  sheet.Awards,
+			"Any":     anyWinners(sheet.Awards),
+		})
+	}
+}
+
+// ShowCertificate prints the certificates of one award
+func ShowCertificate(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		result, err := svc.Awards.Result(id)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.HTML(http.StatusOK, "award_certificates.html", gin.H{
+			"Title":   result.Award.Title,
+			"EventID": result.Event.ID,
+			"Awards":  []services.AwardResult{*result},
+			"Any":     len(result.Winners) > 0,
+		})
+	}
+}
+
+func anyWinners(results []services.AwardResult) bool {
+	for _, r := range results {
+		if len(r.Winners) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// AddAward adds an award from the definitions form (JSON for the API)
+func AddAward(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var a models.Award
+		if err := c.ShouldBind(&a); err != nil {
+			if isAPI(c) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.String(http.StatusBadRequest, "Invalid data")
+			return
+		}
+		if err := svc.Awards.AddAward(&a); err != nil {
+			respondError(c, err)
+			return
+		}
+		if isAPI(c) {
+			c.JSON(http.StatusCreated, a)
+			return
+		}
+		c.Header("HX-Refresh", "true")
+		c.Status(http.StatusOK)
+	}
+}
+
+func UpdateAward(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		var changes models.Award
+		if err := c.ShouldBind(&changes); err != nil {
+			if isAPI(c) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.String(http.StatusBadRequest, "Invalid data")
+			return
+		}
+		a, err := svc.Awards.UpdateAward(id, changes)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if isAPI(c) {
+			c.JSON(http.StatusOK, a)
+			return
+		}
+		c.Header("HX-Refresh", "true")
+		c.Status(http.StatusOK)
+	}
+}
+
+func RemoveAward(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if _, err := svc.Awards.RemoveAward(id); err != nil {
+			respondError(c, err)
+			return
+		}
+		if isAPI(c) {
+			c.Status(http.StatusOK)
+			return
+		}
+		c.Header("HX-Refresh", "true")
+		c.Status(http.StatusOK)
+	}
+}
+
+// JSON API
+
+func GetEventAwards(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		sheet, err := svc.Awards.Results(id)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, sheet)
+	}
+}
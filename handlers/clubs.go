@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yesakov/lukyasha-tracker/models"
+	"github.com/yesakov/lukyasha-tracker/services"
+)
+
+func ListClubs(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clubs, err := svc.Clubs.List()
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.HTML(http.StatusOK, "clubs.html", gin.H{
+			"Title":     "Clubs",
+			"Clubs":     clubs,
+			"ActiveTab": "clubs",
+			"Content":   "content_clubs",
+		})
+	}
+}
+
+func ShowClub(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		profile, err := svc.Clubs.Profile(id)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		people, err := svc.People.List()
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.HTML(http.StatusOK, "club_detail.html", gin.H{
+			"Title":     profile.Club.Name,
+			"Profile":   profile,
+			"Club":      profile.Club,
+			"People":    people,
+			"ActiveTab": "clubs",
+			"Content":   "content_club_detail",
+		})
+	}
+}
+
+// CreateClubHTMX takes a multipart form (the crest is optional) and returns
+// the new list item
+func CreateClubHTMX(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var club models.Club
+		if err := c.ShouldBind(&club); err != nil {
+			c.String(http.StatusBadRequest, "Invalid data")
+			return
+		}
+		crest, _ := c.FormFile("crest")
+		if err := svc.Clubs.Create(&club, crest); err != nil {
+			respondError(c, err)
+			return
+		}
+		c.HTML(http.StatusOK, "club_item.html", club)
+	}
+}
+
+// UpdateClubHTMX saves the edit form and reloads the club page
+func UpdateClubHTMX(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		var changes models.Club
+		if err := c.ShouldBind(&changes); err != nil {
+			c.String(http.StatusBadRequest, "Invalid data")
+			return
+		}
+		crest, _ := c.FormFile("crest")
+		if _, err := svc.Clubs.Update(id, changes, crest); err != nil {
+			respondError(c, err)
+			return
+		}
+		c.Header("HX-Refresh", "true")
+		c.Status(http.StatusOK)
+	}
+}
+
+func DeleteClub(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if err := svc.Clubs.Delete(id); err != nil {
+			respondError(c, err)
+			return
+		}
+		if isAPI(c) {
+			c.Status(http.StatusOK)
+			return
+		}
+		if isHTMX(c) && c.GetHeader("HX-Target") == "" {
+			// From the club page (no inline target): back to the list
+			c.Header("HX-Redirect", "/clubs")
+		} else {
+			c.Header("HX-Trigger", toastTrigger("Club deleted"))
+		}
+		c.Status(http.StatusOK)
+	}
+}
+
+// AddClubMember adds a person to the default roster and re-renders it
+func AddClubMember(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		var in struct {
+			PersonID uint `form:"person_id" json:"person_id"`
+		}
+		if err := c.ShouldBind(&in); err != nil || in.PersonID == 0 {
+			c.String(http.StatusBadRequest, "Invalid data")
+			return
+		}
+		if err := svc.Clubs.AddMember(id, in.PersonID); err != nil {
+			respondError(c, err)
+			return
+		}
+		renderRoster(c, svc, id)
+	}
+}
+
+func RemoveClubMember(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		personID, err := paramID(c, "personId")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if err := svc.Clubs.RemoveMember(id, personID); err != nil {
+			respondError(c, err)
+			return
+		}
+		renderRoster(c, svc, id)
+	}
+}
+
+func renderRoster(c *gin.Context, svc *services.Services, clubID uint) {
+	club, err := svc.Clubs.Get(clubID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.HTML(http.StatusOK, "club_roster.html", gin.H{"Club": club})
+}
+
+// JSON API
+
+func GetClubs(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clubs, err := svc.Clubs.List()
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, clubs)
+	}
+}
+
+// GetClub returns the club with its roster, events, trophies and head-to-head
+func GetClub(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		profile, err := svc.Clubs.Profile(id)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, profile)
+	}
+}
+
+func CreateClubJSON(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var club models.Club
+		if err := c.ShouldBindJSON(&club); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := svc.Clubs.Create(&club, nil); err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, club)
+	}
+}
+
+func UpdateClub(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		var changes models.Club
+		if err := c.ShouldBindJSON(&changes); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		club, err := svc.Clubs.Update(id, changes, nil)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, club)
+	}
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yesakov/lukyasha-tracker/models"
+	"github.com/yesakov/lukyasha-tracker/services"
+)
+
+// EventTeams is an event with its teams, for grouped team pickers
+type EventTeams struct {
+	Event models.Event
+	Teams []models.Team
+}
+
+// CompareTeamsPage shows the team picker and, once ?a= and ?b= are given,
+// the head-to-head of the two sides
+func CompareTeamsPage(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		data, err := comparePage(svc, "teams")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		a, b := queryID(c, "a"), queryID(c, "b")
+		data["A"], data["B"] = a, b
+		if a != 0 && b != 0 {
+			result, err := svc.Compare.Teams(a, b)
+			if err != nil {
+				respondError(c, err)
+				return
+			}
+			data["Teams"] = result
+		}
+		c.HTML(http.StatusOK, "compare.html", data)
+	}
+}
+
+// ComparePlayersPage is CompareTeamsPage for two people
+func ComparePlayersPage(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		data, err := comparePage(svc, "players")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		a, b := queryID(c, "a"), queryID(c, "b")
+		data["A"], data["B"] = a, b
+		if a != 0 && b != 0 {
+			result, err := svc.Compare.Players(a, b)
+			if err != nil {
+				respondError(c, err)
+				return
+			}
+			data["Players"] = result
+		}
+		c.HTML(http.StatusOK, "compare.html", data)
+	}
+}
+
+// comparePage loads the options of both pickers
+func comparePage(svc *services.Services, kind string) (gin.H, error) {
+	events, err := svc.Events.List()
+	if err != nil {
+		return nil, err
+	}
+	teams, err := svc.Teams.List()
+	if err != nil {
+		return nil, err
+	}
+	people, err := svc.People.List()
+	if err != nil {
+		return nil, err
+	}
+	byEvent := make(map[uint][]models.Team)
+	for _, t := range teams {
+		byEvent[t.EventID] = append(byEvent[t.EventID], t)
+	}
+	var groups []EventTeams
+	for _, e := range events {
+		if len(byEvent[e.ID]) > 0 {
+			groups = append(groups, EventTeams{Event: e, Teams: byEvent[e.ID]})
+		}
+	}
+	return gin.H{
+		"Title":      "Compare",
+		"Kind":       kind,
+		"TeamGroups": groups,
+		"People":     people,
+		"ActiveTab":  "compare",
+		"Content":    "content_compare",
+	}, nil
+}
+
+// queryID parses an optional numeric query parameter (0 when absent)
+func queryID(c *gin.Context, name string) uint {
+	v, _ := strconv.ParseUint(c.Query(name), 10, 0)
+	return uint(v)
+}
+
+// JSON API
+
+// CompareTeams takes ?a=<team id>&b=<team id>
+func CompareTeams(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		a, b := queryID(c, "a"), queryID(c, "b")
+		if a == 0 || b == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "a and b are required"})
+			return
+		}
+		result, err := svc.Compare.Teams(a, b)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// ComparePlayers takes ?a=<person id>&b=<person id>
+func ComparePlayers(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		a, b := queryID(c, "a"), queryID(c, "b")
+		if a == 0 || b == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "a and b are required"})
+			return
+		}
+		result, err := svc.Compare.Players(a, b)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yesakov/lukyasha-tracker/models"
+	"github.com/yesakov/lukyasha-tracker/services"
+)
+
+// defaultDrawTeams is what the draw form starts with
+const defaultDrawTeams = 2
+
+// ShowDraw is the event's player pool and team generator
+func ShowDraw(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		event, err := svc.Events.Get(id)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		pool, err := svc.Draws.Pool(event.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		people, err := svc.People.List()
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.HTML(http.StatusOK, "event_draw.html", gin.H{
+			"Title":     "Team draw",
+			"Event":     event,
+			"Pool":      pool,
+			"People":    people,
+			"Positions": services.Positions,
+			"Teams":     defaultDrawTeams,
+			"ActiveTab": "events",
+			"Content":   "content_event_draw",
+		})
+	}
+}
+
+// AddToPoolHTMX adds someone to the pool and re-renders it
+func AddToPoolHTMX(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var p models.PoolPlayer
+		if err := c.ShouldBind(&p); err != nil {
+			c.String(http.StatusBadRequest, "Invalid data")
+			return
+		}
+		if err := svc.Draws.AddToPool(&p); err != nil {
+			respondError(c, err)
+			return
+		}
+		renderPool(c, svc, p.EventID)
+	}
+}
+
+func UpdatePoolPlayer(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		var changes models.PoolPlayer
+		if err := c.ShouldBind(&changes); err != nil {
+			if isAPI(c) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.String(http.StatusBadRequest, "Invalid data")
+			return
+		}
+		p, err := svc.Draws.UpdatePoolPlayer(id, changes)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if isAPI(c) {
+			c.JSON(http.StatusOK, p)
+			return
+		}
+		renderPool(c, svc, p.EventID)
+	}
+}
+
+func RemoveFromPool(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		p, err := svc.Draws.RemoveFromPool(id)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if isAPI(c) {
+			c.Status(http.StatusOK)
+			return
+		}
+		renderPool(c, svc, p.EventID)
+	}
+}
+
+// PreviewDraw shows a draw without saving it; re-rolling posts the same form
+// without a seed
+func PreviewDraw(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		var opts services.DrawOptions
+		if err := c.ShouldBind(&opts); err != nil {
+			c.String(http.StatusBadRequest, "Invalid data")
+			return
+		}
+		d, err := svc.Draws.Draw(id, opts)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.HTML(http.StatusOK, "draw_preview.html", gin.H{"EventID": id, "Draw": d})
+	}
+}
+
+// CommitDraw saves the previewed draw (same seed and assignment) as the
+// event's teams
+func CommitDraw(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		var opts services.DrawOptions
+		if err := c.ShouldBind(&opts); err != nil {
+			c.String(http.StatusBadRequest, "Invalid data")
+			return
+		}
+		if opts.Assignment, err = parseAssignment(c.PostFormArray("assignment")); err != nil {
+			c.String(http.StatusBadRequest, "Invalid data")
+			return
+		}
+		if _, err := svc.Draws.Commit(id, opts); err != nil {
+			respondError(c, err)
+			return
+		}
+		c.Header("HX-Redirect", fmt.Sprintf("/events/%d", id))
+		c.Status(http.StatusOK)
+	}
+}
+
+// parseAssignment reads the preview's "team:poolID" fields back into the
+// pool IDs of each team, in form order
+func parseAssignment(values []string) ([][]uint, error) {
+	var out [][]uint
+	for _, v := range values {
+		team, poolID, ok := strings.Cut(v, ":")
+		if !ok {
+			return nil, fmt.Errorf("bad assignment %q", v)
+		}
+		t, err := strconv.Atoi(team)
+		if err != nil || t < 0 || t >= len(values) {
+			return nil, fmt.Errorf("bad assignment %q", v)
+		}
+		id, err := strconv.ParseUint(poolID, 10, 0)
+		if err != nil {
+			return nil, fmt.Errorf("bad assignment %q", v)
+		}
+		for len(out) <= t {
+			out = append(out, nil)
+		}
+		out[t] = append(out[t], uint(id))
+	}
+	return out, nil
+}
+
+func renderPool(c *gin.Context, svc *services.Services, eventID uint) {
+	pool, err := svc.Draws.Pool(eventID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.HTML(http.StatusOK, "draw_pool.html", gin.H{"EventID": eventID, "Pool": pool, "Positions": services.Positions})
+}
+
+// JSON API
+
+func GetEventPool(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if _, err := svc.Events.Get(id); err != nil {
+			respondError(c, err)
+			return
+		}
+		pool, err := svc.Draws.Pool(id)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, pool)
+	}
+}
+
+func AddToPoolJSON(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var p models.PoolPlayer
+		if err := c.ShouldBindJSON(&p); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := svc.Draws.AddToPool(&p); err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, p)
+	}
+}
+
+func DrawJSON(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		var opts services.DrawOptions
+		if err := c.ShouldBindJSON(&opts); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		d, err := svc.Draws.Draw(id, opts)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, d)
+	}
+}
+
+func CommitDrawJSON(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		var opts services.DrawOptions
+		if err := c.ShouldBindJSON(&opts); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		teams, err := svc.Draws.Commit(id, opts)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, teams)
+	}
+}
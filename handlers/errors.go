@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yesakov/lukyasha-tracker/services"
+)
+
+var errBadID = &services.Error{Kind: services.ErrNotFound, Msg: "Not found"}
+
+// statusFor maps domain error kinds to HTTP statuses
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, services.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrValidation):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrUnauthorized):
+		return http.StatusUnauthorized
+	}
+	return http.StatusInternalServerError
+}
+
+// respondError writes err in the style the caller expects: JSON for /api
+// routes, plain text plus a toast for HTMX, plain text otherwise
+func respondError(c *gin.Context, err error) {
+	status := statusFor(err)
+	msg := services.Message(err)
+	if status == http.StatusInternalServerError {
+		log.Printf("%s %s: %v", c.Request.Method, c.Request.URL.Path, err)
+	}
+	switch {
+	case isAPI(c):
+		if blockers := services.Blockers(err); len(blockers) > 0 {
+			c.JSON(status, gin.H{"error": msg, "blocked": blockers})
+			return
+		}
+		c.JSON(status, gin.H{"error": msg})
+	case isHTMX(c):
+		c.Header("HX-Trigger", toastTrigger(msg))
+		c.String(status, msg)
+	default:
+		c.String(status, msg)
+	}
+}
+
+func isAPI(c *gin.Context) bool {
+	return strings.HasPrefix(c.Request.URL.Path, "/api/")
+}
+
+func isHTMX(c *gin.Context) bool {
+	return c.GetHeader("HX-Request") == "true"
+}
+
+// toastTrigger builds an HX-Trigger value that shows msg as a toast
+func toastTrigger(msg string) string {
+	b, _ := json.Marshal(map[string]string{"toast": msg})
+	return string(b)
+}
+
+// confirmTrigger builds an HX-Trigger value asking the user to confirm msg
+// before the DELETE is repeated at retry
+func confirmTrigger(msg, retry string) string {
+	b, _ := json.Marshal(map[string]map[string]string{"confirm-delete": {"message": msg, "retry": retry}})
+	return string(b)
+}
+
+// deletePolicy reads ?policy= (restrict, cascade or anonymize)
+func deletePolicy(c *gin.Context) (services.DeletePolicy, error) {
+	return services.ParseDeletePolicy(c.Query("policy"))
+}
+
+// respondBlocked answers a refused delete from HTMX by asking the user to
+// confirm deleting with cascade at retry (app.js); it reports whether it did
+func respondBlocked(c *gin.Context, err error, retry string) bool {
+	if !errors.Is(err, services.ErrConflict) || !isHTMX(c) {
+		return false
+	}
+	c.Header("HX-Trigger", confirmTrigger(services.Message(err), retry+"?policy=cascade"))
+	c.String(http.StatusConflict, services.Message(err))
+	return true
+}
+
+// paramID parses a numeric route parameter
+func paramID(c *gin.Context, name string) (uint, error) {
+	v, err := strconv.ParseUint(c.Param(name), 10, 0)
+	if err != nil || v == 0 {
+		return 0, errBadID
+	}
+	return uint(v), nil
+}
@@ -1,17 +1,21 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
-	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/yesakov/lukyasha-tracker/models"
+	"github.com/yesakov/lukyasha-tracker/services"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
+// leaderboardSize is how many rows the top scorers/assistants lists show
+const leaderboardSize = 10
+
 func NewEventForm() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.HTML(http.StatusOK, "events_new.html", gin.H{
@@ -22,10 +26,13 @@ func NewEventForm() gin.HandlerFunc {
 	}
 }
 
-func ListEvents(db *gorm.DB) gin.HandlerFunc {
+func ListEvents(svc *services.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var events []models.Event
-		db.Order("created_at DESC").Find(&events)
+		events, err := svc.Events.List()
+		if err != nil {
+			respondError(c, err)
+			return
+		}
 		c.HTML(http.StatusOK, "events.html", gin.H{
 			"Title":     "Events",
 			"Events":    events,
@@ -35,265 +42,129 @@ func ListEvents(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-func ShowEvent(db *gorm.DB) gin.HandlerFunc {
+func ShowEvent(svc *services.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id := c.Param("id")
-
-		var event models.Event
-		if err := db.First(&event, id).Error; err != nil {
-			c.String(http.StatusNotFound, "Event not found")
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
 			return
 		}
-
-		var teams []models.Team
-		db.Where("event_id = ?", event.ID).Find(&teams)
-
-		// Load players for each team
-		for i := range teams {
-			var players []models.Player
-			db.Where("team_id = ?", teams[i].ID).Find(&players)
-			teams[i].Players = players
+		event, err := svc.Events.Get(id)
+		if err != nil {
+			respondError(c, err)
+			return
 		}
-
-		// Load games for this event
-		var games []models.Game
-		db.Where("event_id = ?", event.ID).Find(&games)
-
-		// Build standings
-		type StandRow struct {
-			Team   models.Team
-			Played int
-			Wins   int
-			Draws  int
-			Losses int
-			GF     int
-			GA     int
-			GD     int
-			Points int
+		teams, err := svc.Events.Teams(event.ID)
+		if err != nil {
+			respondError(c, err)
+			return
 		}
-
-		standMap := make(map[uint]*StandRow)
-		for _, t := range teams {
-			standMap[t.ID] = &StandRow{Team: t}
-		}
-		for _, g := range games {
-			home := standMap[g.HomeTeamID]
-			away := standMap[g.AwayTeamID]
-			if home == nil || away == nil {
-				continue
-			}
-			home.Played++
-			away.Played++
-			home.GF += g.HomeTeamGoals
-			home.GA += g.AwayTeamGoals
-			away.GF += g.AwayTeamGoals
-			away.GA += g.HomeTeamGoals
-			if g.HomeTeamGoals > g.AwayTeamGoals {
-				home.Wins++
-				home.Points += 3
-				away.Losses++
-			} else if g.HomeTeamGoals < g.AwayTeamGoals {
-				away.Wins++
-				away.Points += 3
-				home.Losses++
-			} else {
-				home.Draws++
-				away.Draws++
-				home.Points++
-				away.Points++
-			}
+		games, err := svc.Events.Games(event.ID)
+		if err != nil {
+			respondError(c, err)
+			return
 		}
-		for _, s := range standMap {
-			s.GD = s.GF - s.GA
+		data, err := eventStats(svc, event.ID, 0)
+		if err != nil {
+			respondError(c, err)
+			return
 		}
-		standings := make([]*StandRow, 0, len(standMap))
-		for _, s := range standMap {
-			standings = append(standings, s)
+		clubs, err := svc.Clubs.List()
+		if err != nil {
+			respondError(c, err)
+			return
 		}
-		sort.Slice(standings, func(i, j int) bool {
-			if standings[i].Points != standings[j].Points {
-				return standings[i].Points > standings[j].Points
-			}
-			if standings[i].GD != standings[j].GD {
-				return standings[i].GD > standings[j].GD
-			}
-			if standings[i].GF != standings[j].GF {
-				return standings[i].GF > standings[j].GF
-			}
-			return standings[i].Team.Name < standings[j].Team.Name
-		})
-
-		// Leaderboards (top scorers/assistants)
-		type aggRow struct {
-			PlayerID uint
-			Cnt      int
-		}
-		var gameIDs []uint
-		db.Model(&models.Game{}).Where("event_id = ?", event.ID).Pluck("id", &gameIDs)
-		topScorers := []gin.H{}
-		topAssists := []gin.H{}
-		if len(gameIDs) > 0 {
-			var gr []aggRow
-			// Count only normal and penalty goals; exclude own goals
-			db.Model(&models.GamePlayerStat{}).
-				Select("player_id, COUNT(*) as cnt").
-				Where("type IN ? AND game_id IN ?", []string{models.StatTypeGoal, models.StatTypePenalty}, gameIDs).
-				Group("player_id").Order("cnt DESC").Limit(10).Scan(&gr)
-			for _, r := range gr {
-				var p models.Player
-				var t models.Team
-				db.First(&p, r.PlayerID)
-				db.First(&t, p.TeamID)
-				topScorers = append(topScorers, gin.H{"player": p.Name, "team": t.Name, "count": r.Cnt})
-			}
-			gr = nil
-			db.Model(&models.GamePlayerStat{}).
-				Select("player_id, COUNT(*) as cnt").
-				Where("type = ? AND game_id IN ?", models.StatTypeAssist, gameIDs).
-				Group("player_id").Order("cnt DESC").Limit(10).Scan(&gr)
-			for _, r := range gr {
-				var p models.Player
-				var t models.Team
-				db.First(&p, r.PlayerID)
-				db.First(&t, p.TeamID)
-				topAssists = append(topAssists, gin.H{"player": p.Name, "team": t.Name, "count": r.Cnt})
-			}
+		transfers, err := svc.Transfers.List(event.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		best, err := svc.MVP.Best(event.ID)
+		if err != nil {
+			respondError(c, err)
+			return
 		}
 
-		c.HTML(http.StatusOK, "event_detail.html", gin.H{
-			"Title":      "Event Details",
-			"Event":      event,
-			"Teams":      teams,
-			"Games":      games,
-			"Standings":  standings,
-			"TopScorers": topScorers,
-			"TopAssists": topAssists,
-			"ActiveTab":  "events",
-			"Content":    "content_event_detail",
-		})
+		data["Title"] = "Event Details"
+		data["Event"] = event
+		data["Teams"] = teams
+		data["Games"] = games
+		data["Clubs"] = clubs
+		data["Transfers"] = transfers
+		data["Best"] = best
+		data["ActiveTab"] = "events"
+		data["Content"] = "content_event_detail"
+		c.HTML(http.StatusOK, "event_detail.html", data)
 	}
 }
 
-// EventGamesPartial renders only the games list for an event
-func EventGamesPartial(db *gorm.DB) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		id := c.Param("id")
-		var games []models.Game
-		db.Where("event_id = ?", id).Find(&games)
-		c.HTML(http.StatusOK, "event_games_list.html", gin.H{"Games": games})
+// eventStats gathers standings and leaderboards for event_stats.html; a
+// non-zero teamID narrows the leaderboards to that team
+func eventStats(svc *services.Services, eventID, teamID uint) (gin.H, error) {
+	stats, err := svc.Standings.EventStats(eventID, teamID, leaderboardSize)
+	if err != nil {
+		return nil, err
 	}
+	return gin.H{
+		"EventID":     eventID,
+		"TeamFilter":  teamID,
+		"Standings":   stats.Standings,
+		"TopScorers":  stats.TopScorers,
+		"TopAssists":  stats.TopAssists,
+		"Goalkeepers": stats.Goalkeepers,
+		"Records":     stats.Records,
+	}, nil
 }
 
-// EventStatsPartial recomputes standings and leaderboards and renders the section
-func EventStatsPartial(db *gorm.DB) gin.HandlerFunc {
+// EventGamesPartial renders only the games list for an event, with the same
+// ETag as the stats partial
+func EventGamesPartial(svc *services.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id := c.Param("id")
-		var event models.Event
-		if err := db.First(&event, id).Error; err != nil {
-			c.Status(http.StatusNotFound)
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if notModified(c, svc.Standings.ETag(id)) {
 			return
 		}
-		var teams []models.Team
-		db.Where("event_id = ?", event.ID).Find(&teams)
-		var games []models.Game
-		db.Where("event_id = ?", event.ID).Find(&games)
+		games, err := svc.Events.Games(id)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.HTML(http.StatusOK, "event_games_list.html", gin.H{"Games": games})
+	}
+}
 
-		type StandRow struct {
-			Team   models.Team
-			Played int
-			Wins   int
-			Draws  int
-			Losses int
-			GF     int
-			GA     int
-			GD     int
-			Points int
-		}
-		standMap := make(map[uint]*StandRow)
-		for _, t := range teams {
-			standMap[t.ID] = &StandRow{Team: t}
-		}
-		for _, g := range games {
-			home := standMap[g.HomeTeamID]
-			away := standMap[g.AwayTeamID]
-			if home == nil || away == nil {
-				continue
-			}
-			home.Played++
-			away.Played++
-			home.GF += g.HomeTeamGoals
-			home.GA += g.AwayTeamGoals
-			away.GF += g.AwayTeamGoals
-			away.GA += g.HomeTeamGoals
-			if g.HomeTeamGoals > g.AwayTeamGoals {
-				home.Wins++
-				home.Points += 3
-				away.Losses++
-			} else if g.HomeTeamGoals < g.AwayTeamGoals {
-				away.Wins++
-				away.Points += 3
-				home.Losses++
-			} else {
-				home.Draws++
-				away.Draws++
-				home.Points++
-				away.Points++
-			}
+// EventStatsPartial renders the cached standings and leaderboards section;
+// clients sending the current ETag get 304 without touching the database.
+// ?team=<id> narrows the leaderboards to one team.
+func EventStatsPartial(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
 		}
-		for _, s := range standMap {
-			s.GD = s.GF - s.GA
+		if notModified(c, svc.Standings.ETag(id)) {
+			return
 		}
-		standings := make([]*StandRow, 0, len(standMap))
-		for _, s := range standMap {
-			standings = append(standings, s)
+		if _, err := svc.Events.Get(id); err != nil {
+			respondError(c, err)
+			return
 		}
-		sort.Slice(standings, func(i, j int) bool {
-			if standings[i].Points != standings[j].Points {
-				return standings[i].Points > standings[j].Points
-			}
-			if standings[i].GD != standings[j].GD {
-				return standings[i].GD > standings[j].GD
-			}
-			if standings[i].GF != standings[j].GF {
-				return standings[i].GF > standings[j].GF
-			}
-			return standings[i].Team.Name < standings[j].Team.Name
-		})
-
-		// Leaderboards
-		type aggRow struct {
-			PlayerID uint
-			Cnt      int
-		}
-		var gameIDs []uint
-		db.Model(&models.Game{}).Where("event_id = ?", event.ID).Pluck("id", &gameIDs)
-		topScorers := []gin.H{}
-		topAssists := []gin.H{}
-		if len(gameIDs) > 0 {
-			var gr []aggRow
-			db.Model(&models.GamePlayerStat{}).Select("player_id, COUNT(*) as cnt").Where("type IN ? AND game_id IN ?", []string{models.StatTypeGoal, models.StatTypePenalty}, gameIDs).Group("player_id").Order("cnt DESC").Limit(10).Scan(&gr)
-			for _, r := range gr {
-				var p models.Player
-				var t models.Team
-				db.First(&p, r.PlayerID)
-				db.First(&t, p.TeamID)
-				topScorers = append(topScorers, gin.H{"player": p.Name, "team": t.Name, "count": r.Cnt})
-			}
-			gr = nil
-			db.Model(&models.GamePlayerStat{}).Select("player_id, COUNT(*) as cnt").Where("type = ? AND game_id IN ?", models.StatTypeAssist, gameIDs).Group("player_id").Order("cnt DESC").Limit(10).Scan(&gr)
-			for _, r := range gr {
-				var p models.Player
-				var t models.Team
-				db.First(&p, r.PlayerID)
-				db.First(&t, p.TeamID)
-				topAssists = append(topAssists, gin.H{"player": p.Name, "team": t.Name, "count": r.Cnt})
-			}
+		teamID, _ := strconv.ParseUint(c.Query("team"), 10, 0)
+		data, err := eventStats(svc, id, uint(teamID))
+		if err != nil {
+			respondError(c, err)
+			return
 		}
-		c.HTML(http.StatusOK, "event_stats.html", gin.H{"Standings": standings, "TopScorers": topScorers, "TopAssists": topAssists})
+		c.HTML(http.StatusOK, "event_stats.html", data)
 	}
 }
 
-func CreateEvent(db *gorm.DB) gin.HandlerFunc {
+func CreateEvent(svc *services.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var input models.Event
 		if err := c.ShouldBind(&input); err != nil {
@@ -304,27 +175,22 @@ func CreateEvent(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		if input.Name == "" || input.Date == "" || input.EventURL == "" {
-			c.HTML(http.StatusOK, "events_new_form.html", gin.H{
-				"Title":    "Create New Event",
-				"Error":    "All fields are required",
-				"Name":     input.Name,
-				"Date":     input.Date,
-				"EventURL": input.EventURL,
-			})
-			return
-		}
-
-		if err := db.Create(&input).Error; err != nil {
-			c.HTML(http.StatusOK, "events_new_form.html", gin.H{
+		if err := svc.Events.Create(&input); err != nil {
+			data := gin.H{
 				"Title": "Create New Event",
-				"Error": "Database error",
-			})
+				"Error": services.Message(err),
+			}
+			if errors.Is(err, services.ErrValidation) {
+				data["Name"] = input.Name
+				data["Date"] = input.Date
+				data["EventURL"] = input.EventURL
+			}
+			c.HTML(http.StatusOK, "events_new_form.html", data)
 			return
 		}
 
 		// If this is an HTMX request, ask client to redirect the whole page
-		if c.GetHeader("HX-Request") == "true" {
+		if isHTMX(c) {
 			c.Header("HX-Redirect", fmt.Sprintf("/events/%d", input.ID))
 			c.Status(http.StatusOK)
 			return
@@ -335,11 +201,15 @@ func CreateEvent(db *gorm.DB) gin.HandlerFunc {
 }
 
 // TeamOptions returns OOB swaps to refresh the home/away selects for an event
-func TeamOptions(db *gorm.DB) gin.HandlerFunc {
+func TeamOptions(svc *services.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id := c.Param("id")
-		var teams []models.Team
-		if err := db.Where("event_id = ?", id).Order("name asc").Find(&teams).Error; err != nil {
+		id, err := paramID(c, "id")
+		if err != nil {
+			c.Status(http.StatusNoContent)
+			return
+		}
+		teams, err := svc.Teams.ListByEvent(id)
+		if err != nil {
 			c.Status(http.StatusNoContent)
 			return
 		}
@@ -348,46 +218,23 @@ func TeamOptions(db *gorm.DB) gin.HandlerFunc {
 }
 
 // DeleteEvent removes event and all related data and redirects to /events
-func DeleteEvent(db *gorm.DB) gin.HandlerFunc {
+func DeleteEvent(svc *services.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id := c.Param("id")
-		tx := db.Begin()
-		defer func() {
-			if r := recover(); r != nil {
-				tx.Rollback()
-			}
-		}()
-
-		// Delete stats for games in this event
-		var gameIDs []uint
-		tx.Model(&models.Game{}).Where("event_id = ?", id).Pluck("id", &gameIDs)
-		if len(gameIDs) > 0 {
-			tx.Where("game_id IN ?", gameIDs).Delete(&models.GamePlayerStat{})
-		}
-		// Delete games
-		tx.Where("event_id = ?", id).Delete(&models.Game{})
-
-		// Delete players and teams
-		var teamIDs []uint
-		tx.Model(&models.Team{}).Where("event_id = ?", id).Pluck("id", &teamIDs)
-		if len(teamIDs) > 0 {
-			tx.Where("team_id IN ?", teamIDs).Delete(&models.Player{})
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
 		}
-		tx.Where("event_id = ?", id).Delete(&models.Team{})
-
-		// Finally delete the event
-		if err := tx.Delete(&models.Event{}, id).Error; err != nil {
-			tx.Rollback()
-			c.String(http.StatusInternalServerError, "Delete error")
+		if err := svc.Events.Delete(id); err != nil {
+			respondError(c, err)
 			return
 		}
-		tx.Commit()
 
-		if c.GetHeader("HX-Request") == "true" {
+		if isHTMX(c) {
 			ref := c.Request.Referer()
 			if strings.Contains(ref, "/events") && !strings.Contains(ref, "/events/") {
 				// Inline delete from events list: trigger toast and do not redirect
-				c.Header("HX-Trigger", "{\"toast\":\"Event deleted\"}")
+				c.Header("HX-Trigger", toastTrigger("Event deleted"))
 				c.Status(http.StatusOK)
 				return
 			}
@@ -400,50 +247,90 @@ func DeleteEvent(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-func GetEvents(db *gorm.DB) gin.HandlerFunc {
+func GetEvents(svc *services.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var events []models.Event
-		if err := db.Find(&events).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		events, err := svc.Events.List()
+		if err != nil {
+			respondError(c, err)
 			return
 		}
 		c.JSON(http.StatusOK, events)
 	}
 }
 
-func GetEvent(db *gorm.DB) gin.HandlerFunc {
+func GetEvent(svc *services.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var event models.Event
-		id := c.Param("id")
-		if err := db.First(&event, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		event, err := svc.Events.Get(id)
+		if err != nil {
+			respondError(c, err)
 			return
 		}
 		c.JSON(http.StatusOK, event)
 	}
 }
 
-func UpdateEvent(db *gorm.DB) gin.HandlerFunc {
+// GetEventRecords returns the event's derived goal records, with the same
+// ETag as the event partials
+func GetEventRecords(svc *services.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id := c.Param("id")
-		var existing models.Event
-		if err := db.First(&existing, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
 			return
 		}
+		if notModified(c, svc.Standings.ETag(id)) {
+			return
+		}
+		if _, err := svc.Events.Get(id); err != nil {
+			respondError(c, err)
+			return
+		}
+		stats, err := svc.Standings.EventStats(id, 0, leaderboardSize)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, stats.Records)
+	}
+}
+
+func CreateEventJSON(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var event models.Event
+		if err := c.ShouldBindJSON(&event); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := svc.Events.Create(&event); err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, event)
+	}
+}
 
+func UpdateEvent(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
 		var updated models.Event
 		if err := c.ShouldBindJSON(&updated); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-
-		if err := db.Model(&existing).Updates(updated).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		event, err := svc.Events.Update(id, updated)
+		if err != nil {
+			respondError(c, err)
 			return
 		}
-		c.JSON(http.StatusOK, existing)
+		c.JSON(http.StatusOK, event)
 	}
 }
-
-// old simple DeleteEvent removed in favor of transactional DeleteEvent above
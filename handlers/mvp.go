@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yesakov/lukyasha-tracker/models"
+	"github.com/yesakov/lukyasha-tracker/services"
+)
+
+// VoteMVP casts the player of the match vote of the signed-in user, or of
+// the browser for visitors, and re-renders the ballot. API clients could
+// make up any number of devices, so they have to sign in.
+func VoteMVP(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		var vote models.MVPVote
+		if isAPI(c) {
+			err = c.ShouldBindJSON(&vote)
+		} else {
+			err = c.ShouldBind(&vote)
+		}
+		if err != nil {
+			if isAPI(c) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.String(http.StatusBadRequest, "Invalid data")
+			return
+		}
+		device := ""
+		if userID(c) == 0 {
+			if isAPI(c) {
+				respondError(c, errLoginFirst)
+				return
+			}
+			device = deviceToken(c, true)
+		}
+		if _, err := svc.MVP.Vote(id, vote.PlayerID, userID(c), device); err != nil {
+			respondError(c, err)
+			return
+		}
+		ballot, err := svc.MVP.Ballot(id, userID(c), device)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if isAPI(c) {
+			c.JSON(http.StatusOK, ballot)
+			return
+		}
+		c.Header("HX-Trigger", toastTrigger("Vote counted"))
+		c.HTML(http.StatusOK, "game_mvp.html", ballot)
+	}
+}
+
+// JSON API
+
+func GetGameMVP(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		ballot, err := svc.MVP.Ballot(id, userID(c), deviceToken(c, false))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, ballot)
+	}
+}
+
+// GetEventMVP ranks the event's players by player of the match awards; the
+// first is the best player
+func GetEventMVP(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		rows, err := svc.MVP.Best(id)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, rows)
+	}
+}
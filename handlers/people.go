@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yesakov/lukyasha-tracker/services"
+)
+
+// MergeInput keeps one person and folds the others into it
+type MergeInput struct {
+	KeepID uint   `form:"keep" json:"keep"`
+	IDs    []uint `form:"ids" json:"ids"`
+}
+
+func ListPeople(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		people, err := svc.People.List()
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.HTML(http.StatusOK, "people.html", gin.H{
+			"Title":     "Players",
+			"People":    people,
+			"ActiveTab": "people",
+			"Content":   "content_people",
+		})
+	}
+}
+
+func ShowPerson(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		career, err := svc.People.Career(id)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		rating, err := svc.Ratings.Person(id)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.HTML(http.StatusOK, "person_detail.html", gin.H{
+			"Title":     career.Person.Name,
+			"Career":    career,
+			"Rating":    rating,
+			"ActiveTab": "people",
+			"Content":   "content_person_detail",
+		})
+	}
+}
+
+// PeopleDuplicates is the merge tool: people sharing a name, grouped
+func PeopleDuplicates(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		groups, err := svc.People.Duplicates()
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.HTML(http.StatusOK, "people_merge.html", gin.H{
+			"Title":     "Merge duplicates",
+			"Groups":    groups,
+			"ActiveTab": "people",
+			"Content":   "content_people_merge",
+		})
+	}
+}
+
+// MergePeopleHTMX merges one group and re-renders the remaining groups
+func MergePeopleHTMX(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var in MergeInput
+		if err := c.ShouldBind(&in); err != nil {
+			c.String(http.StatusBadRequest, "Invalid data")
+			return
+		}
+		keep, err := svc.People.Merge(in.KeepID, in.IDs)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		groups, err := svc.People.Duplicates()
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.Header("HX-Trigger", toastTrigger(fmt.Sprintf("Merged into %s", keep.Name)))
+		c.HTML(http.StatusOK, "people_duplicates.html", gin.H{"Groups": groups})
+	}
+}
+
+// JSON API
+
+func GetPeople(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		people, err := svc.People.List()
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, people)
+	}
+}
+
+// GetPerson returns the person's career
+func GetPerson(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		career, err := svc.People.Career(id)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, career)
+	}
+}
+
+// GetPersonRating returns the person's Elo rating with its history
+func GetPersonRating(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		rating, err := svc.Ratings.Person(id)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, rating)
+	}
+}
+
+func MergePeople(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var in MergeInput
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		keep, err := svc.People.Merge(in.KeepID, in.IDs)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, keep)
+	}
+}
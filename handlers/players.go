@@ -4,123 +4,198 @@ import (
 	"net/http"
 
 	"github.com/yesakov/lukyasha-tracker/models"
+	"github.com/yesakov/lukyasha-tracker/services"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
-func CreatePlayerHTMX(db *gorm.DB) gin.HandlerFunc {
+func CreatePlayerHTMX(svc *services.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var player models.Player
 		if err := c.ShouldBind(&player); err != nil {
 			c.String(http.StatusBadRequest, "Invalid data")
 			return
 		}
-
-		if player.Name == "" || player.TeamID == 0 {
-			c.String(http.StatusBadRequest, "Name and TeamID required")
-			return
-		}
-
-		// Check for duplicate
-		var existing models.Player
-		if err := db.Where("team_id = ? AND name = ?", player.TeamID, player.Name).First(&existing).Error; err == nil {
-			c.String(http.StatusConflict, "Player already exists")
+		if err := svc.Players.Create(&player); err != nil {
+			respondError(c, err)
 			return
 		}
-
-		db.Create(&player)
-
-		// This is all you need:
 		c.HTML(http.StatusOK, "player_item.html", player)
 	}
 }
 
-func GetPlayers(db *gorm.DB) gin.HandlerFunc {
+func GetPlayers(svc *services.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var players []models.Player
-		if err := db.Find(&players).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		players, err := svc.Players.List()
+		if err != nil {
+			respondError(c, err)
 			return
 		}
 		c.JSON(http.StatusOK, players)
 	}
 }
 
-func GetPlayer(db *gorm.DB) gin.HandlerFunc {
+func GetPlayer(svc *services.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var player models.Player
-		id := c.Param("id")
-		if err := db.First(&player, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Player not found"})
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		player, err := svc.Players.Get(id)
+		if err != nil {
+			respondError(c, err)
 			return
 		}
 		c.JSON(http.StatusOK, player)
 	}
 }
 
-func CreatePlayerJSON(db *gorm.DB) gin.HandlerFunc {
+func CreatePlayerJSON(svc *services.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var player models.Player
 		if err := c.ShouldBindJSON(&player); err != nil {
-			c.JSON(400, gin.H{"error": err.Error()})
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-
-		if player.Name == "" || player.TeamID == 0 {
-			c.JSON(400, gin.H{"error": "Name and TeamID are required"})
+		if err := svc.Players.Create(&player); err != nil {
+			respondError(c, err)
 			return
 		}
+		c.JSON(http.StatusCreated, player)
+	}
+}
 
-		// Check for existing player in team
-		var existing models.Player
-		if err := db.
-			Where("team_id = ? AND name = ?", player.TeamID, player.Name).
-			First(&existing).Error; err == nil {
-			c.JSON(409, gin.H{"error": "Player with this name already exists in the team"})
+// UpdatePlayer saves JSON changes on the API and the inline rename form in
+// the team card, which gets the player's row back
+func UpdatePlayer(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
 			return
 		}
-
-		if err := db.Create(&player).Error; err != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
+		var updated models.Player
+		if err := c.ShouldBind(&updated); err != nil {
+			if isAPI(c) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			} else {
+				c.String(http.StatusBadRequest, "Invalid data")
+			}
 			return
 		}
-
-		db.First(&player, player.ID)
-		c.JSON(201, player)
+		player, err := svc.Players.Update(id, updated, nil)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if isAPI(c) {
+			c.JSON(http.StatusOK, player)
+			return
+		}
+		c.HTML(http.StatusOK, "player_item.html", player)
 	}
 }
 
-func UpdatePlayer(db *gorm.DB) gin.HandlerFunc {
+// SetArmband makes a player captain or vice-captain; the team card comes
+// back so the previous holder loses the badge
+func SetArmband(svc *services.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id := c.Param("id")
-		var existing models.Player
-		if err := db.First(&existing, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Player not found"})
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
 			return
 		}
-
-		var updated models.Player
-		if err := c.ShouldBindJSON(&updated); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		player, err := svc.Players.SetArmband(id, c.PostForm("armband"))
+		if err != nil {
+			respondError(c, err)
 			return
 		}
+		renderTeamCard(c, svc, player.TeamID)
+	}
+}
 
-		if err := db.Model(&existing).Updates(updated).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+// UpdatePlayerHTMX saves the profile form (number, position, foot, photo)
+// and reloads the page
+func UpdatePlayerHTMX(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
 			return
 		}
-		c.JSON(http.StatusOK, existing)
+		var changes models.Player
+		if err := c.ShouldBind(&changes); err != nil {
+			c.String(http.StatusBadRequest, "Invalid data")
+			return
+		}
+		photo, _ := c.FormFile("photo")
+		if _, err := svc.Players.Update(id, changes, photo); err != nil {
+			respondError(c, err)
+			return
+		}
+		c.Header("HX-Refresh", "true")
+		c.Status(http.StatusOK)
 	}
 }
 
-func DeletePlayer(db *gorm.DB) gin.HandlerFunc {
+func DeletePlayer(svc *services.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id := c.Param("id")
-		if err := db.Delete(&models.Player{}, id).Error; err != nil {
-			c.String(http.StatusInternalServerError, "Delete error")
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		policy, err := deletePolicy(c)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		err = svc.Players.Delete(id, policy)
+		if respondBlocked(c, err, "/players/"+c.Param("id")) {
+			return
+		}
+		if err != nil {
+			respondError(c, err)
 			return
 		}
 		c.Status(http.StatusOK) // HTMX will remove the target from DOM
 	}
 }
+
+// ShowEventPlayer is the player's page within one event
+func ShowEventPlayer(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		eventID, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		playerID, err := paramID(c, "playerId")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		report, err := svc.Players.Report(eventID, playerID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		var rating *services.RatingHistory
+		if report.Player.PersonID != nil {
+			if rating, err = svc.Ratings.Person(*report.Player.PersonID); err != nil {
+				respondError(c, err)
+				return
+			}
+		}
+		c.HTML(http.StatusOK, "event_player.html", gin.H{
+			"Title":     report.Player.Name,
+			"Report":    report,
+			"Rating":    rating,
+			"Positions": services.Positions,
+			"Feet":      services.PreferredFeet,
+			"ActiveTab": "events",
+			"Content":   "content_event_player",
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yesakov/lukyasha-tracker/models"
+	"github.com/yesakov/lukyasha-tracker/services"
+)
+
+// kickoffLayout is what <input type="datetime-local"> posts, in server time
+const kickoffLayout = "2006-01-02T15:04"
+
+// ShowPredictions is an event's prediction league
+func ShowPredictions(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		board, err := svc.Predictions.Board(id, userID(c))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.HTML(http.StatusOK, "event_predictions.html", gin.H{
+			"Title":     "Predictions",
+			"Board":     board,
+			"User":      currentUser(c),
+			"ActiveTab": "events",
+			"Content":   "content_event_predictions",
+		})
+	}
+}
+
+// PredictHTMX saves the signed-in user's tip and re-renders the game's row
+func PredictHTMX(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		user, ok := requireUser(c)
+		if !ok {
+			return
+		}
+		var tip models.Prediction
+		if err := c.ShouldBind(&tip); err != nil {
+			c.String(http.StatusBadRequest, "Invalid data")
+			return
+		}
+		if _, err := svc.Predictions.Predict(user.ID, id, tip); err != nil {
+			respondError(c, err)
+			return
+		}
+		row, err := svc.Predictions.Game(id, user.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.Header("HX-Trigger", toastTrigger("Prediction saved"))
+		c.HTML(http.StatusOK, "prediction_game.html", row)
+	}
+}
+
+// SetPredictionRules changes an event's scoring and reloads the page, as
+// every finished game's points change with it
+func SetPredictionRules(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		var rules services.PredictionRules
+		if err := c.ShouldBind(&rules); err != nil {
+			if isAPI(c) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.String(http.StatusBadRequest, "Invalid data")
+			return
+		}
+		saved, err := svc.Predictions.SetRules(id, rules)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if isAPI(c) {
+			c.JSON(http.StatusOK, saved)
+			return
+		}
+		c.Header("HX-Refresh", "true")
+		c.Status(http.StatusOK)
+	}
+}
+
+// SetKickoff sets the game's kick-off from its page; empty clears it
+func SetKickoff(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		var at *time.Time
+		if v := strings.TrimSpace(c.PostForm("kickoff_at")); v != "" {
+			t, err := time.ParseInLocation(kickoffLayout, v, time.Local)
+			if err != nil {
+				c.String(http.StatusBadRequest, "Invalid kick-off time")
+				return
+			}
+			at = &t
+		}
+		if _, err := svc.Games.SetKickoff(id, at); err != nil {
+			respondError(c, err)
+			return
+		}
+		c.Header("HX-Refresh", "true")
+		c.Status(http.StatusOK)
+	}
+}
+
+// JSON API
+
+func GetEventPredictions(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		board, err := svc.Predictions.Board(id, userID(c))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, board)
+	}
+}
+
+func PredictJSON(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		user, ok := requireUser(c)
+		if !ok {
+			return
+		}
+		var tip models.Prediction
+		if err := c.ShouldBindJSON(&tip); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		p, err := svc.Predictions.Predict(user.ID, id, tip)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, p)
+	}
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yesakov/lukyasha-tracker/models"
+	"github.com/yesakov/lukyasha-tracker/services"
+)
+
+func ListSeasons(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		seasons, err := svc.Seasons.List()
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.HTML(http.StatusOK, "seasons.html", gin.H{
+			"Title":     "Seasons",
+			"Seasons":   seasons,
+			"ActiveTab": "seasons",
+			"Content":   "content_seasons",
+		})
+	}
+}
+
+func ShowSeason(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		table, err := svc.Seasons.Table(id)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		events, err := svc.Events.List()
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		// Only events outside any season can be added
+		var free []models.Event
+		for _, e := range events {
+			if e.SeasonID == nil {
+				free = append(free, e)
+			}
+		}
+		c.HTML(http.StatusOK, "season_detail.html", gin.H{
+			"Title":      table.Season.Name,
+			"Table":      table,
+			"FreeEvents": free,
+			"ActiveTab":  "seasons",
+			"Content":    "content_season_detail",
+		})
+	}
+}
+
+func CreateSeasonHTMX(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var season models.Season
+		if err := c.ShouldBind(&season); err != nil {
+			c.String(http.StatusBadRequest, "Invalid data")
+			return
+		}
+		if err := svc.Seasons.Create(&season); err != nil {
+			respondError(c, err)
+			return
+		}
+		c.HTML(http.StatusOK, "season_item.html", season)
+	}
+}
+
+func DeleteSeason(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if err := svc.Seasons.Delete(id); err != nil {
+			respondError(c, err)
+			return
+		}
+		if isAPI(c) {
+			c.Status(http.StatusOK)
+			return
+		}
+		if isHTMX(c) && c.GetHeader("HX-Target") == "" {
+			c.Header("HX-Redirect", "/seasons")
+		} else {
+			c.Header("HX-Trigger", toastTrigger("Season deleted"))
+		}
+		c.Status(http.StatusOK)
+	}
+}
+
+// AddSeasonEvent makes an event the season's next matchday. The whole table
+// changes, so the page reloads.
+func AddSeasonEvent(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		var in struct {
+			EventID uint `form:"event_id" json:"event_id"`
+		}
+		if err := c.ShouldBind(&in); err != nil || in.EventID == 0 {
+			c.String(http.StatusBadRequest, "Invalid data")
+			return
+		}
+		if err := svc.Seasons.AddEvent(id, in.EventID); err != nil {
+			respondError(c, err)
+			return
+		}
+		c.Header("HX-Refresh", "true")
+		c.Status(http.StatusOK)
+	}
+}
+
+func RemoveSeasonEvent(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		eventID, err := paramID(c, "eventId")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if err := svc.Seasons.RemoveEvent(id, eventID); err != nil {
+			respondError(c, err)
+			return
+		}
+		c.Header("HX-Refresh", "true")
+		c.Status(http.StatusOK)
+	}
+}
+
+// JSON API
+
+func GetSeasons(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		seasons, err := svc.Seasons.List()
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, seasons)
+	}
+}
+
+// GetSeason returns the season table: standings, leaderboards and progression
+func GetSeason(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		table, err := svc.Seasons.Table(id)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, table)
+	}
+}
+
+func CreateSeasonJSON(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var season models.Season
+		if err := c.ShouldBindJSON(&season); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := svc.Seasons.Create(&season); err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, season)
+	}
+}
+
+func UpdateSeason(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		var changes models.Season
+		if err := c.ShouldBindJSON(&changes); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		season, err := svc.Seasons.Update(id, changes)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, season)
+	}
+}
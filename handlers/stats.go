@@ -5,96 +5,81 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/yesakov/lukyasha-tracker/models"
-	"gorm.io/gorm"
+	"github.com/yesakov/lukyasha-tracker/services"
 )
 
-func GetStats(db *gorm.DB) gin.HandlerFunc {
+func GetStats(svc *services.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var stats []models.GamePlayerStat
-		if err := db.Find(&stats).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		stats, err := svc.Stats.List()
+		if err != nil {
+			respondError(c, err)
 			return
 		}
 		c.JSON(http.StatusOK, stats)
 	}
 }
 
-func GetStat(db *gorm.DB) gin.HandlerFunc {
+func GetStat(svc *services.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var stat models.GamePlayerStat
-		id := c.Param("id")
-		if err := db.First(&stat, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Stat not found"})
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		stat, err := svc.Stats.Get(id)
+		if err != nil {
+			respondError(c, err)
 			return
 		}
 		c.JSON(http.StatusOK, stat)
 	}
 }
 
-func CreateStat(db *gorm.DB) gin.HandlerFunc {
+func CreateStat(svc *services.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var stat models.GamePlayerStat
 		if err := c.ShouldBindJSON(&stat); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		if err := db.Create(&stat).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := svc.Stats.Create(&stat); err != nil {
+			respondError(c, err)
 			return
 		}
 		c.JSON(http.StatusCreated, stat)
 	}
 }
 
-func UpdateStat(db *gorm.DB) gin.HandlerFunc {
+func UpdateStat(svc *services.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id := c.Param("id")
-		var existing models.GamePlayerStat
-		if err := db.First(&existing, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Stat not found"})
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
 			return
 		}
-
 		var updated models.GamePlayerStat
 		if err := c.ShouldBindJSON(&updated); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-
-		if err := db.Model(&existing).Updates(updated).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		stat, err := svc.Stats.Update(id, updated)
+		if err != nil {
+			respondError(c, err)
 			return
 		}
-		c.JSON(http.StatusOK, existing)
+		c.JSON(http.StatusOK, stat)
 	}
 }
 
-func DeleteStat(db *gorm.DB) gin.HandlerFunc {
+func DeleteStat(svc *services.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id := c.Param("id")
-		// Load stat to adjust game score if needed
-		var stat models.GamePlayerStat
-		if err := db.First(&stat, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Stat not found"})
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
 			return
 		}
-
-		// If this is a goal-like stat, decrement the appropriate team's score
-		if stat.Type == models.StatTypeGoal || stat.Type == models.StatTypePenalty || stat.Type == models.StatTypeOwnGoal {
-			var game models.Game
-			if err := db.First(&game, stat.GameID).Error; err == nil {
-				if stat.TeamID == game.HomeTeamID {
-					db.Model(&game).UpdateColumn("home_team_goals", gorm.Expr("home_team_goals - 1"))
-				} else if stat.TeamID == game.AwayTeamID {
-					db.Model(&game).UpdateColumn("away_team_goals", gorm.Expr("away_team_goals - 1"))
-				}
-			}
-			// Delete any assists linked to this goal
-			db.Where("goal_stat_id = ?", stat.ID).Delete(&models.GamePlayerStat{})
-		}
-
-		if err := db.Delete(&models.GamePlayerStat{}, id).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := svc.Stats.Delete(id); err != nil {
+			respondError(c, err)
 			return
 		}
 		c.Status(http.StatusOK)
@@ -4,148 +4,192 @@ import (
 	"net/http"
 
 	"github.com/yesakov/lukyasha-tracker/models"
+	"github.com/yesakov/lukyasha-tracker/services"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
-func CreateTeamHTMX(db *gorm.DB) gin.HandlerFunc {
+func CreateTeamHTMX(svc *services.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var team models.Team
 		if err := c.ShouldBind(&team); err != nil {
 			c.String(http.StatusBadRequest, "Invalid data")
 			return
 		}
-
-		if team.Name == "" || team.EventID == 0 {
-			c.String(http.StatusBadRequest, "Name and EventID required")
+		if err := svc.Teams.Create(&team); err != nil {
+			respondError(c, err)
 			return
 		}
-
-		// Check for existing
-		var existing models.Team
-		if err := db.Where("event_id = ? AND name = ?", team.EventID, team.Name).First(&existing).Error; err == nil {
-			c.String(http.StatusConflict, "Team already exists")
-			return
+		if team.Players == nil {
+			team.Players = []models.Player{} // empty unless copied from a club roster
 		}
 
-		db.Create(&team)
-		team.Players = []models.Player{} // empty
-
 		// Notify client to refresh team options via htmx event
 		c.Header("HX-Trigger", "team-added")
 		c.HTML(http.StatusOK, "team_card.html", team)
 	}
 }
 
-func DeleteTeam(db *gorm.DB) gin.HandlerFunc {
+func DeleteTeam(svc *services.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id := c.Param("id")
-
-		// Delete players first (foreign key)
-		db.Where("team_id = ?", id).Delete(&models.Player{})
-
-		// Delete team
-		if err := db.Delete(&models.Team{}, id).Error; err != nil {
-			c.String(http.StatusInternalServerError, "Delete error")
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
 			return
 		}
-
+		policy, err := deletePolicy(c)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		err = svc.Teams.Delete(id, policy)
+		if respondBlocked(c, err, "/teams/"+c.Param("id")) {
+			return
+		}
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if policy == services.DeleteCascade && isHTMX(c) {
+			// games and stats went too: the whole event page changed
+			c.Header("HX-Refresh", "true")
+		}
 		c.Status(http.StatusOK) // HTMX will remove the target from DOM
 	}
 }
 
-func CreateTeamJSON(db *gorm.DB) gin.HandlerFunc {
+func CreateTeamJSON(svc *services.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var team models.Team
 		if err := c.ShouldBindJSON(&team); err != nil {
-			c.JSON(400, gin.H{"error": err.Error()})
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-
-		if team.Name == "" || team.EventID == 0 {
-			c.JSON(400, gin.H{"error": "Name and EventID are required"})
+		if err := svc.Teams.Create(&team); err != nil {
+			respondError(c, err)
 			return
 		}
-
-		// Check for existing team in same event
-		var existing models.Team
-		if err := db.
-			Where("event_id = ? AND name = ?", team.EventID, team.Name).
-			First(&existing).Error; err == nil {
-			// Found duplicate
-			c.JSON(409, gin.H{"error": "Team with this name already exists in the event"})
-			return
-		}
-
-		// Create new team
-		if err := db.Create(&team).Error; err != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
-			return
-		}
-
-		db.First(&team, team.ID)
-		c.JSON(201, team)
+		c.JSON(http.StatusCreated, team)
 	}
 }
 
-func GetTeams(db *gorm.DB) gin.HandlerFunc {
+func GetTeams(svc *services.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var teams []models.Team
-		if err := db.Find(&teams).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		teams, err := svc.Teams.List()
+		if err != nil {
+			respondError(c, err)
 			return
 		}
 		c.JSON(http.StatusOK, teams)
 	}
 }
 
-func GetTeam(db *gorm.DB) gin.HandlerFunc {
+func GetTeam(svc *services.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var team models.Team
-		id := c.Param("id")
-		if err := db.First(&team, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		team, err := svc.Teams.Get(id)
+		if err != nil {
+			respondError(c, err)
 			return
 		}
 		c.JSON(http.StatusOK, team)
 	}
 }
 
-func CreateTeam(db *gorm.DB) gin.HandlerFunc {
+// UpdateTeam saves JSON changes on the API and the inline rename form on the
+// event page, which gets the team card back
+func UpdateTeam(svc *services.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var team models.Team
-		if err := c.ShouldBindJSON(&team); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
 			return
 		}
-		if err := db.Create(&team).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		var updated models.Team
+		if err := c.ShouldBind(&updated); err != nil {
+			if isAPI(c) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			} else {
+				c.String(http.StatusBadRequest, "Invalid data")
+			}
 			return
 		}
-		c.JSON(http.StatusCreated, team)
+		team, err := svc.Teams.Update(id, updated)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if isAPI(c) {
+			c.JSON(http.StatusOK, team)
+			return
+		}
+		renderTeamCard(c, svc, id)
 	}
 }
 
-func UpdateTeam(db *gorm.DB) gin.HandlerFunc {
+// ArrangeTeam saves a roster dragged into order (player_id repeated, top
+// first); players dropped in from other teams move to this one
+func ArrangeTeam(svc *services.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id := c.Param("id")
-		var existing models.Team
-		if err := db.First(&existing, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
 			return
 		}
-
-		var updated models.Team
-		if err := c.ShouldBindJSON(&updated); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		var in struct {
+			PlayerIDs []uint `form:"player_id"`
+		}
+		if err := c.ShouldBind(&in); err != nil {
+			c.String(http.StatusBadRequest, "Invalid data")
 			return
 		}
+		team, err := svc.Teams.Arrange(id, in.PlayerIDs)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.Header("HX-Trigger", toastTrigger("Roster saved"))
+		c.HTML(http.StatusOK, "team_card.html", team)
+	}
+}
 
-		if err := db.Model(&existing).Updates(updated).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+func renderTeamCard(c *gin.Context, svc *services.Services, id uint) {
+	team, err := svc.Teams.Roster(id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.HTML(http.StatusOK, "team_card.html", team)
+}
+
+// ShowTeam is the team dashboard: results, form, goals by period, scorers
+func ShowTeam(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		d, err := svc.Teams.Dashboard(id)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		rating, err := svc.Ratings.Team(id)
+		if err != nil {
+			respondError(c, err)
 			return
 		}
-		c.JSON(http.StatusOK, existing)
+		c.HTML(http.StatusOK, "team_detail.html", gin.H{
+			"Title":     d.Team.Name,
+			"Dash":      d,
+			"Rating":    rating,
+			"ActiveTab": "events",
+			"Content":   "content_team_detail",
+		})
 	}
 }
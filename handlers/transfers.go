@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yesakov/lukyasha-tracker/models"
+	"github.com/yesakov/lukyasha-tracker/services"
+)
+
+// CreateTransferHTMX records a transfer or guest appearance from the event
+// page. Team cards and stats change, so the page reloads.
+func CreateTransferHTMX(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var transfer models.Transfer
+		if err := c.ShouldBind(&transfer); err != nil {
+			c.String(http.StatusBadRequest, "Invalid data")
+			return
+		}
+		if err := svc.Transfers.Create(&transfer); err != nil {
+			respondError(c, err)
+			return
+		}
+		c.Header("HX-Refresh", "true")
+		c.Status(http.StatusOK)
+	}
+}
+
+func DeleteTransfer(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if _, err := svc.Transfers.Delete(id); err != nil {
+			respondError(c, err)
+			return
+		}
+		if isAPI(c) {
+			c.Status(http.StatusOK)
+			return
+		}
+		c.Header("HX-Refresh", "true")
+		c.Status(http.StatusOK)
+	}
+}
+
+// JSON API
+
+func GetEventTransfers(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := paramID(c, "id")
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if _, err := svc.Events.Get(id); err != nil {
+			respondError(c, err)
+			return
+		}
+		transfers, err := svc.Transfers.List(id)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, transfers)
+	}
+}
+
+func CreateTransferJSON(svc *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var transfer models.Transfer
+		if err := c.ShouldBindJSON(&transfer); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := svc.Transfers.Create(&transfer); err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, transfer)
+	}
+}
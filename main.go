@@ -2,38 +2,75 @@ package main
 
 import (
 	// "html/template"
+	"context"
+	"errors"
+	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	moderncSqlite "gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 
+	"github.com/yesakov/lukyasha-tracker/backup"
+	"github.com/yesakov/lukyasha-tracker/database"
 	"github.com/yesakov/lukyasha-tracker/handlers"
-	"github.com/yesakov/lukyasha-tracker/models"
-
-	_ "modernc.org/sqlite"
+	"github.com/yesakov/lukyasha-tracker/migrations"
+	"github.com/yesakov/lukyasha-tracker/services"
+	"github.com/yesakov/lukyasha-tracker/storage"
 )
 
 var DB *gorm.DB
 
+// defaultShutdownTimeout bounds how long in-flight requests may drain after SIGTERM
+const defaultShutdownTimeout = 15 * time.Second
+
 func InitDB() {
 	var err error
-	DB, err = gorm.Open(moderncSqlite.New(moderncSqlite.Config{
-		DSN:        "data.db",
-		DriverName: "sqlite",
-	}), &gorm.Config{})
-
+	cfg := database.ConfigFromEnv()
+	DB, err = database.Open(cfg)
 	if err != nil {
 		panic("failed to connect database: " + err.Error())
 	}
+	log.Printf("using %s database", cfg.Driver)
+}
 
-	// Ensure SQLite enforces foreign keys
-	DB.Exec("PRAGMA foreign_keys = ON;")
-
-	DB.AutoMigrate(&models.Event{}, &models.Game{}, &models.GamePlayerStat{}, &models.Player{}, &models.Team{})
+// migrateOnStart refuses to serve a schema from a newer build and applies
+// pending migrations unless AUTO_MIGRATE=false
+func migrateOnStart() {
+	m := migrations.New(DB)
+	if err := m.CheckCompatible(); err != nil {
+		log.Fatalf("refusing to start: %v", err)
+	}
+	if os.Getenv("AUTO_MIGRATE") == "false" {
+		if err := m.CheckReady(); err != nil {
+			log.Fatalf("refusing to start: %v (run `migrate up`)", err)
+		}
+		return
+	}
+	if err := m.Up(); err != nil {
+		log.Fatalf("migrate: %v", err)
+	}
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			InitDB()
+			os.Exit(runMigrate(os.Args[2:]))
+		case "backup":
+			os.Exit(runBackup(os.Args[2:]))
+		case "restore":
+			os.Exit(runRestore(os.Args[2:]))
+		}
+	}
+	serve()
+}
+
+func serve() {
 	r := gin.Default()
 
 	// Load HTML templates
@@ -43,6 +80,7 @@ func main() {
 	r.Static("/static", "static")
 
 	InitDB()
+	migrateOnStart()
 
 	r.GET("/", func(c *gin.Context) {
 		c.HTML(http.StatusOK, "home.html", gin.H{
@@ -52,26 +90,228 @@ func main() {
 		})
 	})
 
+	files := storage.New(storage.DirFromEnv())
+	r.Static(storage.URLPrefix, files.Dir)
+	svc := services.New(DB, files)
+	r.Use(handlers.LoadUser(svc))
+
 	r.GET("/events/new", handlers.NewEventForm())
-	r.GET("/events", handlers.ListEvents(DB))
-	r.GET("/events/:id", handlers.ShowEvent(DB))
-	r.GET("/events/:id/games_partial", handlers.EventGamesPartial(DB))
-	r.GET("/events/:id/stats_partial", handlers.EventStatsPartial(DB))
-	r.POST("/events", handlers.CreateEvent(DB))
-	r.GET("/events/:id/team_options", handlers.TeamOptions(DB))
-	r.DELETE("/events/:id", handlers.DeleteEvent(DB))
-
-	r.POST("/teams", handlers.CreateTeamHTMX(DB))
-	r.POST("/players", handlers.CreatePlayerHTMX(DB))
-	r.DELETE("/teams/:id", handlers.DeleteTeam(DB))
-	r.DELETE("/players/:id", handlers.DeletePlayer(DB))
+	r.GET("/events", handlers.ListEvents(svc))
+	r.GET("/events/:id", handlers.ShowEvent(svc))
+	r.GET("/events/:id/games_partial", handlers.EventGamesPartial(svc))
+	r.GET("/events/:id/stats_partial", handlers.EventStatsPartial(svc))
+	r.POST("/events", handlers.CreateEvent(svc))
+	r.GET("/events/:id/team_options", handlers.TeamOptions(svc))
+	r.GET("/events/:id/players/:playerId", handlers.ShowEventPlayer(svc))
+	r.DELETE("/events/:id", handlers.DeleteEvent(svc))
+	r.GET("/events/:id/draw", handlers.ShowDraw(svc))
+	r.POST("/events/:id/draw/preview", handlers.PreviewDraw(svc))
+	r.POST("/events/:id/draw", handlers.CommitDraw(svc))
+	r.POST("/pool", handlers.AddToPoolHTMX(svc))
+	r.PUT("/pool/:id", handlers.UpdatePoolPlayer(svc))
+	r.DELETE("/pool/:id", handlers.RemoveFromPool(svc))
+	r.GET("/events/:id/predictions", handlers.ShowPredictions(svc))
+	r.POST("/events/:id/predictions/rules", handlers.SetPredictionRules(svc))
+	r.GET("/events/:id/awards", handlers.ShowAwards(svc))
+	r.GET("/events/:id/awards/certificates", handlers.ShowCertificates(svc))
+	r.POST("/awards", handlers.AddAward(svc))
+	r.PUT("/awards/:id", handlers.UpdateAward(svc))
+	r.DELETE("/awards/:id", handlers.RemoveAward(svc))
+	r.GET("/awards/:id/certificate", handlers.ShowCertificate(svc))
+
+	r.POST("/teams", handlers.CreateTeamHTMX(svc))
+	r.GET("/teams/:id", handlers.ShowTeam(svc))
+	r.PUT("/teams/:id", handlers.UpdateTeam(svc))
+	r.POST("/teams/:id/roster", handlers.ArrangeTeam(svc))
+	r.POST("/players", handlers.CreatePlayerHTMX(svc))
+	r.DELETE("/teams/:id", handlers.DeleteTeam(svc))
+	r.POST("/players/:id", handlers.UpdatePlayerHTMX(svc))
+	r.PUT("/players/:id", handlers.UpdatePlayer(svc))
+	r.POST("/players/:id/armband", handlers.SetArmband(svc))
+	r.DELETE("/players/:id", handlers.DeletePlayer(svc))
+	r.POST("/transfers", handlers.CreateTransferHTMX(svc))
+	r.DELETE("/transfers/:id", handlers.DeleteTransfer(svc))
 
 	// Games and scoring
-	r.POST("/games", handlers.CreateGameForm(DB))
-	r.GET("/games/:id", handlers.ShowGame(DB))
-	r.DELETE("/games/:id", handlers.DeleteGame(DB))
-	r.POST("/games/:id/goals", handlers.AddGoalHTMX(DB))
-	r.DELETE("/stats/:id", handlers.DeleteStat(DB))
+	r.POST("/games", handlers.CreateGameForm(svc))
+	r.GET("/games/:id", handlers.ShowGame(svc))
+	r.DELETE("/games/:id", handlers.DeleteGame(svc))
+	r.POST("/games/:id/status", handlers.SetGameStatus(svc))
+	r.POST("/games/:id/kickoff", handlers.SetKickoff(svc))
+	r.POST("/games/:id/prediction", handlers.PredictHTMX(svc))
+	r.POST("/games/:id/mvp", handlers.VoteMVP(svc))
+	r.POST("/games/:id/goals", handlers.AddGoalHTMX(svc))
+	r.POST("/games/:id/cards", handlers.AddCardHTMX(svc))
+	r.POST("/games/:id/penalties", handlers.AddMissedPenaltyHTMX(svc))
+	r.POST("/games/:id/saves", handlers.AddSaveHTMX(svc))
+	r.POST("/games/:id/goalkeepers", handlers.AssignGoalkeeperHTMX(svc))
+	r.DELETE("/goalkeepers/:id", handlers.UnassignGoalkeeper(svc))
+	r.DELETE("/stats/:id", handlers.DeleteStat(svc))
+
+	// Clubs persist across events
+	r.GET("/clubs", handlers.ListClubs(svc))
+	r.POST("/clubs", handlers.CreateClubHTMX(svc))
+	r.GET("/clubs/:id", handlers.ShowClub(svc))
+	r.POST("/clubs/:id", handlers.UpdateClubHTMX(svc))
+	r.DELETE("/clubs/:id", handlers.DeleteClub(svc))
+	r.POST("/clubs/:id/roster", handlers.AddClubMember(svc))
+	r.DELETE("/clubs/:id/roster/:personId", handlers.RemoveClubMember(svc))
+
+	// Seasons group events into a league
+	r.GET("/seasons", handlers.ListSeasons(svc))
+	r.POST("/seasons", handlers.CreateSeasonHTMX(svc))
+	r.GET("/seasons/:id", handlers.ShowSeason(svc))
+	r.DELETE("/seasons/:id", handlers.DeleteSeason(svc))
+	r.POST("/seasons/:id/events", handlers.AddSeasonEvent(svc))
+	r.DELETE("/seasons/:id/events/:eventId", handlers.RemoveSeasonEvent(svc))
+
+	// Head-to-head comparisons
+	r.GET("/compare", func(c *gin.Context) { c.Redirect(http.StatusFound, "/compare/teams") })
+	r.GET("/compare/teams", handlers.CompareTeamsPage(svc))
+	r.GET("/compare/players", handlers.ComparePlayersPage(svc))
+
+	// People across events
+	r.GET("/people", handlers.ListPeople(svc))
+	r.GET("/people/duplicates", handlers.PeopleDuplicates(svc))
+	r.POST("/people/merge", handlers.MergePeopleHTMX(svc))
+	r.GET("/people/:id", handlers.ShowPerson(svc))
+
+	// Prediction league accounts
+	r.GET("/login", handlers.ShowLogin())
+	r.POST("/login", handlers.Login(svc))
+	r.POST("/register", handlers.Register(svc))
+	r.POST("/logout", handlers.Logout(svc))
 
-	r.Run(":8080")
+	// JSON API
+	api := r.Group("/api")
+	api.POST("/register", handlers.RegisterJSON(svc))
+	api.POST("/login", handlers.LoginJSON(svc))
+	api.POST("/logout", handlers.Logout(svc))
+	api.GET("/events", handlers.GetEvents(svc))
+	api.POST("/events", handlers.CreateEventJSON(svc))
+	api.GET("/events/:id", handlers.GetEvent(svc))
+	api.GET("/events/:id/records", handlers.GetEventRecords(svc))
+	api.GET("/events/:id/transfers", handlers.GetEventTransfers(svc))
+	api.GET("/events/:id/pool", handlers.GetEventPool(svc))
+	api.POST("/events/:id/draw", handlers.DrawJSON(svc))
+	api.POST("/events/:id/draw/commit", handlers.CommitDrawJSON(svc))
+	api.PUT("/events/:id", handlers.UpdateEvent(svc))
+	api.DELETE("/events/:id", handlers.DeleteEvent(svc))
+	api.GET("/teams", handlers.GetTeams(svc))
+	api.POST("/teams", handlers.CreateTeamJSON(svc))
+	api.GET("/teams/:id", handlers.GetTeam(svc))
+	api.PUT("/teams/:id", handlers.UpdateTeam(svc))
+	api.DELETE("/teams/:id", handlers.DeleteTeam(svc))
+	api.GET("/players", handlers.GetPlayers(svc))
+	api.POST("/players", handlers.CreatePlayerJSON(svc))
+	api.GET("/players/:id", handlers.GetPlayer(svc))
+	api.PUT("/players/:id", handlers.UpdatePlayer(svc))
+	api.DELETE("/players/:id", handlers.DeletePlayer(svc))
+	api.POST("/transfers", handlers.CreateTransferJSON(svc))
+	api.DELETE("/transfers/:id", handlers.DeleteTransfer(svc))
+	api.POST("/pool", handlers.AddToPoolJSON(svc))
+	api.PUT("/pool/:id", handlers.UpdatePoolPlayer(svc))
+	api.DELETE("/pool/:id", handlers.RemoveFromPool(svc))
+	api.GET("/games", handlers.GetGames(svc))
+	api.POST("/games", handlers.CreateGame(svc))
+	api.GET("/games/:id", handlers.GetGame(svc))
+	api.PUT("/games/:id", handlers.UpdateGame(svc))
+	api.DELETE("/games/:id", handlers.DeleteGame(svc))
+	api.GET("/games/:id/odds", handlers.GetGameOdds(svc))
+	api.PUT("/games/:id/prediction", handlers.PredictJSON(svc))
+	api.GET("/games/:id/mvp", handlers.GetGameMVP(svc))
+	api.POST("/games/:id/mvp", handlers.VoteMVP(svc))
+	api.GET("/events/:id/mvp", handlers.GetEventMVP(svc))
+	api.GET("/events/:id/predictions", handlers.GetEventPredictions(svc))
+	api.PUT("/events/:id/predictions/rules", handlers.SetPredictionRules(svc))
+	api.GET("/events/:id/awards", handlers.GetEventAwards(svc))
+	api.POST("/awards", handlers.AddAward(svc))
+	api.PUT("/awards/:id", handlers.UpdateAward(svc))
+	api.DELETE("/awards/:id", handlers.RemoveAward(svc))
+	api.GET("/stats", handlers.GetStats(svc))
+	api.POST("/stats", handlers.CreateStat(svc))
+	api.GET("/stats/:id", handlers.GetStat(svc))
+	api.PUT("/stats/:id", handlers.UpdateStat(svc))
+	api.DELETE("/stats/:id", handlers.DeleteStat(svc))
+	api.GET("/clubs", handlers.GetClubs(svc))
+	api.POST("/clubs", handlers.CreateClubJSON(svc))
+	api.GET("/clubs/:id", handlers.GetClub(svc))
+	api.PUT("/clubs/:id", handlers.UpdateClub(svc))
+	api.DELETE("/clubs/:id", handlers.DeleteClub(svc))
+	api.GET("/seasons", handlers.GetSeasons(svc))
+	api.POST("/seasons", handlers.CreateSeasonJSON(svc))
+	api.GET("/seasons/:id", handlers.GetSeason(svc))
+	api.PUT("/seasons/:id", handlers.UpdateSeason(svc))
+	api.DELETE("/seasons/:id", handlers.DeleteSeason(svc))
+	api.GET("/compare/teams", handlers.CompareTeams(svc))
+	api.GET("/compare/players", handlers.ComparePlayers(svc))
+	api.GET("/people", handlers.GetPeople(svc))
+	api.GET("/people/:id", handlers.GetPerson(svc))
+	api.GET("/people/:id/rating", handlers.GetPersonRating(svc))
+	api.POST("/people/merge", handlers.MergePeople(svc))
+
+	// Probes for container orchestration
+	r.GET("/healthz", handlers.Healthz())
+	r.GET("/readyz", handlers.Readyz(DB))
+
+	// Admin (bearer token from ADMIN_TOKEN)
+	backupCfg := backup.ConfigFromEnv()
+	admin := r.Group("/admin", handlers.RequireAdminToken(os.Getenv("ADMIN_TOKEN")))
+	admin.POST("/backups", handlers.CreateBackup(DB, backupCfg))
+	admin.GET("/backups", handlers.ListBackups(backupCfg))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go backup.Schedule(ctx, DB, backupCfg)
+
+	srv := &http.Server{
+		Addr:              listenAddr(),
+		Handler:           r,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		log.Printf("listening on %s", srv.Addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("listen: %v", err)
+		}
+	}()
+
+	// Wait for SIGINT/SIGTERM, then stop accepting connections and let
+	// in-flight requests (and their SQLite writes) finish
+	<-ctx.Done()
+	stop()
+
+	timeout := shutdownTimeout()
+	log.Printf("shutting down, draining for up to %s", timeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("forced shutdown: %v", err)
+	}
+
+	if sqlDB, err := DB.DB(); err == nil {
+		sqlDB.Close()
+	}
+	log.Println("server stopped")
+}
+
+// listenAddr returns the address to bind, honouring PORT when set
+func listenAddr() string {
+	if port := os.Getenv("PORT"); port != "" {
+		return ":" + port
+	}
+	return ":8080"
+}
+
+// shutdownTimeout reads SHUTDOWN_TIMEOUT (e.g. "30s") with a sane default
+func shutdownTimeout() time.Duration {
+	if v := os.Getenv("SHUTDOWN_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+		log.Printf("invalid SHUTDOWN_TIMEOUT %q, using %s", v, defaultShutdownTimeout)
+	}
+	return defaultShutdownTimeout
 }
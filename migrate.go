@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/yesakov/lukyasha-tracker/migrations"
+)
+
+const migrateUsage = `usage: lukyasha-tracker migrate <command>
+
+commands:
+  status        list migrations and whether they are applied
+  up            apply all pending migrations
+  down          revert the most recent migration
+  to <version>  migrate up or down to exactly <version> (0 reverts everything)`
+
+// runMigrate implements the `migrate` subcommand and returns the exit code
+func runMigrate(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	m := migrations.New(DB)
+
+	var err error
+	switch args[0] {
+	case "status":
+		err = printMigrationStatus(m)
+	case "up":
+		err = m.Up()
+	case "down":
+		err = m.Down()
+	case "to":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+		v, convErr := strconv.Atoi(args[1])
+		if convErr != nil {
+			fmt.Fprintf(os.Stderr, "invalid version %q\n", args[1])
+			return 2
+		}
+		err = m.To(v)
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		return 1
+	}
+
+	if args[0] != "status" {
+		cur, _ := m.Current()
+		fmt.Printf("schema at version %d (latest %d)\n", cur, migrations.Latest())
+	}
+	return 0
+}
+
+func printMigrationStatus(m *migrations.Migrator) error {
+	rows, err := m.Status()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, r := range rows {
+		applied := "pending"
+		if r.AppliedAt != nil {
+			applied = r.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", r.Version, r.Name, applied)
+	}
+	return w.Flush()
+}
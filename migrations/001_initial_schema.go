@@ -0,0 +1,71 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// The initial schema is a snapshot of the models as they were when
+// AutoMigrate was retired. Databases created by AutoMigrate already have
+// these tables, so existing tables are left untouched.
+func init() {
+	type Event struct {
+		gorm.Model
+		Name     string `gorm:"not null"`
+		Date     string `gorm:"not null"`
+		EventURL string `gorm:"not null"`
+	}
+	type Player struct {
+		gorm.Model
+		Name   string `gorm:"not null"`
+		TeamID uint   `gorm:"not null"`
+	}
+	type Team struct {
+		gorm.Model
+		Name    string   `gorm:"not null"`
+		EventID uint     `gorm:"not null"`
+		Players []Player `gorm:"constraint:OnDelete:CASCADE;"`
+	}
+	type Game struct {
+		gorm.Model
+		EventID       uint `gorm:"not null;index"`
+		HomeTeamID    uint `gorm:"not null;index"`
+		AwayTeamID    uint `gorm:"not null;index"`
+		HomeTeamGoals int
+		AwayTeamGoals int
+	}
+	type GamePlayerStat struct {
+		gorm.Model
+		PlayerID   uint   `gorm:"not null;index"`
+		GameID     uint   `gorm:"not null;index"`
+		TeamID     uint   `gorm:"not null;index"`
+		Type       string `gorm:"not null;index"`
+		Minute     int    `gorm:"index"`
+		GoalStatID *uint  `gorm:"index"`
+	}
+
+	tables := []interface{}{&Event{}, &Team{}, &Player{}, &Game{}, &GamePlayerStat{}}
+
+	register(Migration{
+		Version: 1,
+		Name:    "initial_schema",
+		Up: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			for _, t := range tables {
+				if m.HasTable(t) {
+					continue
+				}
+				if err := m.CreateTable(t); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			for i := len(tables) - 1; i >= 0; i-- {
+				if err := m.DropTable(tables[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
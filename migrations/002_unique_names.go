@@ -0,0 +1,76 @@
+package migrations
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// AutoMigrate never managed to create the unique name indexes on databases
+// that already held duplicates, and soft-deleted rows would have blocked
+// reusing a name anyway. This step creates partial unique indexes that ignore
+// soft-deleted rows. Live duplicates are not renamed behind the user's back:
+// the step fails and lists them, so they can be renamed or deleted first.
+func init() {
+	// duplicates describes every live name used more than once under one parent
+	duplicates := func(tx *gorm.DB, table, parentCol, parent string) ([]string, error) {
+		var rows []struct {
+			Parent uint
+			Name   string
+			N      int
+		}
+		err := tx.Table(table).
+			Select(parentCol + " AS parent, name, COUNT(*) AS n").
+			Where("deleted_at IS NULL").
+			Group(parentCol + ", name").
+			Having("COUNT(*) > 1").
+			Order(parentCol + " ASC, name ASC").
+			Scan(&rows).Error
+		out := make([]string, 0, len(rows))
+		for _, r := range rows {
+			out = append(out, fmt.Sprintf("%s %d has %d %s named %q", parent, r.Parent, r.N, table, r.Name))
+		}
+		return out, err
+	}
+
+	register(Migration{
+		Version: 2,
+		Name:    "unique_team_and_player_names",
+		Up: func(tx *gorm.DB) error {
+			teams, err := duplicates(tx, "teams", "event_id", "event")
+			if err != nil {
+				return err
+			}
+			players, err := duplicates(tx, "players", "team_id", "team")
+			if err != nil {
+				return err
+			}
+			if dups := append(teams, players...); len(dups) > 0 {
+				return fmt.Errorf("rename or delete the duplicate names first: %s", strings.Join(dups, "; "))
+			}
+			for _, stmt := range []string{
+				"DROP INDEX IF EXISTS idx_team_event_name",
+				"DROP INDEX IF EXISTS idx_player_team_name",
+				"CREATE UNIQUE INDEX idx_team_event_name ON teams (event_id, name) WHERE deleted_at IS NULL",
+				"CREATE UNIQUE INDEX idx_player_team_name ON players (team_id, name) WHERE deleted_at IS NULL",
+			} {
+				if err := tx.Exec(stmt).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, stmt := range []string{
+				"DROP INDEX IF EXISTS idx_team_event_name",
+				"DROP INDEX IF EXISTS idx_player_team_name",
+			} {
+				if err := tx.Exec(stmt).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,65 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// Players are per-team roster entries, so the same person in two events is
+// two unrelated rows. This step adds a global people table and links every
+// existing player (soft-deleted ones too, their stats still count) to a
+// person of its own. Duplicates are merged afterwards with the merge tool.
+func init() {
+	type Person struct {
+		gorm.Model
+		Name string `gorm:"not null;index"`
+	}
+	type Player struct {
+		gorm.Model
+		Name     string `gorm:"not null"`
+		TeamID   uint   `gorm:"not null"`
+		PersonID *uint  `gorm:"index"`
+	}
+
+	register(Migration{
+		Version: 3,
+		Name:    "people",
+		Up: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if err := m.CreateTable(&Person{}); err != nil {
+				return err
+			}
+			if err := m.AddColumn(&Player{}, "PersonID"); err != nil {
+				return err
+			}
+			if err := m.CreateIndex(&Player{}, "PersonID"); err != nil {
+				return err
+			}
+			var players []Player
+			if err := tx.Unscoped().Order("id ASC").Find(&players).Error; err != nil {
+				return err
+			}
+			for _, p := range players {
+				person := Person{Name: p.Name}
+				person.CreatedAt = p.CreatedAt
+				if err := tx.Create(&person).Error; err != nil {
+					return err
+				}
+				if err := tx.Unscoped().Model(&Player{}).Where("id = ?", p.ID).
+					UpdateColumn("person_id", person.ID).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if err := m.DropIndex(&Player{}, "PersonID"); err != nil {
+				return err
+			}
+			// Plain DROP COLUMN: the sqlite migrator would rebuild the table
+			// and lose the other indexes on players
+			if err := tx.Exec("ALTER TABLE players DROP COLUMN person_id").Error; err != nil {
+				return err
+			}
+			return m.DropTable(&Person{})
+		},
+	})
+}
@@ -0,0 +1,55 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// Clubs persist across events: event teams may point at the club they were
+// created from, and a club keeps a default roster of people.
+func init() {
+	type Club struct {
+		gorm.Model
+		Name           string `gorm:"not null"`
+		ShortName      string
+		PrimaryColor   string
+		SecondaryColor string
+		Crest          string
+	}
+	type ClubMember struct {
+		ClubID   uint `gorm:"primaryKey"`
+		PersonID uint `gorm:"primaryKey"`
+	}
+	type Team struct {
+		gorm.Model
+		Name    string `gorm:"not null"`
+		EventID uint   `gorm:"not null"`
+		ClubID  *uint  `gorm:"index"`
+	}
+
+	register(Migration{
+		Version: 4,
+		Name:    "clubs",
+		Up: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if err := m.CreateTable(&Club{}, &ClubMember{}); err != nil {
+				return err
+			}
+			if err := tx.Exec("CREATE UNIQUE INDEX idx_club_name ON clubs (name) WHERE deleted_at IS NULL").Error; err != nil {
+				return err
+			}
+			if err := m.AddColumn(&Team{}, "ClubID"); err != nil {
+				return err
+			}
+			return m.CreateIndex(&Team{}, "ClubID")
+		},
+		Down: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if err := m.DropIndex(&Team{}, "ClubID"); err != nil {
+				return err
+			}
+			// Plain DROP COLUMN keeps the other indexes on teams (see 003)
+			if err := tx.Exec("ALTER TABLE teams DROP COLUMN club_id").Error; err != nil {
+				return err
+			}
+			return m.DropTable(&ClubMember{}, &Club{})
+		},
+	})
+}
@@ -0,0 +1,44 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// Seasons group events; an event points at the season it is a matchday of.
+func init() {
+	type Season struct {
+		gorm.Model
+		Name string `gorm:"not null"`
+	}
+	type Event struct {
+		gorm.Model
+		Name     string `gorm:"not null"`
+		Date     string `gorm:"not null"`
+		EventURL string `gorm:"not null"`
+		SeasonID *uint  `gorm:"index"`
+	}
+
+	register(Migration{
+		Version: 5,
+		Name:    "seasons",
+		Up: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if err := m.CreateTable(&Season{}); err != nil {
+				return err
+			}
+			if err := m.AddColumn(&Event{}, "SeasonID"); err != nil {
+				return err
+			}
+			return m.CreateIndex(&Event{}, "SeasonID")
+		},
+		Down: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if err := m.DropIndex(&Event{}, "SeasonID"); err != nil {
+				return err
+			}
+			// Plain DROP COLUMN keeps the other indexes on events (see 003)
+			if err := tx.Exec("ALTER TABLE events DROP COLUMN season_id").Error; err != nil {
+				return err
+			}
+			return m.DropTable(&Season{})
+		},
+	})
+}
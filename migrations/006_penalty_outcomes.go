@@ -0,0 +1,37 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// Missed and saved penalties record the goalkeeper they were taken against.
+func init() {
+	type GamePlayerStat struct {
+		gorm.Model
+		PlayerID     uint   `gorm:"not null;index"`
+		GameID       uint   `gorm:"not null;index"`
+		TeamID       uint   `gorm:"not null;index"`
+		Type         string `gorm:"not null;index"`
+		Minute       int    `gorm:"index"`
+		GoalStatID   *uint  `gorm:"index"`
+		GoalkeeperID *uint  `gorm:"index"`
+	}
+
+	register(Migration{
+		Version: 6,
+		Name:    "penalty_outcomes",
+		Up: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if err := m.AddColumn(&GamePlayerStat{}, "GoalkeeperID"); err != nil {
+				return err
+			}
+			return m.CreateIndex(&GamePlayerStat{}, "GoalkeeperID")
+		},
+		Down: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if err := m.DropIndex(&GamePlayerStat{}, "GoalkeeperID"); err != nil {
+				return err
+			}
+			// Plain DROP COLUMN keeps the other indexes (see 003)
+			return tx.Exec("ALTER TABLE game_player_stats DROP COLUMN goalkeeper_id").Error
+		},
+	})
+}
@@ -0,0 +1,30 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// Goalkeeper spells per game and team; a team has one goalkeeper per
+// starting minute.
+func init() {
+	type GameGoalkeeper struct {
+		gorm.Model
+		GameID     uint `gorm:"not null;index"`
+		TeamID     uint `gorm:"not null;index"`
+		PlayerID   uint `gorm:"not null;index"`
+		FromMinute int
+	}
+
+	register(Migration{
+		Version: 7,
+		Name:    "goalkeepers",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().CreateTable(&GameGoalkeeper{}); err != nil {
+				return err
+			}
+			return tx.Exec(`CREATE UNIQUE INDEX idx_game_goalkeeper_spell
+				ON game_goalkeepers (game_id, team_id, from_minute) WHERE deleted_at IS NULL`).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&GameGoalkeeper{})
+		},
+	})
+}
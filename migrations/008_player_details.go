@@ -0,0 +1,47 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// Shirt numbers, positions, preferred foot and photos for players; a number
+// is unique within a team.
+func init() {
+	type Player struct {
+		gorm.Model
+		Name          string `gorm:"not null"`
+		TeamID        uint   `gorm:"not null"`
+		PersonID      *uint  `gorm:"index"`
+		Number        *int
+		Position      string
+		PreferredFoot string
+		Photo         string
+		PhotoThumb    string
+	}
+	columns := []string{"Number", "Position", "PreferredFoot", "Photo", "PhotoThumb"}
+
+	register(Migration{
+		Version: 8,
+		Name:    "player_details",
+		Up: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			for _, col := range columns {
+				if err := m.AddColumn(&Player{}, col); err != nil {
+					return err
+				}
+			}
+			return tx.Exec(`CREATE UNIQUE INDEX idx_player_team_number
+				ON players (team_id, number) WHERE deleted_at IS NULL AND number IS NOT NULL`).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Exec("DROP INDEX idx_player_team_number").Error; err != nil {
+				return err
+			}
+			// Plain DROP COLUMN keeps the other indexes (see 003)
+			for _, col := range []string{"number", "position", "preferred_foot", "photo", "photo_thumb"} {
+				if err := tx.Exec("ALTER TABLE players DROP COLUMN " + col).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
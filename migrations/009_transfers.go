@@ -0,0 +1,26 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// Transfers and guest appearances of players between the teams of an event.
+func init() {
+	type Transfer struct {
+		gorm.Model
+		PlayerID   uint `gorm:"not null;index"`
+		FromTeamID uint `gorm:"not null"`
+		ToTeamID   uint `gorm:"not null"`
+		GameID     uint `gorm:"not null;index"`
+		Guest      bool
+	}
+
+	register(Migration{
+		Version: 9,
+		Name:    "transfers",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&Transfer{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&Transfer{})
+		},
+	})
+}
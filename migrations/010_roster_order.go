@@ -0,0 +1,31 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// Roster order and captain/vice-captain armbands for players.
+func init() {
+	type Player struct {
+		gorm.Model
+		SortOrder int    `gorm:"not null;default:0"`
+		Armband   string `gorm:"not null;default:''"`
+	}
+
+	register(Migration{
+		Version: 10,
+		Name:    "roster_order",
+		Up: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if err := m.AddColumn(&Player{}, "SortOrder"); err != nil {
+				return err
+			}
+			return m.AddColumn(&Player{}, "Armband")
+		},
+		Down: func(tx *gorm.DB) error {
+			// Plain DROP COLUMN keeps the other indexes (see 003)
+			if err := tx.Exec("ALTER TABLE players DROP COLUMN sort_order").Error; err != nil {
+				return err
+			}
+			return tx.Exec("ALTER TABLE players DROP COLUMN armband").Error
+		},
+	})
+}
@@ -0,0 +1,150 @@
+package migrations
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yesakov/lukyasha-tracker/database"
+	"gorm.io/gorm"
+)
+
+// Stats and games only pointed at their players, teams and games by ID, so
+// nothing stopped a reference to a row that was never there. This step adds
+// real foreign keys: a stat or game can't point at a missing row. Their ON
+// DELETE actions only fire when a row is removed for good; the app
+// soft-deletes, so restricting, cascading and anonymizing are up to the
+// services. SQLite can't add a constraint to an existing table, so there the
+// tables are rebuilt with their rows, indexes and id sequence.
+func init() {
+	type foreignKey struct {
+		table, name, column, ref, onDelete string
+	}
+	// games come first: the stats table references it once rebuilt
+	keys := []foreignKey{
+		{"games", "fk_games_home_team", "home_team_id", "teams", "RESTRICT"},
+		{"games", "fk_games_away_team", "away_team_id", "teams", "RESTRICT"},
+		{"game_player_stats", "fk_game_player_stats_game", "game_id", "games", "CASCADE"},
+		{"game_player_stats", "fk_game_player_stats_player", "player_id", "players", "RESTRICT"},
+		{"game_player_stats", "fk_game_player_stats_team", "team_id", "teams", "RESTRICT"},
+	}
+	tables := []string{"games", "game_player_stats"}
+
+	clauses := func(table string) string {
+		var b strings.Builder
+		for _, k := range keys {
+			if k.table == table {
+				fmt.Fprintf(&b, ",CONSTRAINT `%s` FOREIGN KEY (`%s`) REFERENCES `%s`(`id`) ON DELETE %s",
+					k.name, k.column, k.ref, k.onDelete)
+			}
+		}
+		return b.String()
+	}
+
+	// rebuild recreates an sqlite table from its edited definition
+	rebuild := func(tx *gorm.DB, table string, edit func(ddl string) string) error {
+		var ddl string
+		if err := tx.Raw("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", table).
+			Scan(&ddl).Error; err != nil {
+			return err
+		}
+		var indexes []string
+		if err := tx.Raw("SELECT sql FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL", table).
+			Scan(&indexes).Error; err != nil {
+			return err
+		}
+		var seq int64
+		if err := tx.Raw("SELECT COALESCE(MAX(seq), 0) FROM sqlite_sequence WHERE name = ?", table).
+			Scan(&seq).Error; err != nil {
+			return err
+		}
+		tmp := table + "__fk"
+		// SQLite quotes a renamed table's name differently, so replace the
+		// whole head up to the column list
+		ddl = edit(ddl)
+		ddl = fmt.Sprintf("CREATE TABLE `%s` ", tmp) + ddl[strings.Index(ddl, "("):]
+		stmts := []string{
+			ddl,
+			fmt.Sprintf("INSERT INTO `%s` SELECT * FROM `%s`", tmp, table),
+			fmt.Sprintf("DROP TABLE `%s`", table),
+			fmt.Sprintf("ALTER TABLE `%s` RENAME TO `%s`", tmp, table),
+		}
+		for _, sql := range append(stmts, indexes...) {
+			if err := tx.Exec(sql).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Exec("UPDATE sqlite_sequence SET seq = ? WHERE name = ? AND seq < ?", seq, table, seq).Error
+	}
+
+	// orphans counts rows the new keys would reject; stats of missing games
+	// are dropped as the cascade would have done
+	orphans := func(tx *gorm.DB) error {
+		if err := tx.Exec(`DELETE FROM game_player_stats
+			WHERE NOT EXISTS (SELECT 1 FROM games WHERE games.id = game_player_stats.game_id)`).Error; err != nil {
+			return err
+		}
+		for _, k := range keys {
+			var n int64
+			if err := tx.Table(k.table).
+				Where(fmt.Sprintf("NOT EXISTS (SELECT 1 FROM %s WHERE %s.id = %s.%s)", k.ref, k.ref, k.table, k.column)).
+				Count(&n).Error; err != nil {
+				return err
+			}
+			if n > 0 {
+				return fmt.Errorf("%d %s rows reference missing %s (%s); fix them before migrating", n, k.table, k.ref, k.column)
+			}
+		}
+		return nil
+	}
+
+	register(Migration{
+		Version: 11,
+		Name:    "foreign_keys",
+		Up: func(tx *gorm.DB) error {
+			if err := orphans(tx); err != nil {
+				return err
+			}
+			if tx.Dialector.Name() == database.DriverPostgres {
+				for _, k := range keys {
+					if err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s(id) ON DELETE %s",
+						k.table, k.name, k.column, k.ref, k.onDelete)).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			for _, table := range tables {
+				extra := clauses(table)
+				err := rebuild(tx, table, func(ddl string) string {
+					i := strings.LastIndex(ddl, ")")
+					return ddl[:i] + extra + ddl[i:]
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			if tx.Dialector.Name() == database.DriverPostgres {
+				for i := len(keys) - 1; i >= 0; i-- {
+					k := keys[i]
+					if err := tx.Exec(fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", k.table, k.name)).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			for i := len(tables) - 1; i >= 0; i-- {
+				extra := clauses(tables[i])
+				err := rebuild(tx, tables[i], func(ddl string) string {
+					return strings.Replace(ddl, extra, "", 1)
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
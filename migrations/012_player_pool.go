@@ -0,0 +1,31 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// The player pool an event's teams are drawn from. Names are unique among an
+// event's live pool entries (see 002).
+func init() {
+	type PoolPlayer struct {
+		gorm.Model
+		EventID  uint   `gorm:"not null;index"`
+		PersonID *uint  `gorm:"index"`
+		Name     string `gorm:"not null"`
+		Skill    int    `gorm:"not null;default:5"`
+		Position string
+	}
+
+	register(Migration{
+		Version: 12,
+		Name:    "player_pool",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().CreateTable(&PoolPlayer{}); err != nil {
+				return err
+			}
+			return tx.Exec(`CREATE UNIQUE INDEX idx_pool_player_event_name ON pool_players (event_id, name)
+				WHERE deleted_at IS NULL`).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&PoolPlayer{})
+		},
+	})
+}
@@ -0,0 +1,27 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// Games get a status. Every existing game was played already, so they start
+// out finished; new games are scheduled until someone finishes them.
+func init() {
+	type Game struct {
+		gorm.Model
+		Status string `gorm:"not null;default:'scheduled'"`
+	}
+
+	register(Migration{
+		Version: 13,
+		Name:    "game_status",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().AddColumn(&Game{}, "Status"); err != nil {
+				return err
+			}
+			return tx.Exec("UPDATE games SET status = 'finished'").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			// Plain DROP COLUMN keeps the other indexes (see 003)
+			return tx.Exec("ALTER TABLE games DROP COLUMN status").Error
+		},
+	})
+}
@@ -0,0 +1,82 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// The prediction league: spectator accounts with their sessions, scoreline
+// tips for games, kick-off times and each event's scoring rules. User names
+// and one tip per user and game are unique among live rows (see 002).
+func init() {
+	type Event struct {
+		gorm.Model
+		PredictExact    int `gorm:"not null;default:5"`
+		PredictGoalDiff int `gorm:"not null;default:3"`
+		PredictOutcome  int `gorm:"not null;default:2"`
+	}
+	type Game struct {
+		gorm.Model
+		KickoffAt *time.Time
+	}
+	type User struct {
+		gorm.Model
+		Name         string `gorm:"not null"`
+		PasswordHash string `gorm:"not null"`
+	}
+	type Session struct {
+		ID        uint `gorm:"primarykey"`
+		CreatedAt time.Time
+		UserID    uint      `gorm:"not null;index"`
+		TokenHash string    `gorm:"not null;uniqueIndex"`
+		ExpiresAt time.Time `gorm:"not null"`
+	}
+	type Prediction struct {
+		gorm.Model
+		GameID    uint `gorm:"not null;index"`
+		UserID    uint `gorm:"not null;index"`
+		HomeGoals int
+		AwayGoals int
+	}
+
+	register(Migration{
+		Version: 14,
+		Name:    "predictions",
+		Up: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			for _, col := range []string{"PredictExact", "PredictGoalDiff", "PredictOutcome"} {
+				if err := m.AddColumn(&Event{}, col); err != nil {
+					return err
+				}
+			}
+			if err := m.AddColumn(&Game{}, "KickoffAt"); err != nil {
+				return err
+			}
+			if err := m.CreateTable(&User{}, &Session{}, &Prediction{}); err != nil {
+				return err
+			}
+			if err := tx.Exec(`CREATE UNIQUE INDEX idx_user_name ON users (name)
+				WHERE deleted_at IS NULL`).Error; err != nil {
+				return err
+			}
+			return tx.Exec(`CREATE UNIQUE INDEX idx_prediction_game_user ON predictions (game_id, user_id)
+				WHERE deleted_at IS NULL`).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&Prediction{}, &Session{}, &User{}); err != nil {
+				return err
+			}
+			// Plain DROP COLUMN keeps the other indexes (see 003)
+			if err := tx.Exec("ALTER TABLE games DROP COLUMN kickoff_at").Error; err != nil {
+				return err
+			}
+			for _, col := range []string{"predict_exact", "predict_goal_diff", "predict_outcome"} {
+				if err := tx.Exec("ALTER TABLE events DROP COLUMN " + col).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,50 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Player of the match voting. Each game takes one vote per user and one per
+// device among live votes of visitors without an account (see 002); voting
+// closes at the game's mvp_closes_at.
+func init() {
+	type Game struct {
+		gorm.Model
+		MVPClosesAt *time.Time
+	}
+	type MVPVote struct {
+		gorm.Model
+		GameID   uint  `gorm:"not null;index"`
+		PlayerID uint  `gorm:"not null;index"`
+		UserID   *uint `gorm:"index"`
+		Device   string
+	}
+
+	register(Migration{
+		Version: 15,
+		Name:    "mvp_votes",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().AddColumn(&Game{}, "MVPClosesAt"); err != nil {
+				return err
+			}
+			if err := tx.Migrator().CreateTable(&MVPVote{}); err != nil {
+				return err
+			}
+			if err := tx.Exec(`CREATE UNIQUE INDEX idx_mvp_vote_game_user ON mvp_votes (game_id, user_id)
+				WHERE deleted_at IS NULL AND user_id IS NOT NULL`).Error; err != nil {
+				return err
+			}
+			return tx.Exec(`CREATE UNIQUE INDEX idx_mvp_vote_game_device ON mvp_votes (game_id, device)
+				WHERE deleted_at IS NULL AND user_id IS NULL AND device <> ''`).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&MVPVote{}); err != nil {
+				return err
+			}
+			// Plain DROP COLUMN keeps the other indexes (see 003)
+			return tx.Exec("ALTER TABLE games DROP COLUMN mvp_closes_at").Error
+		},
+	})
+}
@@ -0,0 +1,53 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// Event awards. Every live event gets the default set the app gives new
+// events, so the awards page works for past events too.
+func init() {
+	type Award struct {
+		gorm.Model
+		EventID   uint   `gorm:"not null;index"`
+		Kind      string `gorm:"not null"`
+		Title     string `gorm:"not null"`
+		Citation  string
+		MinGames  int
+		SortOrder int
+	}
+	defaults := []Award{
+		{Kind: "champion", Title: "Champions", Citation: "Winners of the tournament"},
+		{Kind: "golden_boot", Title: "Golden Boot", Citation: "Top scorer"},
+		{Kind: "top_assists", Title: "Top Assister", Citation: "Most assists"},
+		{Kind: "best_goalkeeper", Title: "Golden Glove", Citation: "Best goalkeeper", MinGames: 1},
+		{Kind: "fair_play", Title: "Fair Play", Citation: "Fewest cards", MinGames: 1},
+		{Kind: "mvp", Title: "Player of the Tournament", Citation: "Most player of the match awards"},
+	}
+
+	register(Migration{
+		Version: 16,
+		Name:    "awards",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().CreateTable(&Award{}); err != nil {
+				return err
+			}
+			var events []uint
+			if err := tx.Table("events").Where("deleted_at IS NULL").Pluck("id", &events).Error; err != nil {
+				return err
+			}
+			var awards []Award
+			for _, id := range events {
+				for i, a := range defaults {
+					a.EventID, a.SortOrder = id, i+1
+					awards = append(awards, a)
+				}
+			}
+			if len(awards) == 0 {
+				return nil
+			}
+			return tx.Create(&awards).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&Award{})
+		},
+	})
+}
@@ -0,0 +1,274 @@
+// Package migrations holds the ordered, versioned schema changes for the
+// tracker database. Each step is plain Go with an Up and a Down, and the
+// applied versions are recorded in the schema_migrations table.
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration is a single schema step. Up and Down run inside a transaction.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// SchemaMigration is a row of the schema_migrations bookkeeping table
+type SchemaMigration struct {
+	Version   int    `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"not null"`
+	AppliedAt time.Time
+}
+
+func (SchemaMigration) TableName() string { return "schema_migrations" }
+
+// Status describes one known migration and whether it has been applied
+type Status struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+var (
+	// ErrSchemaTooNew means the database was migrated by a newer build
+	ErrSchemaTooNew = errors.New("database schema is newer than this build")
+	// ErrPending means known migrations have not been applied yet
+	ErrPending = errors.New("database has pending migrations")
+)
+
+var registry []Migration
+
+// register adds a migration to the registry; called from each step's init
+func register(m Migration) {
+	registry = append(registry, m)
+	sort.Slice(registry, func(i, j int) bool { return registry[i].Version < registry[j].Version })
+}
+
+// All returns the known migrations in version order
+func All() []Migration {
+	out := make([]Migration, len(registry))
+	copy(out, registry)
+	return out
+}
+
+// Latest is the highest version this build knows about
+func Latest() int {
+	if len(registry) == 0 {
+		return 0
+	}
+	return registry[len(registry)-1].Version
+}
+
+type Migrator struct {
+	db *gorm.DB
+}
+
+func New(db *gorm.DB) *Migrator {
+	return &Migrator{db: db}
+}
+
+// ensureTable creates the bookkeeping table; only To calls it, so reading
+// the status (as every readiness probe does) never touches the schema
+func (m *Migrator) ensureTable() error {
+	if m.db.Migrator().HasTable(&SchemaMigration{}) {
+		return nil
+	}
+	return m.db.Migrator().CreateTable(&SchemaMigration{})
+}
+
+// applied returns the applied versions; a database without the bookkeeping
+// table has none
+func (m *Migrator) applied() (map[int]SchemaMigration, error) {
+	if !m.db.Migrator().HasTable(&SchemaMigration{}) {
+		return map[int]SchemaMigration{}, nil
+	}
+	var rows []SchemaMigration
+	if err := m.db.Order("version ASC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make(map[int]SchemaMigration, len(rows))
+	for _, r := range rows {
+		out[r.Version] = r
+	}
+	return out, nil
+}
+
+// Current returns the highest applied version (0 for an empty database)
+func (m *Migrator) Current() (int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+	cur := 0
+	for v := range applied {
+		if v > cur {
+			cur = v
+		}
+	}
+	return cur, nil
+}
+
+// Status lists every known migration plus any unknown applied ones
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Status, 0, len(registry))
+	known := make(map[int]bool, len(registry))
+	for _, mig := range registry {
+		known[mig.Version] = true
+		s := Status{Version: mig.Version, Name: mig.Name}
+		if row, ok := applied[mig.Version]; ok {
+			at := row.AppliedAt
+			s.Applied = true
+			s.AppliedAt = &at
+		}
+		out = append(out, s)
+	}
+	for v, row := range applied {
+		if !known[v] {
+			at := row.AppliedAt
+			out = append(out, Status{Version: v, Name: row.Name + " (unknown to this build)", Applied: true, AppliedAt: &at})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// Pending returns the migrations that still have to be applied
+func (m *Migrator) Pending() ([]Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	var out []Migration
+	for _, mig := range registry {
+		if _, ok := applied[mig.Version]; !ok {
+			out = append(out, mig)
+		}
+	}
+	return out, nil
+}
+
+// CheckCompatible refuses databases that carry versions this build does not know
+func (m *Migrator) CheckCompatible() error {
+	cur, err := m.Current()
+	if err != nil {
+		return err
+	}
+	if cur > Latest() {
+		return fmt.Errorf("%w: database is at version %d, this build knows up to %d", ErrSchemaTooNew, cur, Latest())
+	}
+	return nil
+}
+
+// CheckReady verifies the schema is compatible and fully migrated
+func (m *Migrator) CheckReady() error {
+	if err := m.CheckCompatible(); err != nil {
+		return err
+	}
+	pending, err := m.Pending()
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: %d to apply, next is %d", ErrPending, len(pending), pending[0].Version)
+	}
+	return nil
+}
+
+// Up applies all pending migrations in order
+func (m *Migrator) Up() error {
+	return m.To(Latest())
+}
+
+// Down reverts the most recently applied migration
+func (m *Migrator) Down() error {
+	cur, err := m.Current()
+	if err != nil {
+		return err
+	}
+	if cur == 0 {
+		return nil
+	}
+	target := 0
+	for _, mig := range registry {
+		if mig.Version < cur {
+			target = mig.Version
+		}
+	}
+	return m.To(target)
+}
+
+// To migrates up or down until exactly the migrations <= version are applied
+func (m *Migrator) To(version int) error {
+	if err := m.CheckCompatible(); err != nil {
+		return err
+	}
+	if version < 0 || version > Latest() {
+		return fmt.Errorf("unknown target version %d (latest is %d)", version, Latest())
+	}
+	if err := m.ensureTable(); err != nil {
+		return err
+	}
+	applied, err := m.applied()
+	if err != nil {
+		return err
+	}
+
+	// Revert newest first
+	for i := len(registry) - 1; i >= 0; i-- {
+		mig := registry[i]
+		if _, ok := applied[mig.Version]; !ok || mig.Version <= version {
+			continue
+		}
+		if err := m.run(mig, false); err != nil {
+			return err
+		}
+	}
+	// Apply oldest first
+	for _, mig := range registry {
+		if _, ok := applied[mig.Version]; ok || mig.Version > version {
+			continue
+		}
+		if err := m.run(mig, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) run(mig Migration, up bool) error {
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		if up {
+			if err := mig.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Version: mig.Version, Name: mig.Name, AppliedAt: time.Now()}).Error
+		}
+		if mig.Down == nil {
+			return errors.New("migration is irreversible")
+		}
+		if err := mig.Down(tx); err != nil {
+			return err
+		}
+		return tx.Delete(&SchemaMigration{}, mig.Version).Error
+	})
+	if err != nil {
+		dir := "up"
+		if !up {
+			dir = "down"
+		}
+		return fmt.Errorf("migration %d (%s) %s: %w", mig.Version, mig.Name, dir, err)
+	}
+	return nil
+}
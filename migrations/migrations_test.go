@@ -0,0 +1,94 @@
+package migrations_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/yesakov/lukyasha-tracker/database/dbtest"
+	"github.com/yesakov/lukyasha-tracker/migrations"
+	"gorm.io/gorm"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(dbtest.Main(m))
+}
+
+// eachEmpty runs the scenario on an empty database of every backend
+func eachEmpty(t *testing.T, scenario func(t *testing.T, db *gorm.DB)) {
+	for _, driver := range dbtest.Drivers {
+		t.Run(driver, func(t *testing.T) {
+			scenario(t, dbtest.OpenEmpty(t, driver))
+		})
+	}
+}
+
+func TestReadsLeaveSchemaAlone(t *testing.T) {
+	eachEmpty(t, func(t *testing.T, db *gorm.DB) {
+		m := migrations.New(db)
+		if err := m.CheckReady(); err == nil {
+			t.Fatal("empty database reported ready")
+		}
+		if _, err := m.Status(); err != nil {
+			t.Fatal(err)
+		}
+		if db.Migrator().HasTable(&migrations.SchemaMigration{}) {
+			t.Fatal("reading the status created schema_migrations")
+		}
+	})
+}
+
+func TestRoundTrip(t *testing.T) {
+	eachEmpty(t, func(t *testing.T, db *gorm.DB) {
+		m := migrations.New(db)
+		if err := m.Up(); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.CheckReady(); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.To(0); err != nil {
+			t.Fatal(err)
+		}
+		if cur, err := m.Current(); err != nil || cur != 0 {
+			t.Fatalf("after down: version %d, %v", cur, err)
+		}
+		if err := m.Up(); err != nil {
+			t.Fatal(err)
+		}
+		if cur, err := m.Current(); err != nil || cur != migrations.Latest() {
+			t.Fatalf("after up: version %d, %v", cur, err)
+		}
+	})
+}
+
+func TestDuplicateNamesRefused(t *testing.T) {
+	eachEmpty(t, func(t *testing.T, db *gorm.DB) {
+		m := migrations.New(db)
+		if err := m.To(1); err != nil {
+			t.Fatal(err)
+		}
+		for _, stmt := range []string{
+			"INSERT INTO events (name, date, event_url) VALUES ('Cup', '2024-06-01', '')",
+			"INSERT INTO teams (name, event_id) VALUES ('Red', 1), ('Red', 1)",
+			"INSERT INTO players (name, team_id) VALUES ('Ann', 1), ('Ann', 1), ('Bob', 1)",
+		} {
+			if err := db.Exec(stmt).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+		err := m.Up()
+		if err == nil || !strings.Contains(err.Error(), `event 1 has 2 teams named "Red"`) ||
+			!strings.Contains(err.Error(), `team 1 has 2 players named "Ann"`) {
+			t.Fatalf("got %v, want both duplicates listed", err)
+		}
+		var names []string
+		db.Table("players").Order("id").Pluck("name", &names)
+		if strings.Join(names, ",") != "Ann,Ann,Bob" {
+			t.Fatalf("players renamed to %v", names)
+		}
+		if cur, _ := m.Current(); cur != 1 {
+			t.Fatalf("version %d after the refused step, want 1", cur)
+		}
+	})
+}
@@ -1,25 +1,88 @@
 package models
 
-import "gorm.io/gorm"
+import (
+    "fmt"
+    "time"
+
+    "gorm.io/gorm"
+)
 
 type Event struct {
     gorm.Model
     Name     string `form:"name" json:"name" gorm:"not null"`
     Date     string `form:"date" json:"date" gorm:"not null"`
     EventURL string `form:"event_url" json:"event_url" gorm:"not null"`
+    // The season (league) this event is a matchday of, if any
+    SeasonID *uint `form:"season_id" json:"season_id" gorm:"index"`
+    // Prediction league points for an exact score, the right goal
+    // difference and the right outcome; a tip scores its best match only
+    PredictExact    int `json:"predict_exact" gorm:"not null;default:5"`
+    PredictGoalDiff int `json:"predict_goal_diff" gorm:"not null;default:3"`
+    PredictOutcome  int `json:"predict_outcome" gorm:"not null;default:2"`
+}
+
+// Season groups events (one per matchday) into a league table
+type Season struct {
+    gorm.Model
+    Name   string  `form:"name" json:"name" gorm:"not null"`
+    Events []Event `json:"events,omitempty"`
 }
 
 type Team struct {
     gorm.Model
-    Name    string   `form:"name" json:"name" gorm:"not null;index:idx_team_event_name,unique"`
-    EventID uint     `form:"event_id" json:"event_id" gorm:"not null;index:idx_team_event_name,unique"`
+    Name    string   `form:"name" json:"name" gorm:"not null;index:idx_team_event_name,unique,where:deleted_at IS NULL"`
+    EventID uint     `form:"event_id" json:"event_id" gorm:"not null;index:idx_team_event_name,unique,where:deleted_at IS NULL"`
     Players []Player `gorm:"constraint:OnDelete:CASCADE;"`
+    // The club this event team was instantiated from, if any
+    ClubID *uint `form:"club_id" json:"club_id" gorm:"index"`
+}
+
+// Club is a team that persists across events; event Teams created from it
+// copy its name and default roster
+type Club struct {
+    gorm.Model
+    Name           string   `form:"name" json:"name" gorm:"not null;index:idx_club_name,unique,where:deleted_at IS NULL"`
+    ShortName      string   `form:"short_name" json:"short_name"`
+    PrimaryColor   string   `form:"primary_color" json:"primary_color"`
+    SecondaryColor string   `form:"secondary_color" json:"secondary_color"`
+    // Public path of the uploaded crest image
+    Crest  string   `json:"crest"`
+    Roster []Person `json:"roster,omitempty" gorm:"many2many:club_members;"`
 }
 
 type Player struct {
     gorm.Model
-    Name   string `form:"name" json:"name" gorm:"not null;index:idx_player_team_name,unique"`
-    TeamID uint   `form:"team_id" json:"team_id" gorm:"not null;index:idx_player_team_name,unique"`
+    Name   string `form:"name" json:"name" gorm:"not null;index:idx_player_team_name,unique,where:deleted_at IS NULL"`
+    TeamID uint   `form:"team_id" json:"team_id" gorm:"not null;index:idx_player_team_name,unique,where:deleted_at IS NULL"`
+    // The person behind this event roster entry, shared across events
+    PersonID *uint `form:"person_id" json:"person_id" gorm:"index"`
+    // Shirt number, unique within the team (partial index from migration 8)
+    Number        *int   `form:"number" json:"number"`
+    Position      string `form:"position" json:"position"`             // GK, DF, MF or FW
+    PreferredFoot string `form:"preferred_foot" json:"preferred_foot"` // left, right or both
+    // Photo and its thumbnail under storage.URLPrefix; set through the photo upload
+    Photo      string `json:"photo"`
+    PhotoThumb string `json:"photo_thumb"`
+    // Place in the team's roster list; players are listed by SortOrder, then ID
+    SortOrder int `json:"sort_order"`
+    // "captain" or "vice"; at most one of each per team
+    Armband string `json:"armband"`
+}
+
+// Label is the name with the shirt number in front, e.g. "#9 Ivan"
+func (p Player) Label() string {
+    if p.Number == nil {
+        return p.Name
+    }
+    return fmt.Sprintf("#%d %s", *p.Number, p.Name)
+}
+
+// Person is a real player across events; each event roster entry (Player)
+// links to one
+type Person struct {
+    gorm.Model
+    Name    string   `form:"name" json:"name" gorm:"not null;index"`
+    Players []Player `json:"players,omitempty"`
 }
 
 type Game struct {
@@ -29,6 +92,128 @@ type Game struct {
     AwayTeamID    uint `form:"away_team_id" json:"away_team_id" gorm:"not null;index"`
     HomeTeamGoals int  `form:"home_team_goals" json:"home_team_goals"`
     AwayTeamGoals int  `form:"away_team_goals" json:"away_team_goals"`
+    // GameScheduled until the final whistle, then GameFinished; only
+    // finished games move ratings
+    Status string `form:"status" json:"status" gorm:"not null;default:'scheduled'"`
+    // Predictions close at kick-off; without one they close when the game
+    // is finished
+    KickoffAt *time.Time `form:"kickoff_at" json:"kickoff_at" time_format:"2006-01-02T15:04"`
+    // Player of the match voting runs from finishing the game until then
+    MVPClosesAt *time.Time `json:"mvp_closes_at"`
+}
+
+// Game statuses
+const (
+    GameScheduled = "scheduled"
+    GameFinished  = "finished"
+)
+
+func (g Game) Finished() bool { return g.Status == GameFinished }
+
+// Open tells whether predictions are still taken at now
+func (g Game) Open(now time.Time) bool {
+    return !g.Finished() && (g.KickoffAt == nil || now.Before(*g.KickoffAt))
+}
+
+// VotingOpen tells whether player of the match votes are taken at now
+func (g Game) VotingOpen(now time.Time) bool {
+    return g.Finished() && g.MVPClosesAt != nil && now.Before(*g.MVPClosesAt)
+}
+
+// VotingClosed tells whether the game's player of the match is final
+func (g Game) VotingClosed(now time.Time) bool {
+    return g.Finished() && g.MVPClosesAt != nil && !now.Before(*g.MVPClosesAt)
+}
+
+// GameGoalkeeper puts a player in goal for a team from a minute of a game
+// until the team's next goalkeeper takes over
+type GameGoalkeeper struct {
+    gorm.Model
+    GameID     uint `form:"game_id" json:"game_id" gorm:"not null;index"`
+    TeamID     uint `form:"team_id" json:"team_id" gorm:"not null;index"`
+    PlayerID   uint `form:"player_id" json:"player_id" gorm:"not null;index"`
+    FromMinute int  `form:"from_minute" json:"from_minute"` // 0 = from kick-off
+}
+
+// PoolPlayer is someone available for an event's pickup games before the
+// teams are drawn; drawing turns the pool into Teams and Players
+type PoolPlayer struct {
+    gorm.Model
+    EventID  uint   `form:"event_id" json:"event_id" gorm:"not null;index"`
+    PersonID *uint  `form:"person_id" json:"person_id" gorm:"index"`
+    Name     string `form:"name" json:"name" gorm:"not null"`
+    Skill    int    `form:"skill" json:"skill" gorm:"not null;default:5"` // 1–10
+    Position string `form:"position" json:"position"`
+}
+
+// User is a spectator account for the prediction league
+type User struct {
+    gorm.Model
+    Name         string `json:"name" gorm:"not null"` // unique among live users (migration 14)
+    PasswordHash string `json:"-" gorm:"not null"`   // bcrypt
+}
+
+// Session is a signed-in browser or API client. The client holds a random
+// token; only its SHA-256 is stored.
+type Session struct {
+    ID        uint      `gorm:"primarykey"`
+    CreatedAt time.Time
+    UserID    uint      `gorm:"not null;index"`
+    TokenHash string    `gorm:"not null;uniqueIndex"`
+    ExpiresAt time.Time `gorm:"not null"`
+}
+
+// Prediction is a user's scoreline tip for a game, one per user and game
+type Prediction struct {
+    gorm.Model
+    GameID    uint `json:"game_id" gorm:"not null;index"`
+    UserID    uint `json:"user_id" gorm:"not null;index"`
+    HomeGoals int  `form:"home_goals" json:"home_goals"`
+    AwayGoals int  `form:"away_goals" json:"away_goals"`
+}
+
+// MVPVote is a player of the match vote, one per user and per device
+// (the device cookie of voters who are not signed in)
+type MVPVote struct {
+    gorm.Model
+    GameID   uint   `json:"game_id" gorm:"not null;index"`
+    PlayerID uint   `form:"player_id" json:"player_id" gorm:"not null;index"`
+    UserID   *uint  `json:"user_id" gorm:"index"`
+    Device   string `json:"-"`
+}
+
+// Award is one award an event hands out. The winners are worked out from
+// the event's data by Kind; every event starts with the default set.
+type Award struct {
+    gorm.Model
+    EventID   uint   `form:"event_id" json:"event_id" gorm:"not null;index"`
+    Kind      string `form:"kind" json:"kind" gorm:"not null"`
+    Title     string `form:"title" json:"title" gorm:"not null"`
+    Citation  string `form:"citation" json:"citation"`   // the line under the winner on the certificate
+    MinGames  int    `form:"min_games" json:"min_games"` // games needed to qualify for best goalkeeper and fair play
+    SortOrder int    `form:"sort_order" json:"sort_order"`
+}
+
+// Award kinds
+const (
+    AwardChampion   = "champion"
+    AwardGoldenBoot = "golden_boot"
+    AwardAssists    = "top_assists"
+    AwardGoalkeeper = "best_goalkeeper"
+    AwardFairPlay   = "fair_play"
+    AwardMVP        = "mvp"
+)
+
+// Transfer moves a player to another team of the same event from a game on;
+// a Guest transfer lends them to that team for the one game only
+type Transfer struct {
+    gorm.Model
+    PlayerID   uint `form:"player_id" json:"player_id" gorm:"not null;index"`
+    FromTeamID uint `json:"from_team_id" gorm:"not null"`
+    ToTeamID   uint `form:"to_team_id" json:"to_team_id" gorm:"not null"`
+    // First game for the new team, or the game of the guest appearance
+    GameID uint `form:"game_id" json:"game_id" gorm:"not null;index"`
+    Guest  bool `form:"guest" json:"guest"`
 }
 
 type GamePlayerStat struct {
@@ -36,10 +221,12 @@ type GamePlayerStat struct {
     PlayerID uint   `form:"player_id" json:"player_id" gorm:"not null;index"`
     GameID   uint   `form:"game_id" json:"game_id" gorm:"not null;index"`
     TeamID   uint   `form:"team_id" json:"team_id" gorm:"not null;index"`
-    Type     string `form:"type" json:"type" gorm:"not null;index"` // "goal", "penalty", "own_goal", or "assist"
+    Type     string `form:"type" json:"type" gorm:"not null;index"` // "goal", "penalty", "own_goal", "assist", "yellow_card", "red_card", "penalty_missed", "penalty_saved" or "save"
     Minute   int    `form:"minute" json:"minute" gorm:"index"`
     // For assists, reference the goal stat they belong to
     GoalStatID *uint `form:"goal_stat_id" json:"goal_stat_id" gorm:"index"`
+    // For missed and saved penalties, the goalkeeper faced (if known)
+    GoalkeeperID *uint `form:"goalkeeper_id" json:"goalkeeper_id" gorm:"index"`
 }
 
 // Optional: constants for Type field
@@ -48,4 +235,11 @@ const (
     StatTypeAssist = "assist"
     StatTypePenalty = "penalty"
     StatTypeOwnGoal = "own_goal"
+    StatTypeYellowCard = "yellow_card"
+    StatTypeRedCard = "red_card"
+    // Penalties that did not go in; they never change the score
+    StatTypePenaltyMissed = "penalty_missed"
+    StatTypePenaltySaved = "penalty_saved"
+    // A goalkeeper's save; the player is the goalkeeper
+    StatTypeSave = "save"
 )
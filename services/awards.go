@@ -0,0 +1,480 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+type AwardService interface {
+	// Definitions lists the event's awards in display order
+	Definitions(eventID uint) ([]models.Award, error)
+	AddAward(a *models.Award) error
+	// UpdateAward applies the non-zero changes; the event and kind stay
+	UpdateAward(id uint, changes models.Award) (*models.Award, error)
+	RemoveAward(id uint) (*models.Award, error)
+	// Results works out the winners of every award of the event
+	Results(eventID uint) (*AwardSheet, error)
+	// Result is one award with its winners, as its certificate shows it
+	Result(awardID uint) (*AwardResult, error)
+}
+
+// AwardKinds are the awards that can be worked out, with their labels
+var AwardKinds = []Choice{
+	{models.AwardChampion, "Champion (top of the table)"},
+	{models.AwardGoldenBoot, "Top scorer"},
+	{models.AwardAssists, "Top assister"},
+	{models.AwardGoalkeeper, "Best goalkeeper"},
+	{models.AwardFairPlay, "Fair play team"},
+	{models.AwardMVP, "Player of the tournament"},
+}
+
+// defaultAwards is the set every new event starts with (see migration 16)
+func defaultAwards(eventID uint) []models.Award {
+	awards := []models.Award{
+		{Kind: models.AwardChampion, Title: "Champions", Citation: "Winners of the tournament"},
+		{Kind: models.AwardGoldenBoot, Title: "Golden Boot", Citation: "Top scorer"},
+		{Kind: models.AwardAssists, Title: "Top Assister", Citation: "Most assists"},
+		{Kind: models.AwardGoalkeeper, Title: "Golden Glove", Citation: "Best goalkeeper", MinGames: 1},
+		{Kind: models.AwardFairPlay, Title: "Fair Play", Citation: "Fewest cards", MinGames: 1},
+		{Kind: models.AwardMVP, Title: "Player of the Tournament", Citation: "Most player of the match awards"},
+	}
+	for i := range awards {
+		awards[i].EventID, awards[i].SortOrder = eventID, i+1
+	}
+	return awards
+}
+
+// Fair play points per card; the team with the fewest wins
+const (
+	fairPlayYellow = 1
+	fairPlayRed    = 3
+)
+
+// AwardWinner is a player, or a team for team awards (PlayerID 0)
+type AwardWinner struct {
+	PlayerID uint
+	TeamID   uint
+	Name     string
+	Team     string
+	Detail   string // what won it, e.g. "7 goals (1 penalty), 3 assists"
+}
+
+type AwardResult struct {
+	Award models.Award
+	Event models.Event
+	// Winners share the award when level; none while nobody qualifies
+	Winners []AwardWinner
+}
+
+// KindLabel says what the award is worked out from
+func (r AwardResult) KindLabel() string {
+	for _, k := range AwardKinds {
+		if k.Value == r.Award.Kind {
+			return k.Label
+		}
+	}
+	return r.Award.Kind
+}
+
+// Qualifying reports whether the award has a minimum number of games
+func (r AwardResult) Qualifying() bool {
+	return r.Award.Kind == models.AwardGoalkeeper || r.Award.Kind == models.AwardFairPlay
+}
+
+type AwardSheet struct {
+	Event models.Event
+	// Final is set once every game is finished, so the results stand
+	Final  bool
+	Awards []AwardResult
+}
+
+type awardService struct {
+	db  *gorm.DB
+	mvp MVPService
+	// standings serves the table and the goalkeepers from the event cache
+	standings StandingsService
+}
+
+func (s *awardService) Definitions(eventID uint) ([]models.Award, error) {
+	var awards []models.Award
+	err := s.db.Where("event_id = ?", eventID).Order("sort_order ASC, id ASC").Find(&awards).Error
+	return awards, err
+}
+
+func (s *awardService) AddAward(a *models.Award) error {
+	a.Title = strings.TrimSpace(a.Title)
+	if a.EventID == 0 {
+		return invalid("EventID required")
+	}
+	if err := s.db.First(&models.Event{}, a.EventID).Error; err != nil {
+		return lookup(err, "Event")
+	}
+	if !isChoice(AwardKinds, a.Kind) {
+		return invalid("Unknown award kind %q", a.Kind)
+	}
+	if a.Title == "" {
+		for _, d := range defaultAwards(0) {
+			if d.Kind == a.Kind {
+				a.Title = d.Title
+			}
+		}
+	}
+	if a.MinGames < 0 {
+		return invalid("Minimum games can't be negative")
+	}
+	if a.SortOrder == 0 {
+		var last int
+		if err := s.db.Model(&models.Award{}).Where("event_id = ?", a.EventID).
+			Select("COALESCE(MAX(sort_order), 0)").Scan(&last).Error; err != nil {
+			return err
+		}
+		a.SortOrder = last + 1
+	}
+	return write(s.db.Create(a).Error, "Award")
+}
+
+func (s *awardService) UpdateAward(id uint, changes models.Award) (*models.Award, error) {
+	var existing models.Award
+	if err := s.db.First(&existing, id).Error; err != nil {
+		return nil, lookup(err, "Award")
+	}
+	changes.Title = strings.TrimSpace(changes.Title)
+	changes.Citation = strings.TrimSpace(changes.Citation)
+	if changes.MinGames < 0 {
+		return nil, invalid("Minimum games can't be negative")
+	}
+	// remove and re-add an award to change what it is for
+	changes.EventID, changes.Kind = 0, ""
+	if err := s.db.Model(&existing).Updates(changes).Error; err != nil {
+		return nil, write(err, "Award")
+	}
+	return &existing, nil
+}
+
+func (s *awardService) RemoveAward(id uint) (*models.Award, error) {
+	var a models.Award
+	if err := s.db.First(&a, id).Error; err != nil {
+		return nil, lookup(err, "Award")
+	}
+	if err := s.db.Delete(&a).Error; err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (s *awardService) Results(eventID uint) (*AwardSheet, error) {
+	var event models.Event
+	if err := s.db.First(&event, eventID).Error; err != nil {
+		return nil, lookup(err, "Event")
+	}
+	awards, err := s.Definitions(eventID)
+	if err != nil {
+		return nil, err
+	}
+	sheet := &AwardSheet{Event: event, Awards: make([]AwardResult, 0, len(awards))}
+	if sheet.Final, err = s.final(eventID); err != nil {
+		return nil, err
+	}
+	for _, a := range awards {
+		winners, err := s.winners(event.ID, a)
+		if err != nil {
+			return nil, err
+		}
+		sheet.Awards = append(sheet.Awards, AwardResult{Award: a, Event: event, Winners: winners})
+	}
+	return sheet, nil
+}
+
+func (s *awardService) Result(awardID uint) (*AwardResult, error) {
+	var a models.Award
+	if err := s.db.First(&a, awardID).Error; err != nil {
+		return nil, lookup(err, "Award")
+	}
+	var event models.Event
+	if err := s.db.First(&event, a.EventID).Error; err != nil {
+		return nil, lookup(err, "Event")
+	}
+	winners, err := s.winners(event.ID, a)
+	if err != nil {
+		return nil, err
+	}
+	return &AwardResult{Award: a, Event: event, Winners: winners}, nil
+}
+
+// final reports whether the event has games and all of them are finished
+func (s *awardService) final(eventID uint) (bool, error) {
+	var counts struct {
+		Games    int
+		Finished int
+	}
+	err := s.db.Model(&models.Game{}).
+		Select("COUNT(*) AS games, SUM(CASE WHEN status = ? THEN 1 ELSE 0 END) AS finished", models.GameFinished).
+		Where("event_id = ?", eventID).
+		Scan(&counts).Error
+	return counts.Games > 0 && counts.Finished == counts.Games, err
+}
+
+func (s *awardService) winners(eventID uint, a models.Award) ([]AwardWinner, error) {
+	switch a.Kind {
+	case models.AwardChampion:
+		return s.champions(eventID)
+	case models.AwardGoldenBoot:
+		return s.goldenBoot(eventID)
+	case models.AwardAssists:
+		return s.topAssists(eventID)
+	case models.AwardGoalkeeper:
+		return s.bestGoalkeeper(eventID, a.MinGames)
+	case models.AwardFairPlay:
+		return s.fairPlay(eventID, a.MinGames)
+	case models.AwardMVP:
+		return s.bestPlayer(eventID)
+	}
+	return []AwardWinner{}, nil
+}
+
+// champions are the teams level at the top of the table on points, goal
+// difference and goals for
+func (s *awardService) champions(eventID uint) ([]AwardWinner, error) {
+	table, err := s.table(eventID)
+	if err != nil {
+		return nil, err
+	}
+	out := []AwardWinner{}
+	if len(table) == 0 || table[0].Played == 0 {
+		return out, nil
+	}
+	top := table[0]
+	for _, r := range table {
+		if r.Points != top.Points || r.GD != top.GD || r.GF != top.GF {
+			break
+		}
+		out = append(out, AwardWinner{TeamID: r.Team.ID, Name: r.Team.Name, Team: r.Team.Name,
+			Detail: fmt.Sprintf("%s, goal difference %+d", counted(r.Points, [2]string{"point", "points"}), r.GD)})
+	}
+	return out, nil
+}
+
+// table is the event's standings as the event page shows them; the rows are
+// shared with the cache, so they are only read
+func (s *awardService) table(eventID uint) ([]*StandRow, error) {
+	stats, err := s.standings.EventStats(eventID, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	return stats.Standings, nil
+}
+
+// scorerRow is a player's goals (penalties included), penalties and assists
+type scorerRow struct {
+	PlayerID  uint
+	Goals     int
+	Penalties int
+	Assists   int
+}
+
+func (s *awardService) scorers(eventID uint) ([]scorerRow, error) {
+	var rows []scorerRow
+	err := s.db.Model(&models.GamePlayerStat{}).
+		Select(`game_player_stats.player_id,
+			SUM(CASE WHEN game_player_stats.type IN ? THEN 1 ELSE 0 END) AS goals,
+			SUM(CASE WHEN game_player_stats.type = ? THEN 1 ELSE 0 END) AS penalties,
+			SUM(CASE WHEN game_player_stats.type = ? THEN 1 ELSE 0 END) AS assists`,
+			scorerTypes, models.StatTypePenalty, models.StatTypeAssist).
+		Joins("JOIN games ON games.id = game_player_stats.game_id AND games.deleted_at IS NULL").
+		Where("games.event_id = ? AND game_player_stats.type IN ?", eventID,
+			[]string{models.StatTypeGoal, models.StatTypePenalty, models.StatTypeAssist}).
+		Group("game_player_stats.player_id").
+		Scan(&rows).Error
+	return rows, err
+}
+
+// goldenBoot goes to the top scorer; level scorers are split by fewer
+// penalties, then by more assists
+func (s *awardService) goldenBoot(eventID uint) ([]AwardWinner, error) {
+	rows, err := s.scorers(eventID)
+	if err != nil {
+		return nil, err
+	}
+	better := func(a, b scorerRow) bool {
+		if a.Goals != b.Goals {
+			return a.Goals > b.Goals
+		}
+		if a.Penalties != b.Penalties {
+			return a.Penalties < b.Penalties
+		}
+		return a.Assists > b.Assists
+	}
+	best := topRows(rows, better, func(r scorerRow) bool { return r.Goals > 0 })
+	return s.playerWinners(best, func(r scorerRow) (uint, string) {
+		detail := counted(r.Goals, [2]string{"goal", "goals"})
+		if r.Penalties > 0 {
+			detail += " (" + counted(r.Penalties, [2]string{"penalty", "penalties"}) + ")"
+		}
+		return r.PlayerID, detail + ", " + counted(r.Assists, statNames[models.StatTypeAssist])
+	})
+}
+
+// topAssists goes to the most assists; level players share it
+func (s *awardService) topAssists(eventID uint) ([]AwardWinner, error) {
+	rows, err := s.scorers(eventID)
+	if err != nil {
+		return nil, err
+	}
+	best := topRows(rows, func(a, b scorerRow) bool { return a.Assists > b.Assists },
+		func(r scorerRow) bool { return r.Assists > 0 })
+	return s.playerWinners(best, func(r scorerRow) (uint, string) {
+		return r.PlayerID, counted(r.Assists, statNames[models.StatTypeAssist])
+	})
+}
+
+// bestGoalkeeper goes to the most clean sheets among keepers with enough
+// games in goal, then the fewest goals conceded per game, then the best
+// save percentage
+func (s *awardService) bestGoalkeeper(eventID uint, minGames int) ([]AwardWinner, error) {
+	stats, err := s.standings.EventStats(eventID, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	rows := stats.Goalkeepers
+	better := func(a, b KeeperRow) bool {
+		if a.CleanSheets != b.CleanSheets {
+			return a.CleanSheets > b.CleanSheets
+		}
+		// conceded per game, compared without dividing
+		if x, y := a.Conceded*b.Games, b.Conceded*a.Games; x != y {
+			return x < y
+		}
+		return a.SavePct > b.SavePct
+	}
+	best := topRows(rows, better, func(r KeeperRow) bool { return r.Games > 0 && r.Games >= minGames })
+	out := make([]AwardWinner, 0, len(best))
+	for _, r := range best {
+		out = append(out, AwardWinner{PlayerID: r.PlayerID, TeamID: r.TeamID, Name: r.Player, Team: r.Team,
+			Detail: fmt.Sprintf("%s, %d conceded in %s", counted(r.CleanSheets, [2]string{"clean sheet", "clean sheets"}),
+				r.Conceded, counted(r.Games, [2]string{"game", "games"}))})
+	}
+	return out, nil
+}
+
+// fairPlay goes to the team with the fewest card points among the teams
+// with enough games
+func (s *awardService) fairPlay(eventID uint, minGames int) ([]AwardWinner, error) {
+	table, err := s.table(eventID)
+	if err != nil {
+		return nil, err
+	}
+	var cards []struct {
+		TeamID uint
+		Yellow int
+		Red    int
+	}
+	err = s.db.Model(&models.GamePlayerStat{}).
+		Select(`game_player_stats.team_id,
+			SUM(CASE WHEN game_player_stats.type = ? THEN 1 ELSE 0 END) AS yellow,
+			SUM(CASE WHEN game_player_stats.type = ? THEN 1 ELSE 0 END) AS red`,
+			models.StatTypeYellowCard, models.StatTypeRedCard).
+		Joins("JOIN games ON games.id = game_player_stats.game_id AND games.deleted_at IS NULL").
+		Where("games.event_id = ? AND game_player_stats.type IN ?", eventID,
+			[]string{models.StatTypeYellowCard, models.StatTypeRedCard}).
+		Group("game_player_stats.team_id").
+		Scan(&cards).Error
+	if err != nil {
+		return nil, err
+	}
+	type teamCards struct {
+		Row         *StandRow
+		Yellow, Red int
+	}
+	byTeam := make(map[uint]teamCards)
+	for _, c := range cards {
+		byTeam[c.TeamID] = teamCards{Yellow: c.Yellow, Red: c.Red}
+	}
+	rows := make([]teamCards, 0, len(table))
+	for _, r := range table {
+		t := byTeam[r.Team.ID]
+		t.Row = r
+		rows = append(rows, t)
+	}
+	points := func(t teamCards) int { return t.Yellow*fairPlayYellow + t.Red*fairPlayRed }
+	best := topRows(rows, func(a, b teamCards) bool { return points(a) < points(b) },
+		func(t teamCards) bool { return t.Row.Played > 0 && t.Row.Played >= minGames })
+	out := make([]AwardWinner, 0, len(best))
+	for _, t := range best {
+		out = append(out, AwardWinner{TeamID: t.Row.Team.ID, Name: t.Row.Team.Name, Team: t.Row.Team.Name,
+			Detail: fmt.Sprintf("%s, %s in %s", counted(t.Yellow, statNames[models.StatTypeYellowCard]),
+				counted(t.Red, statNames[models.StatTypeRedCard]), counted(t.Row.Played, [2]string{"game", "games"}))})
+	}
+	return out, nil
+}
+
+// bestPlayer is the event's best player by player of the match awards
+func (s *awardService) bestPlayer(eventID uint) ([]AwardWinner, error) {
+	rows, err := s.mvp.Best(eventID)
+	if err != nil {
+		return nil, err
+	}
+	out := []AwardWinner{}
+	for _, r := range rows {
+		if r.Rank != 1 || r.Awards == 0 {
+			break
+		}
+		out = append(out, AwardWinner{PlayerID: r.PlayerID, Name: r.Player, Team: r.Team,
+			Detail: fmt.Sprintf("%s, %s", counted(r.Awards, [2]string{"player of the match award", "player of the match awards"}),
+				counted(r.Votes, [2]string{"vote", "votes"}))})
+	}
+	return out, nil
+}
+
+// topRows keeps the rows that qualify and are level with the best one
+func topRows[T any](rows []T, better func(a, b T) bool, qualifies func(T) bool) []T {
+	var best []T
+	for _, r := range rows {
+		switch {
+		case !qualifies(r):
+		case len(best) == 0 || better(r, best[0]):
+			best = []T{r}
+		case !better(best[0], r):
+			best = append(best, r)
+		}
+	}
+	return best
+}
+
+// playerWinners names the rows' players, in name order
+func (s *awardService) playerWinners(rows []scorerRow, describe func(scorerRow) (uint, string)) ([]AwardWinner, error) {
+	out := make([]AwardWinner, 0, len(rows))
+	if len(rows) == 0 {
+		return out, nil
+	}
+	ids := make([]uint, len(rows))
+	for i, r := range rows {
+		ids[i] = r.PlayerID
+	}
+	var names []struct {
+		ID     uint
+		Name   string
+		TeamID uint
+		Team   string
+	}
+	if err := s.db.Model(&models.Player{}).Unscoped().
+		Select("players.id, players.name, players.team_id, COALESCE(teams.name, '') AS team").
+		Joins("LEFT JOIN teams ON teams.id = players.team_id").
+		Where("players.id IN ?", ids).
+		Scan(&names).Error; err != nil {
+		return nil, err
+	}
+	details := make(map[uint]string, len(rows))
+	for _, r := range rows {
+		id, detail := describe(r)
+		details[id] = detail
+	}
+	for _, n := range names {
+		out = append(out, AwardWinner{PlayerID: n.ID, TeamID: n.TeamID, Name: n.Name, Team: n.Team, Detail: details[n.ID]})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
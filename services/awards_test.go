@@ -0,0 +1,121 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+// awardWinners names the winners of the event's award of kind
+func awardWinners(t *testing.T, svc *Services, eventID uint, kind string) []string {
+	t.Helper()
+	sheet, err := svc.Awards.Results(eventID)
+	must(t, err)
+	for _, a := range sheet.Awards {
+		if a.Award.Kind == kind {
+			names := []string{}
+			for _, w := range a.Winners {
+				names = append(names, w.Name)
+			}
+			return names
+		}
+	}
+	t.Fatalf("no %s award", kind)
+	return nil
+}
+
+func TestAwardTieBreaks(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		ann, bob, cid := f.homePlayers[0], f.homePlayers[1], f.homePlayers[2]
+		dan, eve := f.awayPlayers[0], f.awayPlayers[1]
+		f.team(t, "Spare") // no games, no cards: doesn't qualify for fair play
+		game := f.game(t)
+		goal := func(p models.Player, goalType string, assist *models.Player) {
+			in := GoalInput{PlayerID: p.ID, TeamID: p.TeamID, Minute: 10, GoalType: goalType}
+			if assist != nil {
+				in.AssistPlayerID = assist.ID
+			}
+			_, err := svc.Stats.AddGoal(game.ID, in)
+			must(t, err)
+		}
+		card := func(p models.Player, cardType string) {
+			must(t, svc.Stats.AddCard(game.ID, CardInput{PlayerID: p.ID, TeamID: p.TeamID, CardType: cardType}))
+		}
+
+		// two goals each: Ann's penalty puts her behind Dan, and Bob's and
+		// Eve's assists put them ahead of him, level with each other
+		goal(ann, models.StatTypeGoal, &bob)
+		goal(ann, models.StatTypePenalty, nil)
+		goal(dan, models.StatTypeGoal, &eve)
+		goal(dan, models.StatTypeGoal, nil)
+		goal(bob, models.StatTypeGoal, nil)
+		goal(bob, models.StatTypeGoal, nil)
+		goal(eve, models.StatTypeGoal, nil)
+		goal(eve, models.StatTypeGoal, nil)
+		if got := awardWinners(t, svc, f.event.ID, models.AwardGoldenBoot); fmt.Sprint(got) != "[Bob Eve]" {
+			t.Fatalf("golden boot %v, want Bob and Eve", got)
+		}
+		if got := awardWinners(t, svc, f.event.ID, models.AwardAssists); fmt.Sprint(got) != "[Bob Eve]" {
+			t.Fatalf("top assisters %v, want Bob and Eve", got)
+		}
+		// 4:4, so level on points, goal difference and goals
+		if got := awardWinners(t, svc, f.event.ID, models.AwardChampion); len(got) != 2 {
+			t.Fatalf("champions %v, want both teams", got)
+		}
+
+		// three yellows weigh as much as one red
+		card(cid, models.StatTypeYellowCard)
+		card(cid, models.StatTypeYellowCard)
+		if got := awardWinners(t, svc, f.event.ID, models.AwardFairPlay); fmt.Sprint(got) != "[Away]" {
+			t.Fatalf("fair play %v, want Away", got)
+		}
+		card(dan, models.StatTypeRedCard)
+		card(ann, models.StatTypeYellowCard)
+		if got := awardWinners(t, svc, f.event.ID, models.AwardFairPlay); len(got) != 2 {
+			t.Fatalf("fair play %v, want both teams", got)
+		}
+	})
+}
+
+func TestGoalkeeperAward(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		ann, dan := f.homePlayers[0], f.awayPlayers[0]
+		game := f.game(t)
+		must(t, svc.Keepers.Assign(game.ID, KeeperInput{TeamID: f.home.ID, PlayerID: ann.ID}))
+		must(t, svc.Keepers.Assign(game.ID, KeeperInput{TeamID: f.away.ID, PlayerID: dan.ID}))
+		f.goal(t, game.ID, f.homePlayers[1], nil)
+		f.goal(t, game.ID, f.awayPlayers[1], nil)
+
+		// no clean sheets and a goal each: Ann's save decides
+		must(t, svc.Keepers.AddSave(game.ID, SaveInput{TeamID: f.home.ID, PlayerID: ann.ID, Minute: 20}))
+		if got := awardWinners(t, svc, f.event.ID, models.AwardGoalkeeper); fmt.Sprint(got) != "[Ann]" {
+			t.Fatalf("best goalkeeper %v, want Ann", got)
+		}
+
+		// Away wins 1:0: Dan's clean sheet outweighs Ann's save
+		second := f.game(t)
+		must(t, svc.Keepers.Assign(second.ID, KeeperInput{TeamID: f.home.ID, PlayerID: ann.ID}))
+		must(t, svc.Keepers.Assign(second.ID, KeeperInput{TeamID: f.away.ID, PlayerID: dan.ID}))
+		f.goal(t, second.ID, f.awayPlayers[1], nil)
+		if got := awardWinners(t, svc, f.event.ID, models.AwardGoalkeeper); fmt.Sprint(got) != "[Dan]" {
+			t.Fatalf("best goalkeeper %v, want Dan", got)
+		}
+
+		// nobody has three games in goal
+		awards, err := svc.Awards.Definitions(f.event.ID)
+		must(t, err)
+		for _, a := range awards {
+			if a.Kind == models.AwardGoalkeeper {
+				_, err := svc.Awards.UpdateAward(a.ID, models.Award{MinGames: 3})
+				must(t, err)
+			}
+		}
+		if got := awardWinners(t, svc, f.event.ID, models.AwardGoalkeeper); len(got) != 0 {
+			t.Fatalf("best goalkeeper %v without enough games", got)
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+// EventStats is the standings table, the leaderboards and the records of
+// one event
+type EventStats struct {
+	Standings   []*StandRow
+	TopScorers  []LeaderRow
+	TopAssists  []LeaderRow
+	Goalkeepers []KeeperRow
+	Records     *Records
+}
+
+// eventCache memoizes EventStats per event. Every write that can change an
+// event's games, stats, goalkeepers, teams or players bumps that event's version, which
+// drops the cached entry and changes the event's ETag.
+type eventCache struct {
+	mu       sync.Mutex
+	epoch    string // tells versions of different processes apart
+	versions map[uint]uint64
+	entries  map[cacheKey]cacheEntry
+	// all counts writes to any event, for data derived across events
+	all uint64
+}
+
+type cacheKey struct {
+	eventID uint
+	teamID  uint
+	limit   int
+}
+
+type cacheEntry struct {
+	version uint64
+	stats   *EventStats
+}
+
+func newEventCache() *eventCache {
+	return &eventCache{
+		epoch:    strconv.FormatInt(time.Now().UnixNano(), 36),
+		versions: make(map[uint]uint64),
+		entries:  make(map[cacheKey]cacheEntry),
+	}
+}
+
+func (c *eventCache) version(eventID uint) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.versions[eventID]
+}
+
+// etag is a weak validator for everything derived from the event's data
+func (c *eventCache) etag(eventID uint) string {
+	return fmt.Sprintf(`W/"e%d-%s-%d"`, eventID, c.epoch, c.version(eventID))
+}
+
+func (c *eventCache) get(key cacheKey) (*EventStats, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v := c.versions[key.eventID]
+	e, ok := c.entries[key]
+	if !ok || e.version != v {
+		return nil, v, false
+	}
+	return e.stats, v, true
+}
+
+// put stores stats computed at version v, unless a write happened meanwhile
+func (c *eventCache) put(key cacheKey, v uint64, stats *EventStats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.versions[key.eventID] == v {
+		c.entries[key] = cacheEntry{version: v, stats: stats}
+	}
+}
+
+// allVersion changes whenever any event is invalidated
+func (c *eventCache) allVersion() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.all
+}
+
+func (c *eventCache) invalidate(eventIDs ...uint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, id := range eventIDs {
+		if id == 0 {
+			continue
+		}
+		c.all++
+		c.versions[id]++
+		for k := range c.entries {
+			if k.eventID == id {
+				delete(c.entries, k)
+			}
+		}
+	}
+}
+
+// invalidateGame invalidates the event the game belongs to
+func (c *eventCache) invalidateGame(db *gorm.DB, gameID uint) {
+	var eventIDs []uint
+	db.Unscoped().Model(&models.Game{}).Where("id = ?", gameID).Pluck("event_id", &eventIDs)
+	c.invalidate(eventIDs...)
+}
+
+// invalidateTeam invalidates the event the team belongs to
+func (c *eventCache) invalidateTeam(db *gorm.DB, teamID uint) {
+	var eventIDs []uint
+	db.Unscoped().Model(&models.Team{}).Where("id = ?", teamID).Pluck("event_id", &eventIDs)
+	c.invalidate(eventIDs...)
+}
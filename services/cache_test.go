@@ -0,0 +1,72 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+func TestEventStatsCache(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		game := f.game(t)
+		f.goal(t, game.ID, f.homePlayers[0], nil)
+		etag := svc.Standings.ETag(f.event.ID)
+
+		stats, err := svc.Standings.EventStats(f.event.ID, 0, 10)
+		must(t, err)
+		if len(stats.TopScorers) != 1 || stats.TopScorers[0].Count != 1 {
+			t.Fatalf("top scorers %+v", stats.TopScorers)
+		}
+
+		// a write behind the services' back is not seen: the stats are cached
+		must(t, db.Create(&models.GamePlayerStat{GameID: game.ID, PlayerID: f.homePlayers[0].ID, TeamID: f.home.ID, Type: models.StatTypeGoal}).Error)
+		cached, err := svc.Standings.EventStats(f.event.ID, 0, 10)
+		must(t, err)
+		if cached != stats || svc.Standings.ETag(f.event.ID) != etag {
+			t.Fatal("cached stats or ETag changed without a write through the services")
+		}
+
+		// writes to another event leave this one alone
+		other := models.Event{Name: "League", Date: "2024-07-01", EventURL: "https://example.com"}
+		must(t, svc.Events.Create(&other))
+		must(t, svc.Teams.Create(&models.Team{Name: "Red", EventID: other.ID}))
+		if svc.Standings.ETag(f.event.ID) != etag {
+			t.Fatal("ETag changed by a write to another event")
+		}
+
+		// a goal through the services drops the entry and moves the ETag
+		f.goal(t, game.ID, f.homePlayers[0], nil)
+		if svc.Standings.ETag(f.event.ID) == etag {
+			t.Fatal("ETag unchanged after a goal")
+		}
+		fresh, err := svc.Standings.EventStats(f.event.ID, 0, 10)
+		must(t, err)
+		if fresh.TopScorers[0].Count != 3 || fresh.Standings[0].GF != 2 {
+			t.Fatalf("stale stats after a goal: scorers %+v, leader %+v", fresh.TopScorers, fresh.Standings[0])
+		}
+	})
+}
+
+func TestCacheInvalidatedByRosterChanges(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		changes := map[string]func(){
+			"team rename": func() {
+				_, err := svc.Teams.Update(f.away.ID, models.Team{Name: "Visitors"})
+				must(t, err)
+			},
+			"new player":    func() { f.player(t, f.home.ID, "Gus") },
+			"player delete": func() { must(t, svc.Players.Delete(f.awayPlayers[2].ID, DeleteRestrict)) },
+			"game":          func() { f.game(t) },
+		}
+		for name, change := range changes {
+			etag := svc.Standings.ETag(f.event.ID)
+			change()
+			if svc.Standings.ETag(f.event.ID) == etag {
+				t.Errorf("%s: ETag unchanged", name)
+			}
+		}
+	})
+}
@@ -0,0 +1,352 @@
+package services
+
+import (
+	"errors"
+	"mime/multipart"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"github.com/yesakov/lukyasha-tracker/storage"
+	"gorm.io/gorm"
+)
+
+type ClubService interface {
+	// List returns all clubs sorted by name
+	List() ([]models.Club, error)
+	// Get returns the club with its default roster
+	Get(id uint) (*models.Club, error)
+	// Create and Update store the crest image when one is given (nil keeps
+	// the current one); a rejected image leaves the club untouched
+	Create(club *models.Club, crest *multipart.FileHeader) error
+	Update(id uint, changes models.Club, crest *multipart.FileHeader) (*models.Club, error)
+	// Delete removes the club; its event teams stay, unlinked
+	Delete(id uint) error
+	AddMember(clubID, personID uint) error
+	RemoveMember(clubID, personID uint) error
+	// Profile gathers the club's events, trophies and head-to-head records
+	Profile(id uint) (*ClubProfile, error)
+}
+
+// ClubSeason is the club's event team and where it finished in the table
+type ClubSeason struct {
+	TeamID   uint
+	EventID  uint
+	Event    string
+	Date     string
+	Team     string
+	Position int // 1-based place in the event standings
+	Teams    int
+	Record   StandRow
+}
+
+// HeadToHead is the all-time record against another club
+type HeadToHead struct {
+	Opponent models.Club
+	Played   int
+	Wins     int
+	Draws    int
+	Losses   int
+	GF       int
+	GA       int
+}
+
+type ClubProfile struct {
+	Club    models.Club
+	Seasons []ClubSeason // newest event first
+	// Trophies are the events the club topped the table in (with games played)
+	Trophies   []ClubSeason
+	HeadToHead []HeadToHead
+}
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+type clubService struct {
+	db    *gorm.DB
+	files *storage.Store
+}
+
+func (s *clubService) List() ([]models.Club, error) {
+	var clubs []models.Club
+	err := s.db.Order("name ASC").Find(&clubs).Error
+	return clubs, err
+}
+
+func (s *clubService) Get(id uint) (*models.Club, error) {
+	var club models.Club
+	if err := s.db.Preload("Roster", func(db *gorm.DB) *gorm.DB {
+		return db.Order("people.name ASC")
+	}).First(&club, id).Error; err != nil {
+		return nil, lookup(err, "Club")
+	}
+	return &club, nil
+}
+
+func (s *clubService) Create(club *models.Club, crest *multipart.FileHeader) error {
+	club.Name = strings.TrimSpace(club.Name)
+	club.ShortName = strings.TrimSpace(club.ShortName)
+	if club.Name == "" {
+		return invalid("Name required")
+	}
+	err := checkColors(*club)
+	if err != nil {
+		return err
+	}
+	if err := s.checkName(club.Name, 0); err != nil {
+		return err
+	}
+	club.Roster = nil
+	if club.Crest, err = s.saveCrest(crest); err != nil {
+		return err
+	}
+	if err := s.db.Create(club).Error; err != nil {
+		s.files.Remove(club.Crest)
+		return write(err, "Club")
+	}
+	return nil
+}
+
+func (s *clubService) Update(id uint, changes models.Club, crest *multipart.FileHeader) (*models.Club, error) {
+	existing, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	changes.Name = strings.TrimSpace(changes.Name)
+	changes.ShortName = strings.TrimSpace(changes.ShortName)
+	if err := checkColors(changes); err != nil {
+		return nil, err
+	}
+	if changes.Name != "" && changes.Name != existing.Name {
+		if err := s.checkName(changes.Name, existing.ID); err != nil {
+			return nil, err
+		}
+	}
+	changes.Roster = nil
+	old := existing.Crest
+	if changes.Crest, err = s.saveCrest(crest); err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(existing).Updates(changes).Error; err != nil {
+		s.files.Remove(changes.Crest)
+		return nil, write(err, "Club")
+	}
+	if changes.Crest != "" {
+		s.files.Remove(old)
+	}
+	return existing, nil
+}
+
+// saveCrest stores an uploaded crest and returns its path ("" without one)
+func (s *clubService) saveCrest(file *multipart.FileHeader) (string, error) {
+	if file == nil {
+		return "", nil
+	}
+	path, err := s.files.SaveImage(file, "crests")
+	if errors.Is(err, storage.ErrTooLarge) || errors.Is(err, storage.ErrNotImage) {
+		return "", invalid("%s", err.Error())
+	}
+	return path, err
+}
+
+func (s *clubService) Delete(id uint) error {
+	club, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&models.Team{}).Where("club_id = ?", id).
+			UpdateColumn("club_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM club_members WHERE club_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Club{}, id).Error
+	})
+	if err != nil {
+		return err
+	}
+	// the crest goes once the club is gone, so a failed delete keeps it
+	s.files.Remove(club.Crest)
+	return nil
+}
+
+func (s *clubService) AddMember(clubID, personID uint) error {
+	club, err := s.Get(clubID)
+	if err != nil {
+		return err
+	}
+	var person models.Person
+	if err := s.db.First(&person, personID).Error; err != nil {
+		return invalidLookup(err, "Person not found")
+	}
+	for _, p := range club.Roster {
+		if p.ID == person.ID {
+			return conflict("%s is already in the roster", person.Name)
+		}
+	}
+	return s.db.Model(club).Association("Roster").Append(&person)
+}
+
+func (s *clubService) RemoveMember(clubID, personID uint) error {
+	club, err := s.Get(clubID)
+	if err != nil {
+		return err
+	}
+	return s.db.Model(club).Association("Roster").Delete(&models.Person{Model: gorm.Model{ID: personID}})
+}
+
+func (s *clubService) Profile(id uint) (*ClubProfile, error) {
+	club, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	p := &ClubProfile{Club: *club, Seasons: []ClubSeason{}, Trophies: []ClubSeason{}, HeadToHead: []HeadToHead{}}
+
+	var clubTeams []models.Team
+	if err := s.db.Joins("JOIN events ON events.id = teams.event_id AND events.deleted_at IS NULL").
+		Where("teams.club_id = ?", id).Find(&clubTeams).Error; err != nil {
+		return nil, err
+	}
+	if len(clubTeams) == 0 {
+		return p, nil
+	}
+	eventIDs := make([]uint, len(clubTeams))
+	for i, t := range clubTeams {
+		eventIDs[i] = t.EventID
+	}
+	var events []models.Event
+	var teams []models.Team
+	var games []models.Game
+	if err := s.db.Where("id IN ?", eventIDs).Find(&events).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Where("event_id IN ?", eventIDs).Find(&teams).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Where("event_id IN ?", eventIDs).Find(&games).Error; err != nil {
+		return nil, err
+	}
+
+	teamsByEvent := make(map[uint][]models.Team)
+	teamClub := make(map[uint]uint)
+	for _, t := range teams {
+		teamsByEvent[t.EventID] = append(teamsByEvent[t.EventID], t)
+		if t.ClubID != nil {
+			teamClub[t.ID] = *t.ClubID
+		}
+	}
+	gamesByEvent := make(map[uint][]models.Game)
+	for _, g := range games {
+		gamesByEvent[g.EventID] = append(gamesByEvent[g.EventID], g)
+	}
+	eventByID := make(map[uint]models.Event, len(events))
+	for _, e := range events {
+		eventByID[e.ID] = e
+	}
+
+	for _, t := range clubTeams {
+		e := eventByID[t.EventID]
+		table := computeStandings(teamsByEvent[e.ID], gamesByEvent[e.ID])
+		season := ClubSeason{TeamID: t.ID, EventID: e.ID, Event: e.Name, Date: e.Date, Team: t.Name, Teams: len(table)}
+		for i, row := range table {
+			if row.Team.ID == t.ID {
+				season.Position = i + 1
+				season.Record = *row
+			}
+		}
+		p.Seasons = append(p.Seasons, season)
+		if season.Position == 1 && season.Record.Played > 0 {
+			p.Trophies = append(p.Trophies, season)
+		}
+	}
+	newestFirst := func(list []ClubSeason) {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Date != list[j].Date {
+				return list[i].Date > list[j].Date
+			}
+			return list[i].EventID > list[j].EventID
+		})
+	}
+	newestFirst(p.Seasons)
+	newestFirst(p.Trophies)
+
+	// Head-to-head over games where both sides came from clubs
+	records := make(map[uint]*HeadToHead)
+	for _, g := range games {
+		home, away := teamClub[g.HomeTeamID], teamClub[g.AwayTeamID]
+		var opp uint
+		var gf, ga int
+		switch {
+		case home == id && away != 0 && away != id:
+			opp, gf, ga = away, g.HomeTeamGoals, g.AwayTeamGoals
+		case away == id && home != 0 && home != id:
+			opp, gf, ga = home, g.AwayTeamGoals, g.HomeTeamGoals
+		default:
+			continue
+		}
+		r := records[opp]
+		if r == nil {
+			r = &HeadToHead{}
+			records[opp] = r
+		}
+		r.Played++
+		r.GF += gf
+		r.GA += ga
+		switch {
+		case gf > ga:
+			r.Wins++
+		case gf < ga:
+			r.Losses++
+		default:
+			r.Draws++
+		}
+	}
+	if len(records) > 0 {
+		oppIDs := make([]uint, 0, len(records))
+		for oid := range records {
+			oppIDs = append(oppIDs, oid)
+		}
+		var opponents []models.Club
+		if err := s.db.Unscoped().Where("id IN ?", oppIDs).Find(&opponents).Error; err != nil {
+			return nil, err
+		}
+		for _, o := range opponents {
+			r := records[o.ID]
+			r.Opponent = o
+			p.HeadToHead = append(p.HeadToHead, *r)
+		}
+		sort.Slice(p.HeadToHead, func(i, j int) bool {
+			a, b := p.HeadToHead[i], p.HeadToHead[j]
+			if a.Played != b.Played {
+				return a.Played > b.Played
+			}
+			return a.Opponent.Name < b.Opponent.Name
+		})
+	}
+	return p, nil
+}
+
+// checkName rejects a club name already in use (except by club `self`)
+func (s *clubService) checkName(name string, self uint) error {
+	var existing models.Club
+	res := s.db.Where("name = ?", name).Limit(1).Find(&existing)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 && existing.ID != self {
+		return conflict("Club already exists")
+	}
+	return nil
+}
+
+// checkColors accepts empty colors or #rrggbb
+func checkColors(club models.Club) error {
+	for _, c := range []string{club.PrimaryColor, club.SecondaryColor} {
+		if c != "" && !colorPattern.MatchString(c) {
+			return invalid("Colors must look like #1a2b3c")
+		}
+	}
+	return nil
+}
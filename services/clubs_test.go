@@ -0,0 +1,155 @@
+package services
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"github.com/yesakov/lukyasha-tracker/storage"
+	"gorm.io/gorm"
+)
+
+// upload wraps a width×height PNG in a multipart file header, as a form
+// post would
+func upload(t *testing.T, name string, width, height int) *multipart.FileHeader {
+	t.Helper()
+	var img bytes.Buffer
+	must(t, png.Encode(&img, image.NewRGBA(image.Rect(0, 0, width, height))))
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreateFormFile("file", name)
+	must(t, err)
+	part.Write(img.Bytes())
+	must(t, w.Close())
+	form, err := multipart.NewReader(&body, w.Boundary()).ReadForm(1 << 20)
+	must(t, err)
+	t.Cleanup(func() { form.RemoveAll() })
+	return form.File["file"][0]
+}
+
+// onDisk tells whether a public upload path exists in the store
+func onDisk(t *testing.T, svc *Services, path string) bool {
+	t.Helper()
+	dir := svc.Clubs.(*clubService).files.Dir
+	_, err := os.Stat(filepath.Join(dir, strings.TrimPrefix(path, storage.URLPrefix+"/")))
+	return err == nil
+}
+
+func TestClubCrest(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		club := models.Club{Name: "Lions"}
+		must(t, svc.Clubs.Create(&club, upload(t, "crest.png", 4, 4)))
+		if !strings.HasPrefix(club.Crest, storage.URLPrefix+"/crests/") || !onDisk(t, svc, club.Crest) {
+			t.Fatalf("crest %q not stored", club.Crest)
+		}
+
+		// a new crest replaces the old file
+		first := club.Crest
+		updated, err := svc.Clubs.Update(club.ID, models.Club{}, upload(t, "new.png", 4, 4))
+		must(t, err)
+		if onDisk(t, svc, first) || !onDisk(t, svc, updated.Crest) {
+			t.Fatalf("crests after update: old %q kept or new %q missing", first, updated.Crest)
+		}
+
+		// only images are accepted, and the club keeps its crest
+		var body bytes.Buffer
+		w := multipart.NewWriter(&body)
+		part, _ := w.CreateFormFile("file", "crest.png")
+		part.Write([]byte("<svg></svg>"))
+		w.Close()
+		form, err := multipart.NewReader(&body, w.Boundary()).ReadForm(1 << 20)
+		must(t, err)
+		_, err = svc.Clubs.Update(club.ID, models.Club{}, form.File["file"][0])
+		wantKind(t, err, ErrValidation)
+
+		must(t, svc.Clubs.Delete(club.ID))
+		if onDisk(t, svc, updated.Crest) {
+			t.Fatal("crest left on disk after the club was deleted")
+		}
+	})
+}
+
+func TestClubProfile(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		lions, tigers := models.Club{Name: "Lions"}, models.Club{Name: "Tigers"}
+		must(t, svc.Clubs.Create(&lions, nil))
+		must(t, svc.Clubs.Create(&tigers, nil))
+		must(t, svc.Clubs.AddMember(lions.ID, *f.homePlayers[0].PersonID))
+		wantKind(t, svc.Clubs.AddMember(lions.ID, *f.homePlayers[0].PersonID), ErrConflict)
+
+		// Lions beat Tigers 2:0 and 3:1 in the first event and draw 1:1 in the second
+		var seasons []models.Team
+		for i, date := range []string{"2024-07-01", "2024-08-01"} {
+			event := models.Event{Name: "Cup " + date, Date: date, EventURL: "https://example.com"}
+			must(t, svc.Events.Create(&event))
+			home, away := models.Team{EventID: event.ID, ClubID: &lions.ID}, models.Team{EventID: event.ID, ClubID: &tigers.ID}
+			must(t, svc.Teams.Create(&home))
+			must(t, svc.Teams.Create(&away))
+			seasons = append(seasons, home)
+			scores := [][2]int{{2, 0}, {3, 1}}
+			if i == 1 {
+				scores = [][2]int{{1, 1}}
+			}
+			for _, sc := range scores {
+				g := models.Game{EventID: event.ID, HomeTeamID: home.ID, AwayTeamID: away.ID, HomeTeamGoals: sc[0], AwayTeamGoals: sc[1]}
+				must(t, db.Create(&g).Error)
+			}
+		}
+		team, err := svc.Teams.Get(seasons[0].ID)
+		must(t, err)
+		rosters, err := svc.Events.Teams(team.EventID)
+		must(t, err)
+		if team.Name != "Lions" || len(rosters[0].Players) != 1 || rosters[0].Players[0].Name != "Ann" {
+			t.Fatalf("team from club: %+v", rosters)
+		}
+
+		p, err := svc.Clubs.Profile(lions.ID)
+		must(t, err)
+		if len(p.Seasons) != 2 || p.Seasons[0].Date != "2024-08-01" || p.Seasons[1].Position != 1 || p.Seasons[1].Record.Points != 6 {
+			t.Fatalf("seasons %+v", p.Seasons)
+		}
+		// the drawn event has the clubs level on points and goals, so the
+		// name decides: Lions first
+		if len(p.Trophies) != 2 {
+			t.Fatalf("trophies %+v", p.Trophies)
+		}
+		if len(p.HeadToHead) != 1 {
+			t.Fatalf("head-to-head %+v", p.HeadToHead)
+		}
+		h := p.HeadToHead[0]
+		if h.Opponent.Name != "Tigers" || h.Played != 3 || h.Wins != 2 || h.Draws != 1 || h.GF != 6 || h.GA != 2 {
+			t.Fatalf("head-to-head %+v", h)
+		}
+	})
+}
+
+func TestMergeMovesClubMemberships(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		ann := *f.homePlayers[0].PersonID
+		_, twin := secondEvent(t, f, "Ann", nil)
+		lions, tigers := models.Club{Name: "Lions"}, models.Club{Name: "Tigers"}
+		must(t, svc.Clubs.Create(&lions, nil))
+		must(t, svc.Clubs.Create(&tigers, nil))
+		must(t, svc.Clubs.AddMember(lions.ID, ann))
+		must(t, svc.Clubs.AddMember(lions.ID, *twin.PersonID))
+		must(t, svc.Clubs.AddMember(tigers.ID, *twin.PersonID))
+
+		_, err := svc.People.Merge(ann, []uint{*twin.PersonID})
+		must(t, err)
+		for _, id := range []uint{lions.ID, tigers.ID} {
+			club, err := svc.Clubs.Get(id)
+			must(t, err)
+			if len(club.Roster) != 1 || club.Roster[0].ID != ann {
+				t.Fatalf("%s roster after merge %+v", club.Name, club.Roster)
+			}
+		}
+	})
+}
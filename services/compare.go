@@ -0,0 +1,315 @@
+package services
+
+import (
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+type CompareService interface {
+	// Teams compares the sides of two event teams over every event: a side
+	// is all teams of the same club, or of the same name without one
+	Teams(aID, bID uint) (*TeamComparison, error)
+	// Players compares two people: their totals side by side and the games
+	// their teams played against each other
+	Players(aID, bID uint) (*PlayerComparison, error)
+}
+
+// Meeting is one game between the two sides, scored from A's point of view
+type Meeting struct {
+	GameID  uint
+	EventID uint
+	Event   string
+	Date    string
+	ATeam   string
+	BTeam   string
+	AGoals  int
+	BGoals  int
+}
+
+type MeetingRecord struct {
+	Played int
+	AWins  int
+	Draws  int
+	BWins  int
+	AGoals int
+	BGoals int
+}
+
+func (r *MeetingRecord) add(m Meeting) {
+	r.Played++
+	r.AGoals += m.AGoals
+	r.BGoals += m.BGoals
+	switch {
+	case m.AGoals > m.BGoals:
+		r.AWins++
+	case m.AGoals < m.BGoals:
+		r.BWins++
+	default:
+		r.Draws++
+	}
+}
+
+type TeamComparison struct {
+	A, B     models.Team
+	Record   MeetingRecord
+	Meetings []Meeting // newest first
+}
+
+// PlayerLine counts what a player did; Goals include penalties
+type PlayerLine struct {
+	Games     int
+	Goals     int
+	Penalties int
+	OwnGoals  int
+	Assists   int
+}
+
+type ComparedPlayer struct {
+	Person models.Person
+	Total  PlayerLine // every game of the career
+	Versus PlayerLine // only the meetings with the other player
+}
+
+// PlayerMeeting adds how many goals each player scored in the game
+type PlayerMeeting struct {
+	Meeting
+	AScored int
+	BScored int
+}
+
+type PlayerComparison struct {
+	A, B     ComparedPlayer
+	Record   MeetingRecord
+	Meetings []PlayerMeeting // newest first
+}
+
+type compareService struct {
+	db *gorm.DB
+}
+
+func (s *compareService) Teams(aID, bID uint) (*TeamComparison, error) {
+	var a, b models.Team
+	if err := s.db.First(&a, aID).Error; err != nil {
+		return nil, lookup(err, "Team")
+	}
+	if err := s.db.First(&b, bID).Error; err != nil {
+		return nil, lookup(err, "Team")
+	}
+	if sideKey(a) == sideKey(b) {
+		return nil, invalid("Pick two different teams")
+	}
+	aTeams, err := s.sideTeams(a)
+	if err != nil {
+		return nil, err
+	}
+	bTeams, err := s.sideTeams(b)
+	if err != nil {
+		return nil, err
+	}
+	meetings, err := meetings(s.db, aTeams, bTeams)
+	if err != nil {
+		return nil, err
+	}
+	out := &TeamComparison{A: a, B: b, Meetings: meetings}
+	for _, m := range meetings {
+		out.Record.add(m)
+	}
+	return out, nil
+}
+
+// sideTeams returns the live teams (in live events) of the team's side
+func (s *compareService) sideTeams(team models.Team) ([]uint, error) {
+	var teams []models.Team
+	q := s.db.Joins("JOIN events ON events.id = teams.event_id AND events.deleted_at IS NULL")
+	if team.ClubID != nil {
+		q = q.Where("teams.club_id = ?", *team.ClubID)
+	} else {
+		q = q.Where("teams.club_id IS NULL")
+	}
+	if err := q.Find(&teams).Error; err != nil {
+		return nil, err
+	}
+	key := sideKey(team)
+	var ids []uint
+	for _, t := range teams {
+		if sideKey(t) == key {
+			ids = append(ids, t.ID)
+		}
+	}
+	return ids, nil
+}
+
+func (s *compareService) Players(aID, bID uint) (*PlayerComparison, error) {
+	if aID == bID {
+		return nil, invalid("Pick two different players")
+	}
+	var a, b models.Person
+	if err := s.db.First(&a, aID).Error; err != nil {
+		return nil, lookup(err, "Person")
+	}
+	if err := s.db.First(&b, bID).Error; err != nil {
+		return nil, lookup(err, "Person")
+	}
+	aPlayers, aTeams, err := s.entries(a.ID)
+	if err != nil {
+		return nil, err
+	}
+	bPlayers, bTeams, err := s.entries(b.ID)
+	if err != nil {
+		return nil, err
+	}
+	games, err := meetings(s.db, aTeams, bTeams)
+	if err != nil {
+		return nil, err
+	}
+	out := &PlayerComparison{A: ComparedPlayer{Person: a}, B: ComparedPlayer{Person: b}, Meetings: []PlayerMeeting{}}
+	gameIDs := make([]uint, len(games))
+	for i, m := range games {
+		gameIDs[i] = m.GameID
+		out.Record.add(m)
+	}
+
+	played, err := playerGames(s.db, append(append([]uint{}, aPlayers...), bPlayers...))
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range aPlayers {
+		out.A.Total.Games += played[id]
+	}
+	for _, id := range bPlayers {
+		out.B.Total.Games += played[id]
+	}
+	out.A.Versus.Games, out.B.Versus.Games = len(games), len(games)
+
+	byGame := make(map[uint]*PlayerMeeting, len(games))
+	for _, m := range games {
+		out.Meetings = append(out.Meetings, PlayerMeeting{Meeting: m})
+	}
+	for i := range out.Meetings {
+		byGame[out.Meetings[i].GameID] = &out.Meetings[i]
+	}
+	count := func(playerIDs []uint, total, versus *PlayerLine, scored func(*PlayerMeeting, int)) error {
+		rows, err := playerStatCounts(s.db, playerIDs)
+		if err != nil {
+			return err
+		}
+		for _, r := range rows {
+			total.add(r.Type, r.Count)
+			if m := byGame[r.GameID]; m != nil {
+				versus.add(r.Type, r.Count)
+				if r.Type == models.StatTypeGoal || r.Type == models.StatTypePenalty {
+					scored(m, r.Count)
+				}
+			}
+		}
+		return nil
+	}
+	if err := count(aPlayers, &out.A.Total, &out.A.Versus, func(m *PlayerMeeting, n int) { m.AScored += n }); err != nil {
+		return nil, err
+	}
+	if err := count(bPlayers, &out.B.Total, &out.B.Versus, func(m *PlayerMeeting, n int) { m.BScored += n }); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// entries returns the person's live roster entries and their teams
+func (s *compareService) entries(personID uint) (playerIDs, teamIDs []uint, err error) {
+	var players []models.Player
+	err = s.db.Joins("JOIN teams ON teams.id = players.team_id AND teams.deleted_at IS NULL").
+		Joins("JOIN events ON events.id = teams.event_id AND events.deleted_at IS NULL").
+		Where("players.person_id = ?", personID).Find(&players).Error
+	for _, p := range players {
+		playerIDs = append(playerIDs, p.ID)
+		teamIDs = append(teamIDs, p.TeamID)
+	}
+	return playerIDs, teamIDs, err
+}
+
+func (l *PlayerLine) add(statType string, n int) {
+	switch statType {
+	case models.StatTypeGoal:
+		l.Goals += n
+	case models.StatTypePenalty:
+		l.Goals += n
+		l.Penalties += n
+	case models.StatTypeOwnGoal:
+		l.OwnGoals += n
+	case models.StatTypeAssist:
+		l.Assists += n
+	}
+}
+
+type gameStatCount struct {
+	GameID uint
+	Type   string
+	Count  int
+}
+
+// playerStatCounts counts the players' stats per game and type
+func playerStatCounts(db *gorm.DB, playerIDs []uint) ([]gameStatCount, error) {
+	var rows []gameStatCount
+	if len(playerIDs) == 0 {
+		return rows, nil
+	}
+	err := db.Model(&models.GamePlayerStat{}).
+		Select("game_player_stats.game_id, game_player_stats.type, COUNT(*) AS count").
+		Joins("JOIN games ON games.id = game_player_stats.game_id AND games.deleted_at IS NULL").
+		Where("game_player_stats.player_id IN ?", playerIDs).
+		Group("game_player_stats.game_id, game_player_stats.type").
+		Scan(&rows).Error
+	return rows, err
+}
+
+// meetings lists the live games between a team of aTeams and one of bTeams,
+// newest event first. A team on both sides (two people who once played
+// together) only counts when the opponent is on the other side.
+func meetings(db *gorm.DB, aTeams, bTeams []uint) ([]Meeting, error) {
+	out := []Meeting{}
+	if len(aTeams) == 0 || len(bTeams) == 0 {
+		return out, nil
+	}
+	var rows []struct {
+		models.Game
+		Event    string
+		Date     string
+		HomeName string
+		AwayName string
+	}
+	err := db.Model(&models.Game{}).
+		Select(`games.*, events.name AS event, events.date AS date,
+			home.name AS home_name, away.name AS away_name`).
+		Joins("JOIN events ON events.id = games.event_id AND events.deleted_at IS NULL").
+		Joins("JOIN teams home ON home.id = games.home_team_id").
+		Joins("JOIN teams away ON away.id = games.away_team_id").
+		Where("((games.home_team_id IN ? AND games.away_team_id IN ?) OR (games.home_team_id IN ? AND games.away_team_id IN ?))",
+			aTeams, bTeams, bTeams, aTeams).
+		Order("events.date DESC, events.id DESC, games.id DESC").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	inA := make(map[uint]bool, len(aTeams))
+	for _, id := range aTeams {
+		inA[id] = true
+	}
+	inB := make(map[uint]bool, len(bTeams))
+	for _, id := range bTeams {
+		inB[id] = true
+	}
+	for _, r := range rows {
+		m := Meeting{GameID: r.ID, EventID: r.EventID, Event: r.Event, Date: r.Date}
+		switch {
+		case inA[r.HomeTeamID] && inB[r.AwayTeamID]:
+			m.ATeam, m.BTeam = r.HomeName, r.AwayName
+			m.AGoals, m.BGoals = r.HomeTeamGoals, r.AwayTeamGoals
+		case inA[r.AwayTeamID] && inB[r.HomeTeamID]:
+			m.ATeam, m.BTeam = r.AwayName, r.HomeName
+			m.AGoals, m.BGoals = r.AwayTeamGoals, r.HomeTeamGoals
+		default:
+			continue
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+func TestCompare(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		ann, dan := f.homePlayers[0], f.awayPlayers[0]
+		game := f.game(t) // Home 2:1 Away
+		f.goal(t, game.ID, ann, nil)
+		f.goal(t, game.ID, ann, nil)
+		f.goal(t, game.ID, dan, nil)
+
+		// the sides meet again at 0:0; Ann plays there, Dan does not
+		event := models.Event{Name: "Cup 2", Date: "2024-07-01", EventURL: "https://example.com"}
+		must(t, svc.Events.Create(&event))
+		home, away := models.Team{Name: "Home", EventID: event.ID}, models.Team{Name: "Away", EventID: event.ID}
+		must(t, svc.Teams.Create(&home))
+		must(t, svc.Teams.Create(&away))
+		must(t, svc.Players.Create(&models.Player{Name: "Ann", TeamID: home.ID, PersonID: ann.PersonID}))
+		must(t, svc.Games.Create(&models.Game{EventID: event.ID, HomeTeamID: home.ID, AwayTeamID: away.ID}))
+
+		teams, err := svc.Compare.Teams(f.home.ID, away.ID)
+		must(t, err)
+		if r := teams.Record; r.Played != 2 || r.AWins != 1 || r.Draws != 1 || r.AGoals != 2 || r.BGoals != 1 {
+			t.Fatalf("team record %+v", r)
+		}
+		if teams.Meetings[0].EventID != event.ID {
+			t.Fatalf("meetings %+v, want the newest first", teams.Meetings)
+		}
+		_, err = svc.Compare.Teams(f.home.ID, home.ID)
+		wantKind(t, err, ErrValidation)
+
+		players, err := svc.Compare.Players(*ann.PersonID, *dan.PersonID)
+		must(t, err)
+		if players.Record.Played != 1 || len(players.Meetings) != 1 || players.Meetings[0].AScored != 2 || players.Meetings[0].BScored != 1 {
+			t.Fatalf("player meetings %+v, record %+v", players.Meetings, players.Record)
+		}
+		if a := players.A; a.Total.Games != 2 || a.Total.Goals != 2 || a.Versus.Games != 1 || a.Versus.Goals != 2 {
+			t.Fatalf("Ann's lines %+v", a)
+		}
+		_, err = svc.Compare.Players(*ann.PersonID, *ann.PersonID)
+		wantKind(t, err, ErrValidation)
+	})
+}
@@ -0,0 +1,490 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+type DrawService interface {
+	// Pool returns the event's pool sorted by name
+	Pool(eventID uint) ([]models.PoolPlayer, error)
+	// AddToPool adds someone to the event's pool; a linked person gives the
+	// name when none is set
+	AddToPool(p *models.PoolPlayer) error
+	// UpdatePoolPlayer applies the non-zero changes
+	UpdatePoolPlayer(id uint, changes models.PoolPlayer) (*models.PoolPlayer, error)
+	RemoveFromPool(id uint) (*models.PoolPlayer, error)
+	// Draw splits the pool into teams without saving anything. The same pool
+	// and options, seed included, always give the same draw; a new seed
+	// re-rolls it. The returned options carry the assignment to commit.
+	Draw(eventID uint, opts DrawOptions) (*Draw, error)
+	// Commit saves the previewed assignment as new teams and players of the
+	// event; it is a conflict if the pool or ratings changed since, so the
+	// options no longer give that draw
+	Commit(eventID uint, opts DrawOptions) ([]models.Team, error)
+}
+
+// Draw modes
+const (
+	DrawRandom   = "random"
+	DrawBalanced = "balanced"
+)
+
+type DrawOptions struct {
+	Teams int    `form:"teams" json:"teams"`
+	Mode  string `form:"mode" json:"mode"` // DrawRandom or DrawBalanced
+	Seed  int64  `form:"seed" json:"seed"` // 0 picks a new one
+	// Assignment is the pool IDs of each team as previewed; Draw fills it
+	// in and Commit checks it
+	Assignment [][]uint `form:"-" json:"assignment,omitempty"`
+}
+
+type Draw struct {
+	Options DrawOptions // with the seed that was used
+	Teams   []DrawTeam
+	// Spread is the strength gap between the strongest and weakest team
+	Spread float64
+}
+
+type DrawTeam struct {
+	Name     string
+	Players  []DrawPlayer
+	Strength float64
+}
+
+type DrawPlayer struct {
+	PoolID   uint
+	PersonID *uint
+	Name     string
+	Position string
+	Skill    int
+	Form     float64 // career goals + assists per game, if linked to a person
+	Rating   int     // Elo rating, if linked to a person
+	Strength float64
+}
+
+// A player's strength is their skill plus a bonus for their scoring record
+// and one for their Elo rating, each capped so a few lucky games don't
+// outweigh the skill
+const (
+	formWeight   = 2.0
+	maxFormBonus = 3.0
+	// a point of strength per this many rating points above or below 1500
+	ratingScale    = 100.0
+	maxRatingBonus = 3.0
+	// balanced draws order players by strength give or take this much, so
+	// re-rolls mix players of similar strength
+	drawJitter = 1.0
+)
+
+type drawService struct {
+	db      *gorm.DB
+	cache   *eventCache
+	ratings RatingService
+}
+
+func (s *drawService) Pool(eventID uint) ([]models.PoolPlayer, error) {
+	var pool []models.PoolPlayer
+	err := s.db.Where("event_id = ?", eventID).Order("name ASC").Find(&pool).Error
+	return pool, err
+}
+
+func (s *drawService) AddToPool(p *models.PoolPlayer) error {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.EventID == 0 {
+		return invalid("EventID required")
+	}
+	if err := s.db.First(&models.Event{}, p.EventID).Error; err != nil {
+		return lookup(err, "Event")
+	}
+	if p.PersonID != nil && *p.PersonID == 0 {
+		p.PersonID = nil
+	}
+	if p.PersonID != nil {
+		var person models.Person
+		if err := s.db.First(&person, *p.PersonID).Error; err != nil {
+			return invalidLookup(err, "Person not found")
+		}
+		if p.Name == "" {
+			p.Name = person.Name
+		}
+	}
+	if p.Name == "" {
+		return invalid("Name or person required")
+	}
+	if p.Skill == 0 {
+		p.Skill = 5
+	}
+	if err := checkPoolDetails(*p); err != nil {
+		return err
+	}
+	if err := s.checkName(p.EventID, p.Name, 0); err != nil {
+		return err
+	}
+	return write(s.db.Create(p).Error, "Pool player")
+}
+
+func (s *drawService) UpdatePoolPlayer(id uint, changes models.PoolPlayer) (*models.PoolPlayer, error) {
+	var existing models.PoolPlayer
+	if err := s.db.First(&existing, id).Error; err != nil {
+		return nil, lookup(err, "Pool player")
+	}
+	changes.Name = strings.TrimSpace(changes.Name)
+	if err := checkPoolDetails(changes); err != nil {
+		return nil, err
+	}
+	if changes.Name != "" && changes.Name != existing.Name {
+		if err := s.checkName(existing.EventID, changes.Name, id); err != nil {
+			return nil, err
+		}
+	}
+	// the event and person stay; remove and re-add to change them
+	changes.EventID, changes.PersonID = 0, nil
+	if err := s.db.Model(&existing).Updates(changes).Error; err != nil {
+		return nil, write(err, "Pool player")
+	}
+	return &existing, nil
+}
+
+func (s *drawService) RemoveFromPool(id uint) (*models.PoolPlayer, error) {
+	var p models.PoolPlayer
+	if err := s.db.First(&p, id).Error; err != nil {
+		return nil, lookup(err, "Pool player")
+	}
+	if err := s.db.Delete(&p).Error; err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (s *drawService) checkName(eventID uint, name string, self uint) error {
+	var existing models.PoolPlayer
+	res := s.db.Where("event_id = ? AND name = ?", eventID, name).Limit(1).Find(&existing)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 && existing.ID != self {
+		return conflict("%s is already in the pool", name)
+	}
+	return nil
+}
+
+// checkPoolDetails validates the skill and position that are set
+func checkPoolDetails(p models.PoolPlayer) error {
+	if p.Skill != 0 && (p.Skill < 1 || p.Skill > 10) {
+		return invalid("Skill must be between 1 and 10")
+	}
+	if p.Position != "" && !isChoice(Positions, p.Position) {
+		return invalid("Position must be GK, DF, MF or FW")
+	}
+	return nil
+}
+
+func (s *drawService) Draw(eventID uint, opts DrawOptions) (*Draw, error) {
+	if err := s.db.First(&models.Event{}, eventID).Error; err != nil {
+		return nil, lookup(err, "Event")
+	}
+	if opts.Mode == "" {
+		opts.Mode = DrawBalanced
+	}
+	if opts.Mode != DrawRandom && opts.Mode != DrawBalanced {
+		return nil, invalid("Mode must be random or balanced")
+	}
+	pool, err := s.Pool(eventID)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Teams < 2 {
+		return nil, invalid("Draw at least 2 teams")
+	}
+	if len(pool) < opts.Teams {
+		return nil, invalid("The pool has %d players, too few for %d teams", len(pool), opts.Teams)
+	}
+	opts.Assignment = nil
+	if opts.Seed == 0 {
+		opts.Seed = time.Now().UnixNano()%1_000_000_000 + 1
+	}
+	ratings, err := s.ratings.Current()
+	if err != nil {
+		return nil, err
+	}
+	players, err := drawPlayers(s.db, ratings, pool)
+	if err != nil {
+		return nil, err
+	}
+	names, err := teamNames(s.db, eventID, opts.Teams)
+	if err != nil {
+		return nil, err
+	}
+
+	rng := rand.New(rand.NewSource(opts.Seed))
+	var teams []DrawTeam
+	if opts.Mode == DrawRandom {
+		teams = dealRandom(players, names, rng)
+	} else {
+		teams = dealBalanced(players, names, rng)
+	}
+	d := &Draw{Options: opts, Teams: teams}
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for i := range teams {
+		ids := make([]uint, len(teams[i].Players))
+		for j, p := range teams[i].Players {
+			ids[j] = p.PoolID
+		}
+		d.Options.Assignment = append(d.Options.Assignment, ids)
+		teams[i].Strength = math.Round(teams[i].Strength*100) / 100
+		lo, hi = math.Min(lo, teams[i].Strength), math.Max(hi, teams[i].Strength)
+	}
+	d.Spread = math.Round((hi-lo)*100) / 100
+	return d, nil
+}
+
+func (s *drawService) Commit(eventID uint, opts DrawOptions) ([]models.Team, error) {
+	if opts.Seed == 0 || len(opts.Assignment) == 0 {
+		return nil, invalid("Preview the draw before saving it")
+	}
+	d, err := s.Draw(eventID, opts)
+	if err != nil {
+		return nil, err
+	}
+	if !sameAssignment(d.Options.Assignment, opts.Assignment) {
+		return nil, conflict("The pool or the ratings changed since the preview; preview the draw again")
+	}
+	var names []string
+	for _, t := range d.Teams {
+		for _, p := range t.Players {
+			names = append(names, p.Name)
+		}
+	}
+	var taken []string
+	if err := s.db.Model(&models.Player{}).
+		Joins("JOIN teams ON teams.id = players.team_id AND teams.deleted_at IS NULL").
+		Where("teams.event_id = ? AND players.name IN ?", eventID, names).
+		Order("players.name ASC").
+		Pluck("players.name", &taken).Error; err != nil {
+		return nil, err
+	}
+	if len(taken) > 0 {
+		return nil, blocked(taken, "Already in a team of this event")
+	}
+
+	var teams []models.Team
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		for _, dt := range d.Teams {
+			team := models.Team{EventID: eventID, Name: dt.Name}
+			if err := tx.Create(&team).Error; err != nil {
+				return err
+			}
+			for i, p := range dt.Players {
+				player := models.Player{Name: p.Name, TeamID: team.ID, PersonID: p.PersonID,
+					Position: p.Position, SortOrder: i + 1}
+				if err := linkPerson(tx, &player); err != nil {
+					return err
+				}
+				if err := tx.Create(&player).Error; err != nil {
+					return err
+				}
+				team.Players = append(team.Players, player)
+			}
+			teams = append(teams, team)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, write(err, "Team")
+	}
+	s.cache.invalidate(eventID)
+	return teams, nil
+}
+
+// sameAssignment tells whether two draws put the same pool players in the
+// same teams, in the same order
+func sameAssignment(a, b [][]uint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if len(a[i]) != len(b[i]) {
+			return false
+		}
+		for j := range a[i] {
+			if a[i][j] != b[i][j] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// drawPlayers rates the pool: skill plus the scoring form of the linked
+// person over every event they played in and their Elo rating
+func drawPlayers(db *gorm.DB, ratings map[uint]float64, pool []models.PoolPlayer) ([]DrawPlayer, error) {
+	var personIDs []uint
+	for _, p := range pool {
+		if p.PersonID != nil {
+			personIDs = append(personIDs, *p.PersonID)
+		}
+	}
+	form := make(map[uint]float64)
+	if len(personIDs) > 0 {
+		var entries []models.Player
+		if err := db.Select("id", "person_id").Where("person_id IN ?", personIDs).Find(&entries).Error; err != nil {
+			return nil, err
+		}
+		playerIDs := make([]uint, len(entries))
+		for i, e := range entries {
+			playerIDs[i] = e.ID
+		}
+		tallies, err := playerTallies(db, playerIDs)
+		if err != nil {
+			return nil, err
+		}
+		played, err := playerGames(db, playerIDs)
+		if err != nil {
+			return nil, err
+		}
+		involved, games := make(map[uint]int), make(map[uint]int)
+		for _, e := range entries {
+			t := tallies[e.ID]
+			involved[*e.PersonID] += t.Goals + t.Assists
+			games[*e.PersonID] += played[e.ID]
+		}
+		for id, n := range games {
+			if n > 0 {
+				form[id] = float64(involved[id]) / float64(n)
+			}
+		}
+	}
+	out := make([]DrawPlayer, len(pool))
+	for i, p := range pool {
+		dp := DrawPlayer{PoolID: p.ID, PersonID: p.PersonID, Name: p.Name, Position: p.Position, Skill: p.Skill}
+		rating := initialRating
+		if p.PersonID != nil {
+			dp.Form = math.Round(form[*p.PersonID]*100) / 100
+			if r, ok := ratings[*p.PersonID]; ok {
+				rating = r
+			}
+			dp.Rating = int(math.Round(rating))
+		}
+		bonus := math.Max(-maxRatingBonus, math.Min((rating-initialRating)/ratingScale, maxRatingBonus))
+		dp.Strength = math.Round((float64(p.Skill)+math.Min(formWeight*dp.Form, maxFormBonus)+bonus)*100) / 100
+		out[i] = dp
+	}
+	return out, nil
+}
+
+// teamNames picks "Team 1", "Team 2", ... skipping names the event uses
+func teamNames(db *gorm.DB, eventID uint, n int) ([]string, error) {
+	var existing []string
+	if err := db.Model(&models.Team{}).Where("event_id = ?", eventID).Pluck("name", &existing).Error; err != nil {
+		return nil, err
+	}
+	used := make(map[string]bool, len(existing))
+	for _, name := range existing {
+		used[name] = true
+	}
+	var out []string
+	for i := 1; len(out) < n; i++ {
+		if name := fmt.Sprintf("Team %d", i); !used[name] {
+			out = append(out, name)
+		}
+	}
+	return out, nil
+}
+
+// positionRank orders goalkeepers first so every team gets one while they
+// last, then outfield positions, then players without one
+func positionRank(position string) int {
+	for i, c := range Positions {
+		if c.Value == position {
+			return i
+		}
+	}
+	return len(Positions)
+}
+
+// dealRandom shuffles the pool and deals it round the teams position by
+// position, so team sizes differ by one at most and positions spread out
+func dealRandom(players []DrawPlayer, names []string, rng *rand.Rand) []DrawTeam {
+	rng.Shuffle(len(players), func(i, j int) { players[i], players[j] = players[j], players[i] })
+	sort.SliceStable(players, func(i, j int) bool {
+		return positionRank(players[i].Position) < positionRank(players[j].Position)
+	})
+	teams := make([]DrawTeam, len(names))
+	for i := range teams {
+		teams[i].Name = names[i]
+	}
+	next := rng.Intn(len(teams))
+	for _, p := range players {
+		t := &teams[next%len(teams)]
+		t.Players = append(t.Players, p)
+		t.Strength += p.Strength
+		next++
+	}
+	return teams
+}
+
+// dealBalanced hands out goalkeepers first, then everyone from strongest to
+// weakest, each to the weakest of the smallest teams, preferring a team
+// without that position yet
+func dealBalanced(players []DrawPlayer, names []string, rng *rand.Rand) []DrawTeam {
+	jitter := make(map[uint]float64, len(players))
+	for _, p := range players {
+		jitter[p.PoolID] = rng.Float64() * drawJitter
+	}
+	sort.SliceStable(players, func(i, j int) bool {
+		a, b := players[i], players[j]
+		if ga, gb := a.Position == "GK", b.Position == "GK"; ga != gb {
+			return ga
+		}
+		return a.Strength+jitter[a.PoolID] > b.Strength+jitter[b.PoolID]
+	})
+	teams := make([]DrawTeam, len(names))
+	for i := range teams {
+		teams[i].Name = names[i]
+	}
+	// ties go to a random team rather than always the first
+	order := rng.Perm(len(teams))
+	for _, p := range players {
+		best := -1
+		for _, i := range order {
+			if best < 0 || drawBetter(&teams[i], &teams[best], p.Position) {
+				best = i
+			}
+		}
+		t := &teams[best]
+		t.Players = append(t.Players, p)
+		t.Strength += p.Strength
+	}
+	return teams
+}
+
+// drawBetter tells whether team a should get the next player before team b
+func drawBetter(a, b *DrawTeam, position string) bool {
+	if len(a.Players) != len(b.Players) {
+		return len(a.Players) < len(b.Players)
+	}
+	if position != "" {
+		if na, nb := countPosition(a, position), countPosition(b, position); na != nb {
+			return na < nb
+		}
+	}
+	return a.Strength < b.Strength
+}
+
+func countPosition(t *DrawTeam, position string) int {
+	n := 0
+	for _, p := range t.Players {
+		if p.Position == position {
+			n++
+		}
+	}
+	return n
+}
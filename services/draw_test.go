@@ -0,0 +1,135 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+// fillPool adds eight players to the event's pool, two of them goalkeepers
+func fillPool(t *testing.T, svc *Services, eventID uint) []models.PoolPlayer {
+	t.Helper()
+	var pool []models.PoolPlayer
+	for i, name := range []string{"Gus", "Hal", "Ida", "Jon", "Kim", "Lou", "Max", "Ned"} {
+		p := models.PoolPlayer{EventID: eventID, Name: name, Skill: i + 3}
+		if i < 2 {
+			p.Position = "GK"
+		}
+		must(t, svc.Draws.AddToPool(&p))
+		pool = append(pool, p)
+	}
+	return pool
+}
+
+func TestDraw(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		fillPool(t, svc, f.event.ID)
+		wantKind(t, svc.Draws.AddToPool(&models.PoolPlayer{EventID: f.event.ID, Name: "Gus"}), ErrConflict)
+		wantKind(t, svc.Draws.AddToPool(&models.PoolPlayer{EventID: f.event.ID, Name: "Oz", Skill: 11}), ErrValidation)
+		_, err := svc.Draws.Draw(f.event.ID, DrawOptions{Teams: 9})
+		wantKind(t, err, ErrValidation)
+
+		for _, mode := range []string{DrawBalanced, DrawRandom} {
+			d, err := svc.Draws.Draw(f.event.ID, DrawOptions{Teams: 2, Mode: mode})
+			must(t, err)
+			if d.Options.Seed == 0 || len(d.Options.Assignment) != 2 {
+				t.Fatalf("%s: options %+v", mode, d.Options)
+			}
+			for _, team := range d.Teams {
+				keepers := 0
+				for _, p := range team.Players {
+					if p.Position == "GK" {
+						keepers++
+					}
+				}
+				if len(team.Players) != 4 || keepers != 1 {
+					t.Fatalf("%s: %s has %d players, %d in goal", mode, team.Name, len(team.Players), keepers)
+				}
+			}
+			// the same seed gives the same draw
+			again, err := svc.Draws.Draw(f.event.ID, DrawOptions{Teams: 2, Mode: mode, Seed: d.Options.Seed})
+			must(t, err)
+			if !sameAssignment(again.Options.Assignment, d.Options.Assignment) {
+				t.Fatalf("%s: seed %d gave %v, then %v", mode, d.Options.Seed, d.Options.Assignment, again.Options.Assignment)
+			}
+		}
+
+		// balanced teams end up closer than the skills' spread
+		d, err := svc.Draws.Draw(f.event.ID, DrawOptions{Teams: 2, Seed: 7})
+		must(t, err)
+		if d.Spread > 3 || d.Teams[0].Name != "Team 1" {
+			t.Fatalf("balanced draw %+v", d)
+		}
+	})
+}
+
+func TestDrawCommit(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		pool := fillPool(t, svc, f.event.ID)
+		_, err := svc.Draws.Commit(f.event.ID, DrawOptions{Teams: 2, Seed: 7})
+		wantKind(t, err, ErrValidation)
+
+		d, err := svc.Draws.Draw(f.event.ID, DrawOptions{Teams: 2, Seed: 7})
+		must(t, err)
+		swapped := d.Options
+		swapped.Assignment = [][]uint{d.Options.Assignment[1], d.Options.Assignment[0]}
+		_, err = svc.Draws.Commit(f.event.ID, swapped)
+		wantKind(t, err, ErrConflict)
+
+		// the pool changed since the preview
+		_, err = svc.Draws.UpdatePoolPlayer(pool[7].ID, models.PoolPlayer{Skill: 1})
+		must(t, err)
+		_, err = svc.Draws.Commit(f.event.ID, d.Options)
+		wantKind(t, err, ErrConflict)
+
+		d, err = svc.Draws.Draw(f.event.ID, DrawOptions{Teams: 2, Seed: 7})
+		must(t, err)
+		teams, err := svc.Draws.Commit(f.event.ID, d.Options)
+		must(t, err)
+		if len(teams) != 2 {
+			t.Fatalf("committed %d teams", len(teams))
+		}
+		for i, team := range teams {
+			if team.Name != d.Teams[i].Name || len(team.Players) != len(d.Teams[i].Players) {
+				t.Fatalf("team %s, previewed %s", team.Name, d.Teams[i].Name)
+			}
+			for j, p := range team.Players {
+				if p.Name != d.Teams[i].Players[j].Name || p.SortOrder != j+1 {
+					t.Fatalf("%s player %d is %s, previewed %s", team.Name, j, p.Name, d.Teams[i].Players[j].Name)
+				}
+			}
+		}
+
+		// the same players can't be drawn into the event twice
+		d, err = svc.Draws.Draw(f.event.ID, DrawOptions{Teams: 2, Seed: 7})
+		must(t, err)
+		_, err = svc.Draws.Commit(f.event.ID, d.Options)
+		wantKind(t, err, ErrConflict)
+	})
+}
+
+func TestMergeMovesPoolEntries(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		ann, dan := f.homePlayers[0], f.awayPlayers[0]
+		other, twin := secondEvent(t, f, "ann", nil)
+		// Ann and Dan are both in the first pool; only Dan is in the second
+		must(t, svc.Draws.AddToPool(&models.PoolPlayer{EventID: f.event.ID, PersonID: ann.PersonID}))
+		must(t, svc.Draws.AddToPool(&models.PoolPlayer{EventID: f.event.ID, PersonID: dan.PersonID}))
+		must(t, svc.Draws.AddToPool(&models.PoolPlayer{EventID: other.ID, PersonID: dan.PersonID}))
+		must(t, svc.Draws.AddToPool(&models.PoolPlayer{EventID: other.ID, Name: "Twin", PersonID: twin.PersonID}))
+
+		_, err := svc.People.Merge(*ann.PersonID, []uint{*dan.PersonID, *twin.PersonID})
+		must(t, err)
+		for _, eventID := range []uint{f.event.ID, other.ID} {
+			pool, err := svc.Draws.Pool(eventID)
+			must(t, err)
+			if len(pool) != 1 || *pool[0].PersonID != *ann.PersonID {
+				t.Fatalf("pool of event %d after the merge: %+v", eventID, pool)
+			}
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/yesakov/lukyasha-tracker/database"
+	"gorm.io/gorm"
+)
+
+// Domain error kinds. Handlers map them to HTTP statuses with errors.Is.
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrConflict   = errors.New("conflict")
+	ErrValidation = errors.New("validation failed")
+	// ErrUnauthorized means the caller has to sign in (again)
+	ErrUnauthorized = errors.New("unauthorized")
+)
+
+// Error carries a user-facing message for one of the error kinds; a
+// conflict can also list the records that block the change
+type Error struct {
+	Kind    error
+	Msg     string
+	Blocked []string
+}
+
+func (e *Error) Error() string { return e.Msg }
+func (e *Error) Unwrap() error { return e.Kind }
+
+func notFound(format string, args ...interface{}) error {
+	return &Error{Kind: ErrNotFound, Msg: fmt.Sprintf(format, args...)}
+}
+
+func conflict(format string, args ...interface{}) error {
+	return &Error{Kind: ErrConflict, Msg: fmt.Sprintf(format, args...)}
+}
+
+// blocked is a conflict listing what stands in the way, e.g. the stats of a
+// player about to be deleted
+func blocked(what []string, format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...) + ": " + strings.Join(what, "; ")
+	return &Error{Kind: ErrConflict, Msg: msg, Blocked: what}
+}
+
+func invalid(format string, args ...interface{}) error {
+	return &Error{Kind: ErrValidation, Msg: fmt.Sprintf(format, args...)}
+}
+
+func unauthorized(format string, args ...interface{}) error {
+	return &Error{Kind: ErrUnauthorized, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Message returns the user-facing text of a domain error, or a generic one
+// for unexpected (database) errors so internals don't leak into the UI
+func Message(err error) string {
+	var de *Error
+	if errors.As(err, &de) {
+		return de.Msg
+	}
+	return "Database error"
+}
+
+// Blockers returns the records listed by a blocked conflict, if any
+func Blockers(err error) []string {
+	var de *Error
+	if errors.As(err, &de) {
+		return de.Blocked
+	}
+	return nil
+}
+
+// lookup turns gorm's record-not-found into a domain ErrNotFound
+func lookup(err error, what string) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return notFound("%s not found", what)
+	}
+	return err
+}
+
+// write maps constraint failures on insert/update to domain errors
+func write(err error, what string) error {
+	switch {
+	case err == nil:
+		return nil
+	case database.IsUniqueViolation(err):
+		return conflict("%s already exists", what)
+	case database.IsForeignKeyViolation(err):
+		return invalid("%s references a missing record", what)
+	}
+	return err
+}
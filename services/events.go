@@ -0,0 +1,139 @@
+package services
+
+import (
+	"strings"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+type EventService interface {
+	List() ([]models.Event, error)
+	Get(id uint) (*models.Event, error)
+	Create(event *models.Event) error
+	Update(id uint, changes models.Event) (*models.Event, error)
+	// Delete removes the event with its teams, players, games, stats and
+	// goalkeepers
+	Delete(id uint) error
+	// Teams returns the event's teams with their players loaded
+	Teams(eventID uint) ([]models.Team, error)
+	Games(eventID uint) ([]models.Game, error)
+}
+
+type eventService struct {
+	db    *gorm.DB
+	cache *eventCache
+}
+
+func (s *eventService) List() ([]models.Event, error) {
+	var events []models.Event
+	err := s.db.Order("created_at DESC").Find(&events).Error
+	return events, err
+}
+
+func (s *eventService) Get(id uint) (*models.Event, error) {
+	var event models.Event
+	if err := s.db.First(&event, id).Error; err != nil {
+		return nil, lookup(err, "Event")
+	}
+	return &event, nil
+}
+
+func (s *eventService) Create(event *models.Event) error {
+	event.Name = strings.TrimSpace(event.Name)
+	if event.Name == "" || event.Date == "" || event.EventURL == "" {
+		return invalid("All fields are required")
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(event).Error; err != nil {
+			return err
+		}
+		// every event starts with the default awards
+		awards := defaultAwards(event.ID)
+		return tx.Create(&awards).Error
+	})
+	return write(err, "Event")
+}
+
+func (s *eventService) Update(id uint, changes models.Event) (*models.Event, error) {
+	existing, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(existing).Updates(changes).Error; err != nil {
+		return nil, write(err, "Event")
+	}
+	s.cache.invalidate(existing.ID)
+	return existing, nil
+}
+
+func (s *eventService) Delete(id uint) error {
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Delete stats for games in this event
+		var gameIDs []uint
+		if err := tx.Model(&models.Game{}).Where("event_id = ?", id).Pluck("id", &gameIDs).Error; err != nil {
+			return err
+		}
+		if len(gameIDs) > 0 {
+			if err := tx.Where("game_id IN ?", gameIDs).Delete(&models.GamePlayerStat{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("game_id IN ?", gameIDs).Delete(&models.GameGoalkeeper{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("game_id IN ?", gameIDs).Delete(&models.Prediction{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("game_id IN ?", gameIDs).Delete(&models.MVPVote{}).Error; err != nil {
+				return err
+			}
+		}
+		// Delete games
+		if err := tx.Where("event_id = ?", id).Delete(&models.Game{}).Error; err != nil {
+			return err
+		}
+
+		// Delete players and teams
+		var teamIDs []uint
+		if err := tx.Model(&models.Team{}).Where("event_id = ?", id).Pluck("id", &teamIDs).Error; err != nil {
+			return err
+		}
+		if len(teamIDs) > 0 {
+			if err := tx.Where("to_team_id IN ?", teamIDs).Delete(&models.Transfer{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("team_id IN ?", teamIDs).Delete(&models.Player{}).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("event_id = ?", id).Delete(&models.Award{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("event_id = ?", id).Delete(&models.Team{}).Error; err != nil {
+			return err
+		}
+
+		// Finally delete the event
+		return tx.Delete(&models.Event{}, id).Error
+	})
+	if err != nil {
+		return err
+	}
+	s.cache.invalidate(id)
+	return nil
+}
+
+func (s *eventService) Teams(eventID uint) ([]models.Team, error) {
+	var teams []models.Team
+	err := s.db.Where("event_id = ?", eventID).Preload("Players", rosterOrder).Find(&teams).Error
+	return teams, err
+}
+
+func (s *eventService) Games(eventID uint) ([]models.Game, error) {
+	var games []models.Game
+	err := s.db.Where("event_id = ?", eventID).Find(&games).Error
+	return games, err
+}
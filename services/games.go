@@ -0,0 +1,290 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+type GameService interface {
+	List() ([]models.Game, error)
+	Get(id uint) (*models.Game, error)
+	// Create validates that both teams exist, differ and belong to the event
+	Create(game *models.Game) error
+	Update(id uint, changes models.Game) (*models.Game, error)
+	// Delete removes the game with its stats and goalkeepers
+	Delete(id uint) (*models.Game, error)
+	// SetStatus finishes a game, which feeds it into the ratings, or
+	// reopens it unless it has predictions
+	SetStatus(id uint, status string) (*models.Game, error)
+	// SetKickoff sets or (nil) clears the kick-off time, unless the game is
+	// finished and has predictions
+	SetKickoff(id uint, at *time.Time) (*models.Game, error)
+	// View loads everything the game page needs
+	View(id uint) (*GameView, error)
+}
+
+// TeamGroup is a team with its roster, used for grouped player selects
+type TeamGroup struct {
+	Team    models.Team
+	Players []models.Player
+}
+
+type GameView struct {
+	Event    models.Event
+	Game     models.Game
+	HomeTeam models.Team
+	AwayTeam models.Team
+	AllTeams []TeamGroup
+	GoalRows []GoalRow
+	CardRows []CardRow
+	Keepers  []KeeperSpell
+}
+
+type gameService struct {
+	db    *gorm.DB
+	cache *eventCache
+}
+
+func (s *gameService) List() ([]models.Game, error) {
+	var games []models.Game
+	err := s.db.Find(&games).Error
+	return games, err
+}
+
+func (s *gameService) Get(id uint) (*models.Game, error) {
+	var game models.Game
+	if err := s.db.First(&game, id).Error; err != nil {
+		return nil, lookup(err, "Game")
+	}
+	return &game, nil
+}
+
+func (s *gameService) Create(game *models.Game) error {
+	if game.EventID == 0 || game.HomeTeamID == 0 || game.AwayTeamID == 0 {
+		return invalid("Invalid game data")
+	}
+	if game.HomeTeamID == game.AwayTeamID {
+		return invalid("Teams must be different")
+	}
+	var home, away models.Team
+	if err := s.db.First(&home, game.HomeTeamID).Error; err != nil {
+		return invalidLookup(err, "Home team not found")
+	}
+	if err := s.db.First(&away, game.AwayTeamID).Error; err != nil {
+		return invalidLookup(err, "Away team not found")
+	}
+	if home.EventID != game.EventID || away.EventID != game.EventID {
+		return invalid("Teams must belong to the event")
+	}
+	if game.Status == "" {
+		game.Status = models.GameScheduled
+	}
+	if err := checkStatus(game.Status); err != nil {
+		return err
+	}
+	if err := s.db.Create(game).Error; err != nil {
+		return write(err, "Game")
+	}
+	s.cache.invalidate(game.EventID)
+	return nil
+}
+
+func (s *gameService) Update(id uint, changes models.Game) (*models.Game, error) {
+	existing, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	oldEventID := existing.EventID
+	if changes.Status != "" {
+		if err := checkStatus(changes.Status); err != nil {
+			return nil, err
+		}
+		if err := s.checkReopen(existing, changes.Status); err != nil {
+			return nil, err
+		}
+	}
+	if changes.KickoffAt != nil || changes.HomeTeamGoals != 0 || changes.AwayTeamGoals != 0 {
+		if err := checkSettled(s.db, existing); err != nil {
+			return nil, err
+		}
+	}
+	if changes.Status == models.GameFinished && !existing.Finished() && changes.MVPClosesAt == nil {
+		changes.MVPClosesAt = votingDeadline()
+	}
+	if err := s.db.Model(existing).Updates(changes).Error; err != nil {
+		return nil, write(err, "Game")
+	}
+	s.cache.invalidate(oldEventID, existing.EventID)
+	return existing, nil
+}
+
+func (s *gameService) Delete(id uint) (*models.Game, error) {
+	game, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		return removeGame(tx, game.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.cache.invalidate(game.EventID)
+	return game, nil
+}
+
+func (s *gameService) SetStatus(id uint, status string) (*models.Game, error) {
+	if err := checkStatus(status); err != nil {
+		return nil, err
+	}
+	game, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkReopen(game, status); err != nil {
+		return nil, err
+	}
+	updates := map[string]interface{}{"status": status}
+	if status == models.GameFinished && !game.Finished() {
+		// finishing opens the player of the match vote
+		updates["mvp_closes_at"] = votingDeadline()
+	}
+	if err := s.db.Model(game).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	s.cache.invalidate(game.EventID)
+	return game, nil
+}
+
+func (s *gameService) SetKickoff(id uint, at *time.Time) (*models.Game, error) {
+	game, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSettled(s.db, game); err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(game).Update("kickoff_at", at).Error; err != nil {
+		return nil, err
+	}
+	game.KickoffAt = at
+	return game, nil
+}
+
+// checkReopen keeps a finished game with predictions finished: reopening it
+// would let the tips change once the result is known
+func (s *gameService) checkReopen(game *models.Game, status string) error {
+	if status != models.GameScheduled || !game.Finished() {
+		return nil
+	}
+	tipped, err := hasTips(s.db, game.ID)
+	if err != nil {
+		return err
+	}
+	if tipped {
+		return conflict("This game has predictions, so it can't be reopened")
+	}
+	return nil
+}
+
+// checkSettled keeps the kick-off and score of a finished game with
+// predictions: its tips have been scored against them
+func checkSettled(db *gorm.DB, game *models.Game) error {
+	if !game.Finished() {
+		return nil
+	}
+	tipped, err := hasTips(db, game.ID)
+	if err != nil {
+		return err
+	}
+	if tipped {
+		return conflict("This game is finished and has predictions, so its kick-off and score are final")
+	}
+	return nil
+}
+
+// hasTips tells whether anyone tipped the game
+func hasTips(db *gorm.DB, gameID uint) (bool, error) {
+	var tips int64
+	err := db.Model(&models.Prediction{}).Where("game_id = ?", gameID).Count(&tips).Error
+	return tips > 0, err
+}
+
+func checkStatus(status string) error {
+	if status != models.GameScheduled && status != models.GameFinished {
+		return invalid("Status must be scheduled or finished")
+	}
+	return nil
+}
+
+// removeGame deletes a game with its stats, goalkeepers and guest
+// appearances
+func removeGame(tx *gorm.DB, gameID uint) error {
+	// Delete all stats for this game
+	if err := tx.Where("game_id = ?", gameID).Delete(&models.GamePlayerStat{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("game_id = ?", gameID).Delete(&models.Prediction{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("game_id = ?", gameID).Delete(&models.MVPVote{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("game_id = ?", gameID).Delete(&models.GameGoalkeeper{}).Error; err != nil {
+		return err
+	}
+	// Transfers keep their game ID as the point they took effect
+	if err := tx.Where("game_id = ? AND guest = ?", gameID, true).Delete(&models.Transfer{}).Error; err != nil {
+		return err
+	}
+	return tx.Delete(&models.Game{}, gameID).Error
+}
+
+func (s *gameService) View(id uint) (*GameView, error) {
+	game, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	v := &GameView{Game: *game}
+	if err := s.db.First(&v.Event, game.EventID).Error; err != nil {
+		return nil, lookup(err, "Event")
+	}
+
+	// Load all teams and their players within the event; home and away are among them
+	var allTeams []models.Team
+	if err := s.db.Where("event_id = ?", v.Event.ID).Preload("Players", rosterOrder).Find(&allTeams).Error; err != nil {
+		return nil, err
+	}
+	v.AllTeams = make([]TeamGroup, 0, len(allTeams))
+	for _, t := range allTeams {
+		switch t.ID {
+		case game.HomeTeamID:
+			v.HomeTeam = t
+		case game.AwayTeamID:
+			v.AwayTeam = t
+		}
+		v.AllTeams = append(v.AllTeams, TeamGroup{Team: t, Players: t.Players})
+	}
+
+	if v.GoalRows, err = goalRows(s.db, game.ID); err != nil {
+		return nil, err
+	}
+	if v.CardRows, err = cardRows(s.db, game.ID); err != nil {
+		return nil, err
+	}
+	if v.Keepers, err = keeperSpells(s.db, game.ID); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// invalidLookup reports a missing referenced record as a validation error
+func invalidLookup(err error, msg string) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return invalid("%s", msg)
+	}
+	return err
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+func TestGameValidation(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		wantKind(t, svc.Games.Create(&models.Game{EventID: f.event.ID}), ErrValidation)
+		wantKind(t, svc.Games.Create(&models.Game{EventID: f.event.ID, HomeTeamID: f.home.ID, AwayTeamID: f.home.ID}), ErrValidation)
+		wantKind(t, svc.Games.Create(&models.Game{EventID: f.event.ID, HomeTeamID: f.home.ID, AwayTeamID: 9999}), ErrValidation)
+
+		// both teams must come from the game's event
+		other := models.Event{Name: "League", Date: "2024-07-01", EventURL: "https://example.com"}
+		must(t, svc.Events.Create(&other))
+		stranger := models.Team{Name: "Stranger", EventID: other.ID}
+		must(t, svc.Teams.Create(&stranger))
+		wantKind(t, svc.Games.Create(&models.Game{EventID: f.event.ID, HomeTeamID: f.home.ID, AwayTeamID: stranger.ID}), ErrValidation)
+
+		_, err := svc.Games.Get(9999)
+		wantKind(t, err, ErrNotFound)
+	})
+}
+
+func TestEventDeleteRemovesEverything(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		game := f.game(t)
+		f.goal(t, game.ID, f.homePlayers[0], nil)
+
+		must(t, svc.Events.Delete(f.event.ID))
+		_, err := svc.Games.Get(game.ID)
+		wantKind(t, err, ErrNotFound)
+		_, err = svc.Teams.Get(f.home.ID)
+		wantKind(t, err, ErrNotFound)
+		_, err = svc.Players.Get(f.homePlayers[0].ID)
+		wantKind(t, err, ErrNotFound)
+		wantKind(t, svc.Events.Delete(f.event.ID), ErrNotFound)
+	})
+}
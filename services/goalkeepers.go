@@ -0,0 +1,298 @@
+package services
+
+import (
+	"sort"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+type GoalkeeperService interface {
+	// Spells returns who was in goal for each team, in order of taking over
+	Spells(gameID uint) ([]KeeperSpell, error)
+	// Assign puts a player in goal for a team from a minute (0 = kick-off)
+	Assign(gameID uint, in KeeperInput) error
+	// Unassign removes a goalkeeper change and returns it
+	Unassign(id uint) (*models.GameGoalkeeper, error)
+	// AddSave records a save; without a player it goes to the team's
+	// goalkeeper at that minute
+	AddSave(gameID uint, in SaveInput) error
+}
+
+type KeeperInput struct {
+	TeamID     uint `form:"team_id" json:"team_id"`
+	PlayerID   uint `form:"player_id" json:"player_id"`
+	FromMinute int  `form:"from_minute" json:"from_minute"`
+}
+
+type SaveInput struct {
+	TeamID   uint `form:"team_id" json:"team_id"`
+	PlayerID uint `form:"player_id" json:"player_id"`
+	Minute   int  `form:"minute" json:"minute"`
+}
+
+// KeeperSpell is one goalkeeper's time in goal; ToMinute is where the next
+// goalkeeper took over, 0 when they stayed until the end
+type KeeperSpell struct {
+	ID         uint
+	TeamID     uint
+	Team       string
+	PlayerID   uint
+	Player     string
+	FromMinute int
+	ToMinute   int
+}
+
+// KeeperRow is a goalkeeper's record over an event. Goals are conceded by
+// whoever was in goal at the goal's minute (goals without a minute go to
+// the starting goalkeeper); a clean sheet needs a whole game in goal.
+type KeeperRow struct {
+	PlayerID    uint
+	Player      string
+	Team        string
+	TeamID      uint
+	Games       int
+	CleanSheets int
+	Conceded    int
+	Saves       int // saves plus saved penalties
+	SavePct     int // saves out of saves plus goals conceded, rounded
+}
+
+type goalkeeperService struct {
+	db    *gorm.DB
+	cache *eventCache
+}
+
+func (s *goalkeeperService) Spells(gameID uint) ([]KeeperSpell, error) {
+	return keeperSpells(s.db, gameID)
+}
+
+func keeperSpells(db *gorm.DB, gameID uint) ([]KeeperSpell, error) {
+	rows := []KeeperSpell{}
+	err := db.Table("game_goalkeepers AS k").
+		Select(`k.id, k.team_id, COALESCE(t.name, '') AS team, k.player_id,
+			COALESCE(p.name, '') AS player, k.from_minute`).
+		Joins("LEFT JOIN teams t ON t.id = k.team_id").
+		Joins("LEFT JOIN players p ON p.id = k.player_id").
+		Where("k.game_id = ? AND k.deleted_at IS NULL", gameID).
+		Order("k.team_id ASC, k.from_minute ASC").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range rows {
+		if i+1 < len(rows) && rows[i+1].TeamID == rows[i].TeamID {
+			rows[i].ToMinute = rows[i+1].FromMinute
+		}
+	}
+	return rows, nil
+}
+
+func (s *goalkeeperService) Assign(gameID uint, in KeeperInput) error {
+	game, err := s.game(gameID, in.TeamID)
+	if err != nil {
+		return err
+	}
+	if in.FromMinute < 0 || in.FromMinute > 200 {
+		return invalid("Minute must be between 0 and 200")
+	}
+	var player models.Player
+	if err := s.db.First(&player, in.PlayerID).Error; err != nil {
+		return invalidLookup(err, "Player not found")
+	}
+	spell := models.GameGoalkeeper{GameID: game.ID, TeamID: in.TeamID, PlayerID: player.ID, FromMinute: in.FromMinute}
+	if err := s.db.Create(&spell).Error; err != nil {
+		return write(err, "A goalkeeper change at that minute")
+	}
+	s.cache.invalidate(game.EventID)
+	return nil
+}
+
+func (s *goalkeeperService) Unassign(id uint) (*models.GameGoalkeeper, error) {
+	var spell models.GameGoalkeeper
+	if err := s.db.First(&spell, id).Error; err != nil {
+		return nil, lookup(err, "Goalkeeper")
+	}
+	if err := s.db.Delete(&spell).Error; err != nil {
+		return nil, err
+	}
+	s.cache.invalidateGame(s.db, spell.GameID)
+	return &spell, nil
+}
+
+func (s *goalkeeperService) AddSave(gameID uint, in SaveInput) error {
+	game, err := s.game(gameID, in.TeamID)
+	if err != nil {
+		return err
+	}
+	if in.Minute < 0 {
+		in.Minute = 0
+	}
+	if in.Minute > 200 {
+		in.Minute = 200
+	}
+	if in.PlayerID == 0 {
+		var spell models.GameGoalkeeper
+		res := s.db.Where("game_id = ? AND team_id = ? AND from_minute <= ?", game.ID, in.TeamID, in.Minute).
+			Order("from_minute DESC").Limit(1).Find(&spell)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return invalid("No goalkeeper assigned for this team")
+		}
+		in.PlayerID = spell.PlayerID
+	} else if err := s.db.First(&models.Player{}, in.PlayerID).Error; err != nil {
+		return invalidLookup(err, "Goalkeeper not found")
+	}
+	save := models.GamePlayerStat{PlayerID: in.PlayerID, GameID: game.ID, TeamID: in.TeamID, Type: models.StatTypeSave, Minute: in.Minute}
+	if err := s.db.Create(&save).Error; err != nil {
+		return err
+	}
+	s.cache.invalidate(game.EventID)
+	return nil
+}
+
+// game loads the game and checks that the team played in it
+func (s *goalkeeperService) game(gameID, teamID uint) (*models.Game, error) {
+	var game models.Game
+	if err := s.db.First(&game, gameID).Error; err != nil {
+		return nil, lookup(err, "Game")
+	}
+	if teamID != game.HomeTeamID && teamID != game.AwayTeamID {
+		return nil, invalid("Team did not play in this game")
+	}
+	return &game, nil
+}
+
+// keeperStats builds the goalkeeper leaderboard of an event; a non-zero
+// teamID keeps only the keepers whose latest spell was for that team
+func keeperStats(db *gorm.DB, eventID, teamID uint) ([]KeeperRow, error) {
+	out := []KeeperRow{}
+	var spells []struct {
+		models.GameGoalkeeper
+		Player string
+		Team   string
+	}
+	err := db.Table("game_goalkeepers AS k").
+		Select(`k.*, COALESCE(p.name, '') AS player, COALESCE(t.name, '') AS team`).
+		Joins("JOIN games ON games.id = k.game_id AND games.deleted_at IS NULL").
+		Joins("LEFT JOIN players p ON p.id = k.player_id").
+		Joins("LEFT JOIN teams t ON t.id = k.team_id").
+		Where("games.event_id = ? AND k.deleted_at IS NULL", eventID).
+		Order("k.game_id ASC, k.team_id ASC, k.from_minute ASC").
+		Scan(&spells).Error
+	if err != nil || len(spells) == 0 {
+		return out, err
+	}
+	var games []models.Game
+	if err := db.Where("event_id = ?", eventID).Find(&games).Error; err != nil {
+		return nil, err
+	}
+	var stats []models.GamePlayerStat
+	err = db.Model(&models.GamePlayerStat{}).
+		Select("game_player_stats.*").
+		Joins("JOIN games ON games.id = game_player_stats.game_id AND games.deleted_at IS NULL").
+		Where("games.event_id = ? AND game_player_stats.type IN ?", eventID, []string{models.StatTypeGoal,
+			models.StatTypePenalty, models.StatTypeOwnGoal, models.StatTypeSave, models.StatTypePenaltySaved}).
+		Find(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make(map[uint]*KeeperRow)
+	type side struct{ game, team uint }
+	inGoal := make(map[side][]int)         // indexes into spells, by starting minute
+	played := make(map[side]map[uint]bool) // distinct goalkeepers per side
+	for i, sp := range spells {
+		r := rows[sp.PlayerID]
+		if r == nil {
+			r = &KeeperRow{PlayerID: sp.PlayerID, Player: sp.Player, Team: sp.Team, TeamID: sp.TeamID}
+			rows[sp.PlayerID] = r
+		}
+		// a keeper who played for a new team is listed with the latest one
+		r.Team, r.TeamID = sp.Team, sp.TeamID
+		k := side{sp.GameID, sp.TeamID}
+		inGoal[k] = append(inGoal[k], i)
+		if played[k] == nil {
+			played[k] = make(map[uint]bool)
+		}
+		played[k][sp.PlayerID] = true
+	}
+	// keeperAt is who was in goal for the team at the minute (0 if nobody)
+	keeperAt := func(k side, minute int) uint {
+		var keeper uint
+		for _, i := range inGoal[k] {
+			if spells[i].FromMinute <= minute || keeper == 0 {
+				keeper = spells[i].PlayerID
+			}
+		}
+		return keeper
+	}
+	gamesByID := make(map[uint]models.Game, len(games))
+	for _, g := range games {
+		gamesByID[g.ID] = g
+	}
+	conceded := make(map[side]int)
+	for _, st := range stats {
+		g, ok := gamesByID[st.GameID]
+		if !ok {
+			continue
+		}
+		switch st.Type {
+		case models.StatTypeSave:
+			if r := rows[st.PlayerID]; r != nil {
+				r.Saves++
+			}
+		case models.StatTypePenaltySaved:
+			if st.GoalkeeperID != nil {
+				if r := rows[*st.GoalkeeperID]; r != nil {
+					r.Saves++
+				}
+			}
+		default:
+			// a goal credited to one side is conceded by the other
+			against := g.HomeTeamID
+			if st.TeamID == g.HomeTeamID {
+				against = g.AwayTeamID
+			}
+			k := side{g.ID, against}
+			conceded[k]++
+			if keeper := keeperAt(k, st.Minute); keeper != 0 {
+				rows[keeper].Conceded++
+			}
+		}
+	}
+	for k, keepers := range played {
+		for pid := range keepers {
+			rows[pid].Games++
+			if len(inGoal[k]) == 1 && conceded[k] == 0 {
+				rows[pid].CleanSheets++
+			}
+		}
+	}
+
+	for _, r := range rows {
+		if teamID != 0 && r.TeamID != teamID {
+			continue
+		}
+		if shots := r.Saves + r.Conceded; shots > 0 {
+			r.SavePct = (r.Saves*100 + shots/2) / shots
+		}
+		out = append(out, *r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.CleanSheets != b.CleanSheets {
+			return a.CleanSheets > b.CleanSheets
+		}
+		if a.SavePct != b.SavePct {
+			return a.SavePct > b.SavePct
+		}
+		if a.Conceded != b.Conceded {
+			return a.Conceded < b.Conceded
+		}
+		return a.Player < b.Player
+	})
+	return out, nil
+}
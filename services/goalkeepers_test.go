@@ -0,0 +1,68 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+func TestKeeperStats(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		ann, bob, cid := f.homePlayers[0], f.homePlayers[1], f.homePlayers[2]
+		dan, eve, fay := f.awayPlayers[0], f.awayPlayers[1], f.awayPlayers[2]
+		assign := func(game models.Game, p models.Player, from int) {
+			must(t, svc.Keepers.Assign(game.ID, KeeperInput{TeamID: p.TeamID, PlayerID: p.ID, FromMinute: from}))
+		}
+		goal := func(game models.Game, p models.Player, teamID uint, minute int, goalType string) {
+			_, err := svc.Stats.AddGoal(game.ID, GoalInput{PlayerID: p.ID, TeamID: teamID, Minute: minute, GoalType: goalType})
+			must(t, err)
+		}
+
+		// Ann keeps goal for Home until Bob takes over at 60', Dan for Away
+		first := f.game(t)
+		assign(first, ann, 0)
+		assign(first, bob, 60)
+		assign(first, dan, 0)
+		wantKind(t, svc.Keepers.Assign(first.ID, KeeperInput{TeamID: f.home.ID, PlayerID: cid.ID, FromMinute: 60}), ErrConflict)
+		wantKind(t, svc.Keepers.Assign(first.ID, KeeperInput{TeamID: 9999, PlayerID: cid.ID}), ErrValidation)
+		goal(first, cid, f.home.ID, 10, models.StatTypeGoal)
+		goal(first, dan, f.away.ID, 30, models.StatTypeGoal)
+		goal(first, eve, f.away.ID, 0, models.StatTypeGoal)  // no minute: the starter's
+		goal(first, eve, f.away.ID, 70, models.StatTypeGoal) // Bob's
+		goal(first, fay, f.home.ID, 80, models.StatTypeOwnGoal)
+		must(t, svc.Keepers.AddSave(first.ID, SaveInput{TeamID: f.home.ID, Minute: 65}))
+		must(t, svc.Keepers.AddSave(first.ID, SaveInput{TeamID: f.away.ID, PlayerID: dan.ID, Minute: 20}))
+		must(t, svc.Stats.AddMissedPenalty(first.ID, PenaltyInput{PlayerID: cid.ID, TeamID: f.home.ID, GoalkeeperID: dan.ID, Minute: 50, Outcome: models.StatTypePenaltySaved}))
+
+		// a goalless game: clean sheets for Ann and Eve
+		second := f.game(t)
+		assign(second, ann, 0)
+		assign(second, eve, 0)
+		wantKind(t, svc.Keepers.AddSave(f.game(t).ID, SaveInput{TeamID: f.home.ID}), ErrValidation)
+
+		stats, err := svc.Standings.EventStats(f.event.ID, 0, 0)
+		must(t, err)
+		var got []string
+		for _, r := range stats.Goalkeepers {
+			got = append(got, fmt.Sprintf("%s games=%d cs=%d conceded=%d saves=%d (%d%%)", r.Player, r.Games, r.CleanSheets, r.Conceded, r.Saves, r.SavePct))
+		}
+		want := []string{
+			"Eve games=1 cs=1 conceded=0 saves=0 (0%)",
+			"Ann games=2 cs=1 conceded=2 saves=0 (0%)",
+			"Bob games=1 cs=0 conceded=1 saves=1 (50%)",
+			"Dan games=1 cs=0 conceded=2 saves=2 (50%)",
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("goalkeepers\n%v\nwant\n%v", got, want)
+		}
+
+		away, err := svc.Standings.EventStats(f.event.ID, f.away.ID, 0)
+		must(t, err)
+		if len(away.Goalkeepers) != 2 || away.Goalkeepers[0].Player != "Eve" || away.Goalkeepers[1].Player != "Dan" {
+			t.Fatalf("away goalkeepers %+v", away.Goalkeepers)
+		}
+	})
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+// DeletePolicy decides what happens to the records that reference a player
+// or team being deleted. Deletes are soft, so the database's foreign keys
+// never see them; the policies are applied here.
+type DeletePolicy string
+
+const (
+	// DeleteRestrict refuses while anything references the row
+	DeleteRestrict DeletePolicy = ""
+	// DeleteCascade removes the referencing records too; goals come off the
+	// score
+	DeleteCascade DeletePolicy = "cascade"
+	// DeleteAnonymize keeps a player's stats under UnknownPlayer
+	DeleteAnonymize DeletePolicy = "anonymize"
+)
+
+// UnknownPlayer is the name an anonymized player's stats are shown under
+const UnknownPlayer = "Unknown player"
+
+// ParseDeletePolicy accepts "", "restrict", "cascade" and "anonymize"
+func ParseDeletePolicy(v string) (DeletePolicy, error) {
+	switch p := DeletePolicy(v); p {
+	case DeleteRestrict, DeleteCascade, DeleteAnonymize:
+		return p, nil
+	case "restrict":
+		return DeleteRestrict, nil
+	}
+	return "", invalid("Unknown delete policy %q", v)
+}
+
+// statNames are the singular and plural of each stat type in blocker lists
+var statNames = map[string][2]string{
+	models.StatTypeGoal:          {"goal", "goals"},
+	models.StatTypePenalty:       {"penalty goal", "penalty goals"},
+	models.StatTypeOwnGoal:       {"own goal", "own goals"},
+	models.StatTypeAssist:        {"assist", "assists"},
+	models.StatTypeYellowCard:    {"yellow card", "yellow cards"},
+	models.StatTypeRedCard:       {"red card", "red cards"},
+	models.StatTypePenaltyMissed: {"missed penalty", "missed penalties"},
+	models.StatTypePenaltySaved:  {"saved penalty", "saved penalties"},
+	models.StatTypeSave:          {"save", "saves"},
+}
+
+func counted(n int, names [2]string) string {
+	if n == 1 {
+		return "1 " + names[0]
+	}
+	return fmt.Sprintf("%d %s", n, names[1])
+}
+
+// gameNumbers renders distinct game IDs as "#15, #16" and counts them
+func gameNumbers(ids []uint) (string, int) {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	var parts []string
+	for i, id := range ids {
+		if i == 0 || id != ids[i-1] {
+			parts = append(parts, fmt.Sprintf("#%d", id))
+		}
+	}
+	return strings.Join(parts, ", "), len(parts)
+}
+
+// inGames renders "game #15" or "games #15, #16"
+func inGames(ids []uint) string {
+	list, n := gameNumbers(ids)
+	if n == 1 {
+		return "game " + list
+	}
+	return "games " + list
+}
+
+// playerBlockers lists the stats, goalkeeper spells and penalties faced
+// that reference the player, grouped by kind
+func playerBlockers(db *gorm.DB, playerID uint) ([]string, error) {
+	var stats []models.GamePlayerStat
+	if err := db.Where("player_id = ?", playerID).Order("game_id ASC").Find(&stats).Error; err != nil {
+		return nil, err
+	}
+	var out []string
+	games := make(map[string][]uint)
+	var order []string
+	for _, st := range stats {
+		if _, ok := games[st.Type]; !ok {
+			order = append(order, st.Type)
+		}
+		games[st.Type] = append(games[st.Type], st.GameID)
+	}
+	for _, t := range order {
+		names, ok := statNames[t]
+		if !ok {
+			names = [2]string{t + " stat", t + " stats"}
+		}
+		out = append(out, counted(len(games[t]), names)+" in "+inGames(games[t]))
+	}
+
+	var spells []uint
+	if err := db.Model(&models.GameGoalkeeper{}).Where("player_id = ?", playerID).
+		Pluck("game_id", &spells).Error; err != nil {
+		return nil, err
+	}
+	if len(spells) > 0 {
+		out = append(out, "in goal in "+inGames(spells))
+	}
+	var faced []uint
+	if err := db.Model(&models.GamePlayerStat{}).Where("goalkeeper_id = ?", playerID).
+		Pluck("game_id", &faced).Error; err != nil {
+		return nil, err
+	}
+	if len(faced) > 0 {
+		out = append(out, "faced "+counted(len(faced), [2]string{"penalty", "penalties"})+" in "+inGames(faced))
+	}
+	return out, nil
+}
+
+// teamBlockers lists the team's games, the stats its players recorded in
+// other teams' games and the transfers in or out of it
+func teamBlockers(db *gorm.DB, teamID uint) ([]string, error) {
+	var out []string
+	var gameIDs []uint
+	if err := db.Model(&models.Game{}).Where("home_team_id = ? OR away_team_id = ?", teamID, teamID).
+		Pluck("id", &gameIDs).Error; err != nil {
+		return nil, err
+	}
+	if len(gameIDs) > 0 {
+		list, n := gameNumbers(gameIDs)
+		out = append(out, counted(n, [2]string{"game", "games"})+" ("+list+")")
+	}
+	var elsewhere []uint
+	if err := db.Model(&models.GamePlayerStat{}).
+		Joins("JOIN players ON players.id = game_player_stats.player_id AND players.deleted_at IS NULL").
+		Joins("JOIN games ON games.id = game_player_stats.game_id AND games.deleted_at IS NULL").
+		Where("players.team_id = ? AND games.home_team_id <> ? AND games.away_team_id <> ?", teamID, teamID, teamID).
+		Pluck("game_player_stats.game_id", &elsewhere).Error; err != nil {
+		return nil, err
+	}
+	if len(elsewhere) > 0 {
+		out = append(out, counted(len(elsewhere), [2]string{"stat", "stats"})+" of its players in "+inGames(elsewhere))
+	}
+	var names []string
+	if err := db.Model(&models.Transfer{}).
+		Joins("JOIN players ON players.id = transfers.player_id").
+		Where("transfers.from_team_id = ? OR transfers.to_team_id = ?", teamID, teamID).
+		Order("transfers.game_id ASC").
+		Pluck("players.name", &names).Error; err != nil {
+		return nil, err
+	}
+	if len(names) > 0 {
+		out = append(out, counted(len(names), [2]string{"transfer", "transfers"})+" ("+strings.Join(names, ", ")+")")
+	}
+	return out, nil
+}
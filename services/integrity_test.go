@@ -0,0 +1,67 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/yesakov/lukyasha-tracker/database"
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+func TestDeletePolicies(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		game := f.game(t)
+		ann, bob := f.homePlayers[0], f.homePlayers[1]
+		f.goal(t, game.ID, ann, nil)
+		f.goal(t, game.ID, bob, nil)
+
+		err := svc.Players.Delete(ann.ID, DeleteRestrict)
+		wantKind(t, err, ErrConflict)
+		if e, ok := err.(*Error); !ok || len(e.Blocked) == 0 {
+			t.Fatalf("restrict lists nothing: %v", err)
+		}
+		wantKind(t, svc.Teams.Delete(f.home.ID, DeleteRestrict), ErrConflict)
+
+		// anonymized: the goal stays under UnknownPlayer
+		must(t, svc.Players.Delete(ann.ID, DeleteAnonymize))
+		rows, err := svc.Stats.GoalRows(game.ID)
+		must(t, err)
+		if len(rows) != 2 || rows[0].Scorer != UnknownPlayer {
+			t.Fatalf("goal rows after anonymize %+v", rows)
+		}
+
+		// cascade: the goal goes and comes off the score
+		must(t, svc.Players.Delete(bob.ID, DeleteCascade))
+		g, err := svc.Games.Get(game.ID)
+		must(t, err)
+		if g.HomeTeamGoals != 1 {
+			t.Fatalf("home goals %d after cascade, want 1", g.HomeTeamGoals)
+		}
+		must(t, svc.Teams.Delete(f.away.ID, DeleteCascade))
+		_, err = svc.Games.Get(game.ID)
+		wantKind(t, err, ErrNotFound)
+	})
+}
+
+func TestForeignKeys(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		stat := models.GamePlayerStat{GameID: 999999, PlayerID: f.homePlayers[0].ID, TeamID: f.home.ID, Type: models.StatTypeGoal}
+		if err := db.Create(&stat).Error; !database.IsForeignKeyViolation(err) {
+			t.Fatalf("stat of a missing game: %v, want a foreign key violation", err)
+		}
+		game := models.Game{EventID: f.event.ID, HomeTeamID: f.home.ID, AwayTeamID: 999999}
+		if err := db.Create(&game).Error; !database.IsForeignKeyViolation(err) {
+			t.Fatalf("game against a missing team: %v, want a foreign key violation", err)
+		}
+
+		// a soft delete is an update to the keys, so restricting is up to
+		// the services
+		f.game(t)
+		must(t, db.Delete(&models.Team{}, f.home.ID).Error)
+		if err := db.Unscoped().Delete(&models.Team{}, f.away.ID).Error; !database.IsForeignKeyViolation(err) {
+			t.Fatalf("hard delete of a team with games: %v, want a foreign key violation", err)
+		}
+	})
+}
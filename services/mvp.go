@@ -0,0 +1,401 @@
+package services
+
+import (
+	"sort"
+	"time"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+type MVPService interface {
+	// Ballot is a game's player of the match vote as one voter (a user, or
+	// a device for visitors who aren't signed in) sees it
+	Ballot(gameID, userID uint, device string) (*MVPBallot, error)
+	// Vote casts or changes the voter's vote while voting is open; a
+	// signed-in user votes as themselves whatever the device
+	Vote(gameID, playerID, userID uint, device string) (*models.MVPVote, error)
+	// Best ranks an event's players by player of the match awards, then by
+	// votes, over the games whose vote closed; the first is the event's
+	// best player
+	Best(eventID uint) ([]MVPRow, error)
+}
+
+// MVPVoteWindow is how long the vote stays open after a game is finished
+const MVPVoteWindow = 24 * time.Hour
+
+func votingDeadline() *time.Time {
+	t := time.Now().Add(MVPVoteWindow)
+	return &t
+}
+
+type MVPCandidate struct {
+	PlayerID uint
+	Player   string
+	TeamID   uint
+	Team     string
+	Votes    int
+	Percent  int
+	// Winner marks the most voted once voting closed; a tie shares it
+	Winner bool
+}
+
+type MVPBallot struct {
+	Game   models.Game
+	Open   bool
+	Closed bool
+	// Candidates are the players of both lineups, most votes first
+	Candidates []MVPCandidate
+	Total      int
+	Mine       uint // the player the voter voted for, if any
+}
+
+type MVPRow struct {
+	Rank     int // shared by players level on awards and votes
+	PlayerID uint
+	Player   string
+	Team     string
+	Awards   int
+	Votes    int
+}
+
+type mvpService struct {
+	db *gorm.DB
+}
+
+func (s *mvpService) Ballot(gameID, userID uint, device string) (*MVPBallot, error) {
+	var game models.Game
+	if err := s.db.First(&game, gameID).Error; err != nil {
+		return nil, lookup(err, "Game")
+	}
+	now := time.Now()
+	b := &MVPBallot{Game: game, Open: game.VotingOpen(now), Closed: game.VotingClosed(now)}
+	lineup, err := gameLineup(s.db, game)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := voteCounts(s.db, []uint{game.ID})
+	if err != nil {
+		return nil, err
+	}
+	votes := make(map[uint]int)
+	for _, c := range counts {
+		votes[c.PlayerID] = c.Votes
+		b.Total += c.Votes
+	}
+	top := 0
+	for _, p := range lineup {
+		if votes[p.PlayerID] > top {
+			top = votes[p.PlayerID]
+		}
+	}
+	for _, p := range lineup {
+		p.Votes = votes[p.PlayerID]
+		if b.Total > 0 {
+			p.Percent = p.Votes * 100 / b.Total
+		}
+		p.Winner = b.Closed && top > 0 && p.Votes == top
+		b.Candidates = append(b.Candidates, p)
+	}
+	sort.SliceStable(b.Candidates, func(i, j int) bool { return b.Candidates[i].Votes > b.Candidates[j].Votes })
+
+	if mine, err := s.find(gameID, userID, device); err != nil {
+		return nil, err
+	} else if mine != nil {
+		b.Mine = mine.PlayerID
+	}
+	return b, nil
+}
+
+// Winners are the players of the match once voting closed
+func (b MVPBallot) Winners() []MVPCandidate {
+	var out []MVPCandidate
+	for _, c := range b.Candidates {
+		if c.Winner {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// WindowHours is how long votes are taken after the final whistle
+func (b MVPBallot) WindowHours() int { return int(MVPVoteWindow.Hours()) }
+
+// find returns the voter's vote of a game, if any: a signed-in user's by
+// their account alone, a visitor's by device
+func (s *mvpService) find(gameID, userID uint, device string) (*models.MVPVote, error) {
+	q := s.db.Where("game_id = ?", gameID)
+	switch {
+	case userID != 0:
+		q = q.Where("user_id = ?", userID)
+	case device != "":
+		q = q.Where("user_id IS NULL AND device = ?", device)
+	default:
+		return nil, nil
+	}
+	var vote models.MVPVote
+	res := q.Limit(1).Find(&vote)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return nil, res.Error
+	}
+	return &vote, nil
+}
+
+func (s *mvpService) Vote(gameID, playerID, userID uint, device string) (*models.MVPVote, error) {
+	if userID == 0 && device == "" {
+		return nil, unauthorized("Log in or allow cookies to vote")
+	}
+	var game models.Game
+	if err := s.db.First(&game, gameID).Error; err != nil {
+		return nil, lookup(err, "Game")
+	}
+	now := time.Now()
+	switch {
+	case !game.Finished():
+		return nil, conflict("Voting opens when the game is finished")
+	case !game.VotingOpen(now):
+		return nil, conflict("Voting for this game is closed")
+	}
+	lineup, err := gameLineup(s.db, game)
+	if err != nil {
+		return nil, err
+	}
+	playing := false
+	for _, p := range lineup {
+		playing = playing || p.PlayerID == playerID
+	}
+	if !playing {
+		return nil, invalid("Vote for a player of this game")
+	}
+
+	existing, err := s.find(gameID, userID, device)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		if err := s.db.Model(existing).Update("player_id", playerID).Error; err != nil {
+			return nil, err
+		}
+		return existing, nil
+	}
+	// a signed-in user's vote is theirs wherever they cast it
+	vote := models.MVPVote{GameID: gameID, PlayerID: playerID}
+	if userID != 0 {
+		vote.UserID = &userID
+	} else {
+		vote.Device = device
+	}
+	if err := s.db.Create(&vote).Error; err != nil {
+		return nil, write(err, "Vote")
+	}
+	return &vote, nil
+}
+
+func (s *mvpService) Best(eventID uint) ([]MVPRow, error) {
+	if err := s.db.First(&models.Event{}, eventID).Error; err != nil {
+		return nil, lookup(err, "Event")
+	}
+	var games []models.Game
+	if err := s.db.Where("event_id = ? AND status = ?", eventID, models.GameFinished).Find(&games).Error; err != nil {
+		return nil, err
+	}
+	closed := closedGames(games)
+	counts, err := voteCounts(s.db, closed)
+	if err != nil {
+		return nil, err
+	}
+	rows := make(map[uint]*MVPRow)
+	row := func(playerID uint) *MVPRow {
+		if r, ok := rows[playerID]; ok {
+			return r
+		}
+		r := &MVPRow{PlayerID: playerID}
+		rows[playerID] = r
+		return r
+	}
+	for _, c := range counts {
+		row(c.PlayerID).Votes += c.Votes
+	}
+	for _, winners := range voteWinners(counts) {
+		for _, id := range winners {
+			row(id).Awards++
+		}
+	}
+	if len(rows) == 0 {
+		return []MVPRow{}, nil
+	}
+
+	ids := make([]uint, 0, len(rows))
+	for id := range rows {
+		ids = append(ids, id)
+	}
+	var names []struct {
+		ID   uint
+		Name string
+		Team string
+	}
+	if err := s.db.Model(&models.Player{}).Unscoped().
+		Select("players.id, players.name, COALESCE(teams.name, '') AS team").
+		Joins("LEFT JOIN teams ON teams.id = players.team_id").
+		Where("players.id IN ?", ids).
+		Scan(&names).Error; err != nil {
+		return nil, err
+	}
+	for _, n := range names {
+		rows[n.ID].Player, rows[n.ID].Team = n.Name, n.Team
+	}
+	out := make([]MVPRow, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, *r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Awards != b.Awards {
+			return a.Awards > b.Awards
+		}
+		if a.Votes != b.Votes {
+			return a.Votes > b.Votes
+		}
+		return a.Player < b.Player
+	})
+	for i := range out {
+		out[i].Rank = i + 1
+		if i > 0 && out[i].Awards == out[i-1].Awards && out[i].Votes == out[i-1].Votes {
+			out[i].Rank = out[i-1].Rank
+		}
+	}
+	return out, nil
+}
+
+// gameLineup lists the players of both teams at the game, following
+// transfers and guest appearances, home first in roster order
+func gameLineup(db *gorm.DB, game models.Game) ([]MVPCandidate, error) {
+	var players []struct {
+		ID     uint
+		Name   string
+		TeamID uint
+	}
+	err := db.Model(&models.Player{}).
+		Select("players.id, players.name, players.team_id").
+		Joins("JOIN teams ON teams.id = players.team_id AND teams.deleted_at IS NULL").
+		Where("teams.event_id = ?", game.EventID).
+		Order("players.sort_order ASC, players.id ASC").
+		Scan(&players).Error
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint, len(players))
+	for i, p := range players {
+		ids[i] = p.ID
+	}
+	played, err := loadRosters(db, ids)
+	if err != nil {
+		return nil, err
+	}
+	var teams []models.Team
+	if err := db.Where("id IN ?", []uint{game.HomeTeamID, game.AwayTeamID}).Find(&teams).Error; err != nil {
+		return nil, err
+	}
+	names := make(map[uint]string, len(teams))
+	for _, t := range teams {
+		names[t.ID] = t.Name
+	}
+	var home, away []MVPCandidate
+	for _, p := range players {
+		c := MVPCandidate{PlayerID: p.ID, Player: p.Name}
+		switch c.TeamID = played.teamAt(p.ID, game.ID); c.TeamID {
+		case game.HomeTeamID:
+			c.Team = names[c.TeamID]
+			home = append(home, c)
+		case game.AwayTeamID:
+			c.Team = names[c.TeamID]
+			away = append(away, c)
+		}
+	}
+	return append(home, away...), nil
+}
+
+type voteCount struct {
+	GameID   uint
+	PlayerID uint
+	Votes    int
+}
+
+func voteCounts(db *gorm.DB, gameIDs []uint) ([]voteCount, error) {
+	var out []voteCount
+	if len(gameIDs) == 0 {
+		return out, nil
+	}
+	err := db.Model(&models.MVPVote{}).
+		Select("game_id, player_id, COUNT(*) AS votes").
+		Where("game_id IN ?", gameIDs).
+		Group("game_id, player_id").
+		Order("game_id ASC, player_id ASC").
+		Scan(&out).Error
+	return out, err
+}
+
+// voteWinners returns each game's most voted players
+func voteWinners(counts []voteCount) map[uint][]uint {
+	top := make(map[uint]int)
+	for _, c := range counts {
+		if c.Votes > top[c.GameID] {
+			top[c.GameID] = c.Votes
+		}
+	}
+	out := make(map[uint][]uint)
+	for _, c := range counts {
+		if c.Votes == top[c.GameID] {
+			out[c.GameID] = append(out[c.GameID], c.PlayerID)
+		}
+	}
+	return out
+}
+
+// closedGames keeps the IDs of the games whose vote is over
+func closedGames(games []models.Game) []uint {
+	now := time.Now()
+	var out []uint
+	for _, g := range games {
+		if g.VotingClosed(now) {
+			out = append(out, g.ID)
+		}
+	}
+	return out
+}
+
+// mvpAwards counts the players' player of the match awards
+func mvpAwards(db *gorm.DB, playerIDs []uint) (map[uint]int, error) {
+	out := make(map[uint]int)
+	if len(playerIDs) == 0 {
+		return out, nil
+	}
+	var gameIDs []uint
+	if err := db.Model(&models.MVPVote{}).Distinct("game_id").
+		Where("player_id IN ?", playerIDs).Pluck("game_id", &gameIDs).Error; err != nil {
+		return nil, err
+	}
+	if len(gameIDs) == 0 {
+		return out, nil
+	}
+	var games []models.Game
+	if err := db.Where("id IN ?", gameIDs).Find(&games).Error; err != nil {
+		return nil, err
+	}
+	counts, err := voteCounts(db, closedGames(games))
+	if err != nil {
+		return nil, err
+	}
+	wanted := make(map[uint]bool, len(playerIDs))
+	for _, id := range playerIDs {
+		wanted[id] = true
+	}
+	for _, winners := range voteWinners(counts) {
+		for _, id := range winners {
+			if wanted[id] {
+				out[id]++
+			}
+		}
+	}
+	return out, nil
+}
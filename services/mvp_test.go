@@ -0,0 +1,64 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+func TestMVPVotes(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		ann, bob, dan := f.homePlayers[0], f.homePlayers[1], f.awayPlayers[0]
+		user, _, err := svc.Users.Register("fan", "secret123")
+		must(t, err)
+		game := f.game(t)
+		_, err = svc.MVP.Vote(game.ID, ann.ID, 0, "phone")
+		wantKind(t, err, ErrConflict)
+		f.finish(t, game.ID)
+		_, err = svc.MVP.Vote(game.ID, ann.ID, 0, "")
+		wantKind(t, err, ErrUnauthorized)
+		outsider := f.player(t, f.team(t, "Spare").ID, "Gus")
+		_, err = svc.MVP.Vote(game.ID, outsider.ID, 0, "phone")
+		wantKind(t, err, ErrValidation)
+
+		// a visitor's device has one vote, which they can change
+		_, err = svc.MVP.Vote(game.ID, ann.ID, 0, "phone")
+		must(t, err)
+		_, err = svc.MVP.Vote(game.ID, bob.ID, 0, "phone")
+		must(t, err)
+
+		// a signed-in user votes as themselves, from any device: the
+		// visitor's vote from the same phone stays theirs
+		_, err = svc.MVP.Vote(game.ID, dan.ID, user.ID, "phone")
+		must(t, err)
+		_, err = svc.MVP.Vote(game.ID, bob.ID, user.ID, "laptop")
+		must(t, err)
+		mine, err := svc.MVP.Ballot(game.ID, user.ID, "phone")
+		must(t, err)
+		visitor, err := svc.MVP.Ballot(game.ID, 0, "phone")
+		must(t, err)
+		if mine.Total != 2 || mine.Mine != bob.ID || visitor.Mine != bob.ID || mine.Candidates[0].PlayerID != bob.ID {
+			t.Fatalf("ballot %+v, visitor's pick %d", mine, visitor.Mine)
+		}
+		stranger, err := svc.MVP.Ballot(game.ID, 0, "laptop")
+		must(t, err)
+		if stranger.Mine != 0 {
+			t.Fatalf("a visitor on the user's laptop sees vote %d", stranger.Mine)
+		}
+
+		// votes count once voting closes
+		closed := time.Now().Add(-time.Minute)
+		_, err = svc.Games.Update(game.ID, models.Game{MVPClosesAt: &closed})
+		must(t, err)
+		_, err = svc.MVP.Vote(game.ID, ann.ID, 0, "tablet")
+		wantKind(t, err, ErrConflict)
+		best, err := svc.MVP.Best(f.event.ID)
+		must(t, err)
+		if len(best) == 0 || best[0].PlayerID != bob.ID || best[0].Awards != 1 || best[0].Votes != 2 {
+			t.Fatalf("best players %+v", best)
+		}
+	})
+}
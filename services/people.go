@@ -0,0 +1,320 @@
+package services
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+type PersonService interface {
+	// List returns people with at least one roster entry, sorted by name
+	List() ([]PersonSummary, error)
+	Get(id uint) (*models.Person, error)
+	// Career sums the person's stats over every event they played in
+	Career(id uint) (*Career, error)
+	// Duplicates groups people whose names match ignoring case and spacing
+	Duplicates() ([]DuplicateGroup, error)
+	// Merge moves the roster entries, club memberships and pool entries of
+	// `ids` to `keepID` and deletes them
+	Merge(keepID uint, ids []uint) (*models.Person, error)
+}
+
+// Tally counts what a player did over some set of games
+type Tally struct {
+	Appearances int
+	Goals       int
+	OwnGoals    int
+	Assists     int
+	YellowCards int
+	RedCards    int
+	MVPs        int // player of the match awards in games whose vote closed
+}
+
+func (t *Tally) add(statType string, n int) {
+	switch statType {
+	case models.StatTypeGoal, models.StatTypePenalty:
+		t.Goals += n
+	case models.StatTypeOwnGoal:
+		t.OwnGoals += n
+	case models.StatTypeAssist:
+		t.Assists += n
+	case models.StatTypeYellowCard:
+		t.YellowCards += n
+	case models.StatTypeRedCard:
+		t.RedCards += n
+	}
+}
+
+func (t *Tally) merge(o Tally) {
+	t.Appearances += o.Appearances
+	t.Goals += o.Goals
+	t.OwnGoals += o.OwnGoals
+	t.Assists += o.Assists
+	t.YellowCards += o.YellowCards
+	t.RedCards += o.RedCards
+	t.MVPs += o.MVPs
+}
+
+// PersonSummary is a person with the "Team — Event" entries they played in
+type PersonSummary struct {
+	ID      uint
+	Name    string
+	Entries []string
+}
+
+type DuplicateGroup struct {
+	Name   string
+	People []PersonSummary
+}
+
+// CareerLine is one event of a career; appearances are the games of the
+// team the person played for at the time (see transfers), Team the latest
+type CareerLine struct {
+	PlayerID uint
+	EventID  uint
+	Event    string
+	Date     string
+	TeamID   uint
+	Team     string
+	Tally
+}
+
+type Career struct {
+	Person models.Person
+	Total  Tally
+	Lines  []CareerLine
+}
+
+// careerEntriesSQL keeps the roster entries that make up careers: deleted
+// entries too, since their stats still count (see migration 3 and Merge), but
+// only those of live teams in live events. List and Career use it, and Merge
+// moves deleted entries along for the same reason.
+const careerEntriesSQL = `JOIN teams ON teams.id = players.team_id AND teams.deleted_at IS NULL
+	JOIN events ON events.id = teams.event_id AND events.deleted_at IS NULL`
+
+type personService struct {
+	db    *gorm.DB
+	cache *eventCache
+}
+
+func (s *personService) List() ([]PersonSummary, error) {
+	var rows []struct {
+		ID    uint
+		Name  string
+		Team  string
+		Event string
+	}
+	err := s.db.Table("people").
+		Select("people.id, people.name, teams.name AS team, events.name AS event").
+		Joins("JOIN players ON players.person_id = people.id").
+		Joins(careerEntriesSQL).
+		Where("people.deleted_at IS NULL").
+		Order("people.name ASC, people.id ASC, events.date DESC").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	out := []PersonSummary{}
+	for _, r := range rows {
+		if n := len(out); n == 0 || out[n-1].ID != r.ID {
+			out = append(out, PersonSummary{ID: r.ID, Name: r.Name})
+		}
+		last := &out[len(out)-1]
+		last.Entries = append(last.Entries, r.Team+" — "+r.Event)
+	}
+	return out, nil
+}
+
+func (s *personService) Get(id uint) (*models.Person, error) {
+	var person models.Person
+	if err := s.db.First(&person, id).Error; err != nil {
+		return nil, lookup(err, "Person")
+	}
+	return &person, nil
+}
+
+func (s *personService) Career(id uint) (*Career, error) {
+	person, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	career := &Career{Person: *person, Lines: []CareerLine{}}
+	err = s.db.Table("players").
+		Select(`players.id AS player_id, events.id AS event_id, events.name AS event, events.date AS date,
+			teams.id AS team_id, teams.name AS team`).
+		Joins(careerEntriesSQL).
+		Where("players.person_id = ?", id).
+		Order("events.date DESC, events.id DESC").
+		Scan(&career.Lines).Error
+	if err != nil {
+		return nil, err
+	}
+	playerIDs := make([]uint, len(career.Lines))
+	for i, l := range career.Lines {
+		playerIDs[i] = l.PlayerID
+	}
+	tallies, err := playerTallies(s.db, playerIDs)
+	if err != nil {
+		return nil, err
+	}
+	played, err := playerGames(s.db, playerIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range career.Lines {
+		l := &career.Lines[i]
+		l.Tally = tallies[l.PlayerID]
+		l.Appearances = played[l.PlayerID]
+		career.Total.merge(l.Tally)
+	}
+	return career, nil
+}
+
+func (s *personService) Duplicates() ([]DuplicateGroup, error) {
+	people, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string][]PersonSummary)
+	for _, p := range people {
+		k := normalizeName(p.Name)
+		byName[k] = append(byName[k], p)
+	}
+	out := []DuplicateGroup{}
+	for _, group := range byName {
+		if len(group) > 1 {
+			// the oldest entry comes first and is suggested as the one to keep
+			sort.Slice(group, func(i, j int) bool { return group[i].ID < group[j].ID })
+			out = append(out, DuplicateGroup{Name: group[0].Name, People: group})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func (s *personService) Merge(keepID uint, ids []uint) (*models.Person, error) {
+	keep, err := s.Get(keepID)
+	if err != nil {
+		return nil, err
+	}
+	var merged []uint
+	for _, id := range ids {
+		if id != keepID && id != 0 {
+			merged = append(merged, id)
+		}
+	}
+	if len(merged) == 0 {
+		return nil, invalid("Select at least one other person to merge")
+	}
+	var found int64
+	if err := s.db.Model(&models.Person{}).Where("id IN ?", merged).Count(&found).Error; err != nil {
+		return nil, err
+	}
+	if int(found) != len(merged) {
+		return nil, notFound("Person not found")
+	}
+	// ratings follow people, so the events of the moved entries change
+	var eventIDs []uint
+	if err := s.db.Unscoped().Model(&models.Player{}).
+		Joins("JOIN teams ON teams.id = players.team_id").
+		Where("players.person_id IN ?", merged).
+		Distinct().Pluck("teams.event_id", &eventIDs).Error; err != nil {
+		return nil, err
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Soft-deleted roster entries move too, their stats are part of the career
+		if err := tx.Unscoped().Model(&models.Player{}).Where("person_id IN ?", merged).
+			UpdateColumn("person_id", keep.ID).Error; err != nil {
+			return err
+		}
+		// Club rosters: (club, person) is the key, so clubs that already
+		// list the kept person just drop the merged ones
+		if err := tx.Exec(`INSERT INTO club_members (club_id, person_id)
+			SELECT DISTINCT club_id, ? FROM club_members
+			WHERE person_id IN ? AND club_id NOT IN (SELECT club_id FROM club_members WHERE person_id = ?)`,
+			keep.ID, merged, keep.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM club_members WHERE person_id IN ?", merged).Error; err != nil {
+			return err
+		}
+		// Event pools list a person once: entries in pools that already have
+		// the kept person go, and of several merged entries in one pool only
+		// the first moves over
+		var pool []models.PoolPlayer
+		if err := tx.Where("person_id IN ? OR person_id = ?", merged, keep.ID).
+			Order("id ASC").Find(&pool).Error; err != nil {
+			return err
+		}
+		seen := make(map[uint]bool)
+		for _, p := range pool {
+			if *p.PersonID == keep.ID {
+				seen[p.EventID] = true
+			}
+		}
+		for _, p := range pool {
+			switch {
+			case *p.PersonID == keep.ID:
+			case seen[p.EventID]:
+				if err := tx.Delete(&p).Error; err != nil {
+					return err
+				}
+			default:
+				seen[p.EventID] = true
+				if err := tx.Model(&p).UpdateColumn("person_id", keep.ID).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Delete(&models.Person{}, merged).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.cache.invalidate(eventIDs...)
+	return keep, nil
+}
+
+// normalizeName folds case and whitespace so "ivan  petrov" matches "Ivan Petrov"
+func normalizeName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// playerTallies counts the stats of each player over live games
+func playerTallies(db *gorm.DB, playerIDs []uint) (map[uint]Tally, error) {
+	out := make(map[uint]Tally, len(playerIDs))
+	if len(playerIDs) == 0 {
+		return out, nil
+	}
+	var rows []struct {
+		PlayerID uint
+		Type     string
+		Count    int
+	}
+	err := db.Model(&models.GamePlayerStat{}).
+		Select("game_player_stats.player_id, game_player_stats.type, COUNT(*) AS count").
+		Joins("JOIN games ON games.id = game_player_stats.game_id AND games.deleted_at IS NULL").
+		Where("game_player_stats.player_id IN ?", playerIDs).
+		Group("game_player_stats.player_id, game_player_stats.type").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		t := out[r.PlayerID]
+		t.add(r.Type, r.Count)
+		out[r.PlayerID] = t
+	}
+	awards, err := mvpAwards(db, playerIDs)
+	if err != nil {
+		return nil, err
+	}
+	for id, n := range awards {
+		t := out[id]
+		t.MVPs = n
+		out[id] = t
+	}
+	return out, nil
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+// secondEvent adds another event where Ann and Dan meet again, Ann under
+// `name` as a new person unless personID is set
+func secondEvent(t *testing.T, f *fixture, name string, personID *uint) (models.Event, models.Player) {
+	t.Helper()
+	event := models.Event{Name: "League", Date: "2024-07-01", EventURL: "https://example.com"}
+	must(t, f.svc.Events.Create(&event))
+	blue, green := models.Team{Name: "Blue", EventID: event.ID}, models.Team{Name: "Green", EventID: event.ID}
+	must(t, f.svc.Teams.Create(&blue))
+	must(t, f.svc.Teams.Create(&green))
+	ann := models.Player{Name: name, TeamID: blue.ID, PersonID: personID}
+	must(t, f.svc.Players.Create(&ann))
+	dan := models.Player{Name: "Dan", TeamID: green.ID}
+	must(t, f.svc.Players.Create(&dan))
+	game := models.Game{EventID: event.ID, HomeTeamID: blue.ID, AwayTeamID: green.ID}
+	must(t, f.svc.Games.Create(&game))
+	f.goal(t, game.ID, ann, nil)
+	return event, ann
+}
+
+func TestCareer(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		ann := f.homePlayers[0]
+		for range 2 {
+			f.goal(t, f.game(t).ID, ann, &f.homePlayers[1])
+		}
+		event, _ := secondEvent(t, f, "Ann", ann.PersonID)
+
+		career, err := svc.People.Career(*ann.PersonID)
+		must(t, err)
+		if len(career.Lines) != 2 || career.Lines[0].Event != "League" || career.Lines[1].Team != "Home" {
+			t.Fatalf("career lines %+v", career.Lines)
+		}
+		if career.Total.Goals != 3 || career.Total.Appearances != 3 {
+			t.Fatalf("career total %+v, want 3 goals in 3 games", career.Total)
+		}
+
+		// a roster entry deleted with its stats kept (as deletes used to
+		// work) still counts; a deleted event drops them
+		must(t, db.Delete(&models.Player{}, ann.ID).Error)
+		must(t, svc.Events.Delete(event.ID))
+		career, err = svc.People.Career(*ann.PersonID)
+		must(t, err)
+		if len(career.Lines) != 1 || career.Total.Goals != 2 {
+			t.Fatalf("career after deletes %+v", career)
+		}
+		people, err := svc.People.List()
+		must(t, err)
+		for _, p := range people {
+			if p.ID == *ann.PersonID && len(p.Entries) != 1 {
+				t.Fatalf("list entries %v, want the one of the live event", p.Entries)
+			}
+		}
+	})
+}
+
+func TestMergePeople(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		ann := f.homePlayers[0]
+		f.goal(t, f.game(t).ID, ann, nil)
+		_, twin := secondEvent(t, f, " ann ", nil)
+
+		groups, err := svc.People.Duplicates()
+		must(t, err)
+		if len(groups) != 2 { // Ann and Dan
+			t.Fatalf("duplicate groups %+v", groups)
+		}
+		if g := groups[0]; g.Name != "Ann" || len(g.People) != 2 || g.People[0].ID != *ann.PersonID {
+			t.Fatalf("Ann's group %+v, want the oldest first", g)
+		}
+
+		_, err = svc.People.Merge(*ann.PersonID, nil)
+		wantKind(t, err, ErrValidation)
+		_, err = svc.People.Merge(*ann.PersonID, []uint{9999})
+		wantKind(t, err, ErrNotFound)
+
+		_, err = svc.People.Merge(*ann.PersonID, []uint{*twin.PersonID})
+		must(t, err)
+		_, err = svc.People.Get(*twin.PersonID)
+		wantKind(t, err, ErrNotFound)
+		career, err := svc.People.Career(*ann.PersonID)
+		must(t, err)
+		if len(career.Lines) != 2 || career.Total.Goals != 2 {
+			t.Fatalf("merged career %+v", career)
+		}
+	})
+}
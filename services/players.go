@@ -0,0 +1,598 @@
+package services
+
+import (
+	"errors"
+	"mime/multipart"
+	"sort"
+	"strings"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"github.com/yesakov/lukyasha-tracker/storage"
+	"gorm.io/gorm"
+)
+
+type PlayerService interface {
+	List() ([]models.Player, error)
+	Get(id uint) (*models.Player, error)
+	Create(player *models.Player) error
+	// Update applies the non-zero changes; Number 0 clears the shirt number
+	// and a photo, when given, replaces the current one
+	Update(id uint, changes models.Player, photo *multipart.FileHeader) (*models.Player, error)
+	// Delete refuses a player with recorded stats, goalkeeper spells or
+	// penalties faced, listing them; DeleteCascade removes them too (goals
+	// come off the score) and DeleteAnonymize keeps them under UnknownPlayer
+	Delete(id uint, policy DeletePolicy) error
+	// SetArmband makes the player captain or vice ("" removes it), taking
+	// the armband off the teammate who had it
+	SetArmband(id uint, armband string) (*models.Player, error)
+	// Report collects a player's goals, assists and games within an event
+	Report(eventID, playerID uint) (*PlayerReport, error)
+}
+
+// PlayerStatRow is a goal or assist of the player; Opponent is the team the
+// credited side played against, Partner the scorer (for assists) or the
+// assister (for goals)
+type PlayerStatRow struct {
+	GameID   uint
+	Minute   int
+	Type     string
+	Opponent string
+	Partner  string
+}
+
+// PlayerGameRow is one game the player's team played (or the player scored
+// in); GF/GA are from the player's side
+type PlayerGameRow struct {
+	GameID   uint
+	Opponent string
+	GF       int
+	GA       int
+	Goals    int
+	Assists  int
+}
+
+// Involvement is goals plus assists in the game
+func (r PlayerGameRow) Involvement() int { return r.Goals + r.Assists }
+
+type PlayerReport struct {
+	Event   models.Event
+	Player  models.Player
+	Team    models.Team
+	Tally   Tally
+	Goals   []PlayerStatRow
+	Assists []PlayerStatRow
+	Games   []PlayerGameRow
+	// Ranking is the event's goals+assists table; Rank is the player's
+	// place in it, 0 without any involvement
+	Ranking []InvolvementRow
+	Rank    int
+}
+
+// Positions and PreferredFeet are the accepted player details, with the
+// labels the pages show
+var (
+	Positions = []Choice{
+		{"GK", "Goalkeeper"}, {"DF", "Defender"}, {"MF", "Midfielder"}, {"FW", "Forward"},
+	}
+	PreferredFeet = []Choice{
+		{"right", "Right"}, {"left", "Left"}, {"both", "Both"},
+	}
+)
+
+// Choice is a stored value and its label
+type Choice struct {
+	Value string
+	Label string
+}
+
+// thumbSize bounds player photo thumbnails, in pixels
+const thumbSize = 96
+
+type playerService struct {
+	db    *gorm.DB
+	cache *eventCache
+	files *storage.Store
+}
+
+func (s *playerService) List() ([]models.Player, error) {
+	var players []models.Player
+	err := s.db.Find(&players).Error
+	return players, err
+}
+
+func (s *playerService) Get(id uint) (*models.Player, error) {
+	var player models.Player
+	if err := s.db.First(&player, id).Error; err != nil {
+		return nil, lookup(err, "Player")
+	}
+	return &player, nil
+}
+
+func (s *playerService) Create(player *models.Player) error {
+	player.Name = strings.TrimSpace(player.Name)
+	if player.Name == "" || player.TeamID == 0 {
+		return invalid("Name and TeamID required")
+	}
+	if player.Number != nil && *player.Number == 0 {
+		player.Number = nil
+	}
+	if err := checkDetails(*player); err != nil {
+		return err
+	}
+	player.Photo, player.PhotoThumb = "", ""
+	if err := s.db.First(&models.Team{}, player.TeamID).Error; err != nil {
+		return lookup(err, "Team")
+	}
+	if err := s.checkName(player.TeamID, player.Name, 0); err != nil {
+		return err
+	}
+	if err := s.checkNumber(player.TeamID, player.Number, 0); err != nil {
+		return err
+	}
+	player.Armband = ""
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := linkPerson(tx, player); err != nil {
+			return err
+		}
+		order, err := nextSortOrder(tx, player.TeamID)
+		if err != nil {
+			return err
+		}
+		player.SortOrder = order
+		return tx.Create(player).Error
+	})
+	if err != nil {
+		return write(err, "Player")
+	}
+	s.cache.invalidateTeam(s.db, player.TeamID)
+	return nil
+}
+
+func (s *playerService) Update(id uint, changes models.Player, photo *multipart.FileHeader) (*models.Player, error) {
+	existing, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	changes.Name = strings.TrimSpace(changes.Name)
+	if err := checkDetails(changes); err != nil {
+		return nil, err
+	}
+	// the roster place and armband have their own calls
+	changes.SortOrder, changes.Armband = 0, ""
+	teamID := existing.TeamID
+	if changes.TeamID != 0 && changes.TeamID != existing.TeamID {
+		teamID = changes.TeamID
+		if err := checkMove(s.db, existing, teamID); err != nil {
+			return nil, err
+		}
+	}
+	name := existing.Name
+	if changes.Name != "" {
+		name = changes.Name
+	}
+	if teamID != existing.TeamID || name != existing.Name {
+		if err := s.checkName(teamID, name, existing.ID); err != nil {
+			return nil, err
+		}
+	}
+	number := existing.Number
+	clearNumber := changes.Number != nil && *changes.Number == 0
+	if clearNumber {
+		number, changes.Number = nil, nil
+	} else if changes.Number != nil {
+		number = changes.Number
+	}
+	if err := s.checkNumber(teamID, number, existing.ID); err != nil {
+		return nil, err
+	}
+	oldTeamID := existing.TeamID
+	oldPhoto, oldThumb := existing.Photo, existing.PhotoThumb
+	if changes.Photo, changes.PhotoThumb, err = s.savePhoto(photo); err != nil {
+		return nil, err
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(existing).Updates(changes).Error; err != nil {
+			return err
+		}
+		if clearNumber {
+			if err := tx.Model(existing).Update("number", nil).Error; err != nil {
+				return err
+			}
+		}
+		if existing.TeamID != oldTeamID {
+			if err := placeInTeam(tx, existing); err != nil {
+				return err
+			}
+		}
+		return renamePerson(tx, existing)
+	})
+	if err != nil {
+		s.removePhoto(changes.Photo, changes.PhotoThumb)
+		return nil, write(err, "Player")
+	}
+	if changes.Photo != "" {
+		s.removePhoto(oldPhoto, oldThumb)
+	}
+	s.cache.invalidateTeam(s.db, oldTeamID)
+	if existing.TeamID != oldTeamID {
+		s.cache.invalidateTeam(s.db, existing.TeamID)
+	}
+	return existing, nil
+}
+
+func (s *playerService) Delete(id uint, policy DeletePolicy) error {
+	player, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	blockers, err := playerBlockers(s.db, id)
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(blockers) > 0 && policy == DeleteRestrict:
+		return blocked(blockers, "%s can't be deleted; delete their records too or anonymize them", player.Name)
+	case len(blockers) > 0 && policy == DeleteAnonymize:
+		err = anonymizePlayer(s.db, id)
+	default:
+		err = s.db.Transaction(func(tx *gorm.DB) error {
+			return removePlayers(tx, []uint{id})
+		})
+	}
+	if err != nil {
+		return err
+	}
+	s.removePhoto(player.Photo, player.PhotoThumb)
+	s.cache.invalidateTeam(s.db, player.TeamID)
+	return nil
+}
+
+// anonymizePlayer takes the player off the roster but keeps their stats,
+// goalkeeper spells and transfers, shown under UnknownPlayer. Nothing
+// identifying is left: the person link, number, photo and details go.
+func anonymizePlayer(db *gorm.DB, id uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		// Soft-delete first so the new name can't clash in the team's
+		// partial unique index
+		if err := tx.Delete(&models.Player{}, id).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(&models.Player{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"name": UnknownPlayer, "person_id": nil, "number": nil, "position": "",
+			"preferred_foot": "", "photo": "", "photo_thumb": "", "armband": "",
+		}).Error
+	})
+}
+
+// removePlayers deletes players with everything that references them
+func removePlayers(tx *gorm.DB, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	var stats []models.GamePlayerStat
+	if err := tx.Where("player_id IN ?", ids).Find(&stats).Error; err != nil {
+		return err
+	}
+	for i := range stats {
+		if err := removeStat(tx, &stats[i]); err != nil {
+			return err
+		}
+	}
+	if err := tx.Model(&models.GamePlayerStat{}).Where("goalkeeper_id IN ?", ids).
+		Update("goalkeeper_id", nil).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("player_id IN ?", ids).Delete(&models.GameGoalkeeper{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("player_id IN ?", ids).Delete(&models.Transfer{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("player_id IN ?", ids).Delete(&models.MVPVote{}).Error; err != nil {
+		return err
+	}
+	return tx.Delete(&models.Player{}, ids).Error
+}
+
+// Armbands a player can wear
+const (
+	ArmbandCaptain = "captain"
+	ArmbandVice    = "vice"
+)
+
+func (s *playerService) SetArmband(id uint, armband string) (*models.Player, error) {
+	if armband != "" && armband != ArmbandCaptain && armband != ArmbandVice {
+		return nil, invalid("Armband must be captain or vice")
+	}
+	player, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if armband != "" {
+			if err := tx.Model(&models.Player{}).Where("team_id = ? AND armband = ?", player.TeamID, armband).
+				Update("armband", "").Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(player).Update("armband", armband).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.cache.invalidateTeam(s.db, player.TeamID)
+	return player, nil
+}
+
+// checkMove rejects moving a player into a team of another event, or a
+// player whose team changes are recorded as transfers (those keep history)
+func checkMove(db *gorm.DB, player *models.Player, teamID uint) error {
+	var from, to models.Team
+	if err := db.First(&from, player.TeamID).Error; err != nil {
+		return lookup(err, "Team")
+	}
+	if err := db.First(&to, teamID).Error; err != nil {
+		return invalidLookup(err, "Team not found")
+	}
+	if from.EventID != to.EventID {
+		return invalid("Players can only move between teams of the same event")
+	}
+	var transfers int64
+	if err := db.Model(&models.Transfer{}).Where("player_id = ?", player.ID).Count(&transfers).Error; err != nil {
+		return err
+	}
+	if transfers > 0 {
+		return conflict("%s has transfers; record another transfer instead", player.Name)
+	}
+	return checkRosterSpot(db, teamID, *player)
+}
+
+// placeInTeam puts a player who just moved at the end of the new roster,
+// without the armband of the old team
+func placeInTeam(tx *gorm.DB, player *models.Player) error {
+	order, err := nextSortOrder(tx, player.TeamID)
+	if err != nil {
+		return err
+	}
+	return tx.Model(player).Updates(map[string]interface{}{"sort_order": order, "armband": ""}).Error
+}
+
+// nextSortOrder is the roster place after the team's last player
+func nextSortOrder(tx *gorm.DB, teamID uint) (int, error) {
+	var last int
+	err := tx.Model(&models.Player{}).Where("team_id = ?", teamID).
+		Select("COALESCE(MAX(sort_order), 0)").Scan(&last).Error
+	return last + 1, err
+}
+
+// checkDetails validates the number, position and foot that are set
+func checkDetails(p models.Player) error {
+	if p.Number != nil && (*p.Number < 0 || *p.Number > 99) {
+		return invalid("Shirt number must be between 1 and 99")
+	}
+	if p.Position != "" && !isChoice(Positions, p.Position) {
+		return invalid("Position must be GK, DF, MF or FW")
+	}
+	if p.PreferredFoot != "" && !isChoice(PreferredFeet, p.PreferredFoot) {
+		return invalid("Preferred foot must be left, right or both")
+	}
+	return nil
+}
+
+func isChoice(choices []Choice, value string) bool {
+	for _, c := range choices {
+		if c.Value == value {
+			return true
+		}
+	}
+	return false
+}
+
+// checkNumber rejects a shirt number already worn in the team (except by player `self`)
+func (s *playerService) checkNumber(teamID uint, number *int, self uint) error {
+	if number == nil {
+		return nil
+	}
+	var existing models.Player
+	res := s.db.Where("team_id = ? AND number = ?", teamID, *number).Limit(1).Find(&existing)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 && existing.ID != self {
+		return conflict("#%d is already taken by %s", *number, existing.Name)
+	}
+	return nil
+}
+
+// savePhoto stores an uploaded photo with its thumbnail ("" without one)
+func (s *playerService) savePhoto(file *multipart.FileHeader) (string, string, error) {
+	if file == nil {
+		return "", "", nil
+	}
+	path, thumb, err := s.files.SaveImageWithThumb(file, "players", thumbSize)
+	if errors.Is(err, storage.ErrTooLarge) || errors.Is(err, storage.ErrNotImage) {
+		return "", "", invalid("%s", err.Error())
+	}
+	return path, thumb, err
+}
+
+func (s *playerService) removePhoto(photo, thumb string) {
+	s.files.Remove(photo)
+	if thumb != photo {
+		s.files.Remove(thumb)
+	}
+}
+
+// checkName rejects a player name already used in the team (except by player `self`)
+func (s *playerService) checkName(teamID uint, name string, self uint) error {
+	var existing models.Player
+	res := s.db.Where("team_id = ? AND name = ?", teamID, name).Limit(1).Find(&existing)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 && existing.ID != self {
+		return conflict("Player already exists")
+	}
+	return nil
+}
+
+// linkPerson points a new player at its person: the given PersonID if it
+// exists, otherwise a fresh person with the player's name. Duplicates across
+// events are joined later with PersonService.Merge.
+func linkPerson(tx *gorm.DB, player *models.Player) error {
+	if player.PersonID != nil && *player.PersonID != 0 {
+		if err := tx.First(&models.Person{}, *player.PersonID).Error; err != nil {
+			return invalidLookup(err, "Person not found")
+		}
+		return nil
+	}
+	person := models.Person{Name: player.Name}
+	if err := tx.Create(&person).Error; err != nil {
+		return err
+	}
+	player.PersonID = &person.ID
+	return nil
+}
+
+// renamePerson keeps a person's name in step with its only roster entry
+func renamePerson(tx *gorm.DB, player *models.Player) error {
+	if player.PersonID == nil {
+		return nil
+	}
+	var entries int64
+	if err := tx.Model(&models.Player{}).Where("person_id = ?", *player.PersonID).Count(&entries).Error; err != nil {
+		return err
+	}
+	if entries != 1 {
+		return nil
+	}
+	return tx.Model(&models.Person{}).Where("id = ?", *player.PersonID).Update("name", player.Name).Error
+}
+
+func (s *playerService) Report(eventID, playerID uint) (*PlayerReport, error) {
+	player, err := s.Get(playerID)
+	if err != nil {
+		return nil, err
+	}
+	r := &PlayerReport{Player: *player}
+	if err := s.db.First(&r.Team, player.TeamID).Error; err != nil {
+		return nil, lookup(err, "Team")
+	}
+	if r.Team.EventID != eventID {
+		return nil, notFound("Player not found")
+	}
+	if err := s.db.First(&r.Event, eventID).Error; err != nil {
+		return nil, lookup(err, "Event")
+	}
+
+	var games []models.Game
+	if err := s.db.Where("event_id = ?", eventID).Order("id ASC").Find(&games).Error; err != nil {
+		return nil, err
+	}
+	var teams []models.Team
+	if err := s.db.Unscoped().Where("event_id = ?", eventID).Find(&teams).Error; err != nil {
+		return nil, err
+	}
+	teamNames := make(map[uint]string, len(teams))
+	for _, t := range teams {
+		teamNames[t.ID] = t.Name
+	}
+	gamesByID := make(map[uint]models.Game, len(games))
+	for _, g := range games {
+		gamesByID[g.ID] = g
+	}
+	opponent := func(g models.Game, side uint) string {
+		if side == g.HomeTeamID {
+			return teamNames[g.AwayTeamID]
+		}
+		return teamNames[g.HomeTeamID]
+	}
+
+	// The player's goals and assists in the event, each with the player on
+	// the other end of the goal-assist link
+	var rows []struct {
+		models.GamePlayerStat
+		Partner string
+	}
+	err = s.db.Table("game_player_stats AS s").
+		Select(`s.*, COALESCE(CASE WHEN s.type = ? THEN gp.name ELSE ap.name END, '') AS partner`, models.StatTypeAssist).
+		Joins("JOIN games ON games.id = s.game_id AND games.deleted_at IS NULL").
+		Joins("LEFT JOIN game_player_stats g ON g.id = s.goal_stat_id").
+		Joins("LEFT JOIN players gp ON gp.id = g.player_id").
+		Joins(`LEFT JOIN game_player_stats a ON a.id = (
+			SELECT MIN(x.id) FROM game_player_stats x
+			WHERE x.goal_stat_id = s.id AND x.type = ? AND x.deleted_at IS NULL)`, models.StatTypeAssist).
+		Joins("LEFT JOIN players ap ON ap.id = a.player_id").
+		Where("s.player_id = ? AND games.event_id = ? AND s.deleted_at IS NULL", playerID, eventID).
+		Order("s.game_id ASC, s.minute ASC, s.id ASC").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	perGame := make(map[uint]*PlayerGameRow)
+	gameRow := func(g models.Game, side uint) *PlayerGameRow {
+		if row, ok := perGame[g.ID]; ok {
+			return row
+		}
+		row := &PlayerGameRow{GameID: g.ID, Opponent: opponent(g, side), GF: g.HomeTeamGoals, GA: g.AwayTeamGoals}
+		if side == g.AwayTeamID {
+			row.GF, row.GA = g.AwayTeamGoals, g.HomeTeamGoals
+		}
+		perGame[g.ID] = row
+		return row
+	}
+	// Appearances follow transfers and guest appearances
+	played, err := loadRosters(s.db, []uint{player.ID})
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range games {
+		if team := played.teamAt(player.ID, g.ID); g.HomeTeamID == team || g.AwayTeamID == team {
+			gameRow(g, team)
+		}
+	}
+
+	r.Goals, r.Assists = []PlayerStatRow{}, []PlayerStatRow{}
+	for _, st := range rows {
+		r.Tally.add(st.Type, 1)
+		g := gamesByID[st.GameID]
+		row := PlayerStatRow{GameID: st.GameID, Minute: st.Minute, Type: st.Type, Opponent: opponent(g, st.TeamID), Partner: st.Partner}
+		if st.Type == models.StatTypeOwnGoal {
+			// credited to the other side, which is the player's opponent
+			row.Opponent = teamNames[st.TeamID]
+		}
+		switch st.Type {
+		case models.StatTypeGoal, models.StatTypePenalty, models.StatTypeOwnGoal:
+			r.Goals = append(r.Goals, row)
+			if st.Type != models.StatTypeOwnGoal {
+				gameRow(g, st.TeamID).Goals++
+			}
+		case models.StatTypeAssist:
+			r.Assists = append(r.Assists, row)
+			gameRow(g, st.TeamID).Assists++
+		}
+	}
+
+	r.Games = make([]PlayerGameRow, 0, len(perGame))
+	for _, row := range perGame {
+		r.Games = append(r.Games, *row)
+	}
+	sort.Slice(r.Games, func(i, j int) bool { return r.Games[i].GameID < r.Games[j].GameID })
+	r.Tally.Appearances = len(r.Games)
+	awards, err := mvpAwards(s.db, []uint{player.ID})
+	if err != nil {
+		return nil, err
+	}
+	r.Tally.MVPs = awards[player.ID]
+
+	if r.Ranking, err = involvements(s.db, eventID, 0); err != nil {
+		return nil, err
+	}
+	for _, row := range r.Ranking {
+		if row.PlayerID == player.ID {
+			r.Rank = row.Rank
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"github.com/yesakov/lukyasha-tracker/storage"
+	"gorm.io/gorm"
+)
+
+func TestPlayerReport(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		ann, bob, dan := f.homePlayers[0], f.homePlayers[1], f.awayPlayers[0]
+		first, second := f.game(t), f.game(t)
+		f.goal(t, first.ID, ann, &bob)
+		f.goal(t, first.ID, bob, &ann)
+		f.goal(t, first.ID, dan, nil)
+		f.goal(t, second.ID, ann, nil)
+		// Ann's own goal is Away's and not one of her goals in the tally
+		_, err := svc.Stats.AddGoal(second.ID, GoalInput{PlayerID: ann.ID, TeamID: f.away.ID, GoalType: models.StatTypeOwnGoal})
+		must(t, err)
+
+		r, err := svc.Players.Report(f.event.ID, ann.ID)
+		must(t, err)
+		if r.Tally.Goals != 2 || r.Tally.OwnGoals != 1 || r.Tally.Assists != 1 || r.Tally.Appearances != 2 {
+			t.Fatalf("tally %+v", r.Tally)
+		}
+		if len(r.Goals) != 3 || r.Goals[0].Partner != "Bob" || r.Goals[0].Opponent != "Away" || r.Goals[2].Opponent != "Away" {
+			t.Fatalf("goals %+v", r.Goals)
+		}
+		if len(r.Assists) != 1 || r.Assists[0].Partner != "Bob" {
+			t.Fatalf("assists %+v", r.Assists)
+		}
+		if len(r.Games) != 2 || r.Games[0].GF != 2 || r.Games[0].GA != 1 || r.Games[0].Involvement() != 2 || r.Games[1].Goals != 1 {
+			t.Fatalf("games %+v", r.Games)
+		}
+		// Ann 3 (2 goals), Bob 2, Dan 1
+		if r.Rank != 1 || len(r.Ranking) != 3 || r.Ranking[1].Player != "Bob" || r.Ranking[2].Total != 1 {
+			t.Fatalf("rank %d in %+v", r.Rank, r.Ranking)
+		}
+
+		// a player is only found within their own event
+		_, err = svc.Players.Report(f.event.ID+1, ann.ID)
+		wantKind(t, err, ErrNotFound)
+	})
+}
+
+func TestPlayerDetails(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		ann, bob := f.homePlayers[0], f.homePlayers[1]
+		seven := 7
+		_, err := svc.Players.Update(ann.ID, models.Player{Number: &seven, Position: "GK", PreferredFoot: "left"}, nil)
+		must(t, err)
+
+		// numbers are unique within the team only
+		_, err = svc.Players.Update(bob.ID, models.Player{Number: &seven}, nil)
+		wantKind(t, err, ErrConflict)
+		must(t, svc.Players.Create(&models.Player{Name: "Gus", TeamID: f.away.ID, Number: &seven}))
+		hundred := 100
+		for _, bad := range []models.Player{{Position: "ST"}, {PreferredFoot: "none"}, {Number: &hundred}} {
+			_, err = svc.Players.Update(bob.ID, bad, nil)
+			wantKind(t, err, ErrValidation)
+		}
+
+		// 0 clears the number, which frees it
+		zero := 0
+		p, err := svc.Players.Update(ann.ID, models.Player{Number: &zero}, nil)
+		must(t, err)
+		if p.Number != nil || p.Position != "GK" {
+			t.Fatalf("after clearing the number: %+v", p)
+		}
+		_, err = svc.Players.Update(bob.ID, models.Player{Number: &seven}, nil)
+		must(t, err)
+	})
+}
+
+func TestPlayerPhoto(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		ann := f.homePlayers[0]
+		p, err := svc.Players.Update(ann.ID, models.Player{}, upload(t, "ann.png", 200, 100))
+		must(t, err)
+		if p.Photo == "" || p.PhotoThumb == p.Photo || !onDisk(t, svc, p.Photo) || !onDisk(t, svc, p.PhotoThumb) {
+			t.Fatalf("photo %q, thumbnail %q", p.Photo, p.PhotoThumb)
+		}
+		dir := svc.Players.(*playerService).files.Dir
+		thumb, err := os.Open(filepath.Join(dir, strings.TrimPrefix(p.PhotoThumb, storage.URLPrefix+"/")))
+		must(t, err)
+		cfg, err := png.DecodeConfig(thumb)
+		thumb.Close()
+		must(t, err)
+		if cfg.Width != thumbSize || cfg.Height != thumbSize/2 {
+			t.Fatalf("thumbnail %dx%d, want %dx%d", cfg.Width, cfg.Height, thumbSize, thumbSize/2)
+		}
+
+		// a new photo replaces both files; deleting the player removes them
+		old := *p
+		p, err = svc.Players.Update(ann.ID, models.Player{}, upload(t, "ann.png", 10, 10))
+		must(t, err)
+		if onDisk(t, svc, old.Photo) || onDisk(t, svc, old.PhotoThumb) {
+			t.Fatal("old photo left on disk")
+		}
+		must(t, svc.Players.Delete(ann.ID, DeleteRestrict))
+		if onDisk(t, svc, p.Photo) || onDisk(t, svc, p.PhotoThumb) {
+			t.Fatal("photo left on disk after the player was deleted")
+		}
+	})
+}
+
+func TestPlayerDelete(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		ann, bob := f.homePlayers[0], f.homePlayers[1]
+		game := f.game(t)
+		f.goal(t, game.ID, ann, &bob)
+		f.goal(t, game.ID, bob, nil)
+
+		// recorded stats block the delete unless it cascades
+		wantKind(t, svc.Players.Delete(ann.ID, DeleteRestrict), ErrConflict)
+		must(t, svc.Players.Delete(ann.ID, DeleteCascade))
+		g, err := svc.Games.Get(game.ID)
+		must(t, err)
+		if g.HomeTeamGoals != 1 {
+			t.Fatalf("home goals %d after the scorer was deleted, want 1", g.HomeTeamGoals)
+		}
+		var left int64
+		must(t, db.Model(&models.GamePlayerStat{}).Where("player_id = ?", ann.ID).Count(&left).Error)
+		if left != 0 {
+			t.Fatalf("%d stats left for the deleted player", left)
+		}
+		// Bob's assist went with Ann's goal
+		assists, err := svc.Standings.TopAssists(f.event.ID, 10)
+		must(t, err)
+		if len(assists) != 0 {
+			t.Fatalf("assists %+v after the goal was removed", assists)
+		}
+	})
+}
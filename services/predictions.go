@@ -0,0 +1,368 @@
+package services
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+type PredictionService interface {
+	// Board is an event's prediction page: its games with the user's tips
+	// (userID 0 for visitors), the scoring rules and the leaderboard
+	Board(eventID, userID uint) (*PredictionBoard, error)
+	// Game is one game's row of the board
+	Game(gameID, userID uint) (*PredictionGame, error)
+	// Predict sets the user's tip for a game; tips can change until it
+	// kicks off or, without a kick-off time, until its first stat is recorded
+	Predict(userID, gameID uint, tip models.Prediction) (*models.Prediction, error)
+	// SetRules changes the event's scoring until a game with tips is
+	// finished; after that the scoring is fixed
+	SetRules(eventID uint, rules PredictionRules) (*PredictionRules, error)
+	// Leaderboard ranks the users by their points in the event's finished
+	// games, so it moves as soon as a game is finished
+	Leaderboard(eventID uint) ([]PredictorRow, error)
+}
+
+// PredictionRules are the points for a tip with the exact score, the right
+// goal difference or just the right outcome. They may not grow from exact
+// to outcome, so a tip scores its best match only.
+type PredictionRules struct {
+	Exact    int `form:"exact" json:"exact"`
+	GoalDiff int `form:"goal_diff" json:"goal_diff"`
+	Outcome  int `form:"outcome" json:"outcome"`
+}
+
+// What a tip got right
+const (
+	HitExact    = "exact"
+	HitGoalDiff = "goal_diff"
+	HitOutcome  = "outcome"
+)
+
+// maxPredictionPoints and maxPredictedGoals bound rules and tips
+const (
+	maxPredictionPoints = 100
+	maxPredictedGoals   = 99
+)
+
+type PredictionGame struct {
+	Game models.Game
+	Home string
+	Away string
+	Open bool // tips are still taken: before kick-off and before any stat
+	Tips int  // how many users predicted the game
+	Mine *models.Prediction
+	// Points and Hit score Mine once the game is finished
+	Points int
+	Hit    string
+}
+
+type PredictorRow struct {
+	Rank     int // shared by users level on points and exact scores
+	UserID   uint
+	Name     string
+	Points   int
+	Exact    int
+	GoalDiff int
+	Outcome  int
+	Scored   int // finished games predicted
+}
+
+type PredictionBoard struct {
+	Event       models.Event
+	Rules       PredictionRules
+	RulesFixed  bool // a tipped game is finished, so the scoring can't change
+	Games       []PredictionGame
+	Leaderboard []PredictorRow
+}
+
+type predictionService struct {
+	db *gorm.DB
+}
+
+func rulesOf(e models.Event) PredictionRules {
+	return PredictionRules{Exact: e.PredictExact, GoalDiff: e.PredictGoalDiff, Outcome: e.PredictOutcome}
+}
+
+// score rates a tip against a finished game
+func (r PredictionRules) score(g models.Game, p models.Prediction) (int, string) {
+	tip, result := p.HomeGoals-p.AwayGoals, g.HomeTeamGoals-g.AwayTeamGoals
+	switch {
+	case p.HomeGoals == g.HomeTeamGoals && p.AwayGoals == g.AwayTeamGoals:
+		return r.Exact, HitExact
+	case tip == result:
+		return r.GoalDiff, HitGoalDiff
+	case sign(tip) == sign(result):
+		return r.Outcome, HitOutcome
+	}
+	return 0, ""
+}
+
+func sign(n int) int {
+	switch {
+	case n > 0:
+		return 1
+	case n < 0:
+		return -1
+	}
+	return 0
+}
+
+func (s *predictionService) Board(eventID, userID uint) (*PredictionBoard, error) {
+	var event models.Event
+	if err := s.db.First(&event, eventID).Error; err != nil {
+		return nil, lookup(err, "Event")
+	}
+	b := &PredictionBoard{Event: event, Rules: rulesOf(event)}
+	var games []models.Game
+	if err := s.db.Where("event_id = ?", eventID).Order("id ASC").Find(&games).Error; err != nil {
+		return nil, err
+	}
+	var err error
+	if b.RulesFixed, err = rulesFixed(s.db, eventID); err != nil {
+		return nil, err
+	}
+	if b.Games, err = s.rows(event, games, userID); err != nil {
+		return nil, err
+	}
+	if b.Leaderboard, err = s.Leaderboard(eventID); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (s *predictionService) Game(gameID, userID uint) (*PredictionGame, error) {
+	var game models.Game
+	if err := s.db.First(&game, gameID).Error; err != nil {
+		return nil, lookup(err, "Game")
+	}
+	var event models.Event
+	if err := s.db.First(&event, game.EventID).Error; err != nil {
+		return nil, lookup(err, "Event")
+	}
+	rows, err := s.rows(event, []models.Game{game}, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &rows[0], nil
+}
+
+// rows builds the board rows of games of one event with a fixed number of
+// queries
+func (s *predictionService) rows(event models.Event, games []models.Game, userID uint) ([]PredictionGame, error) {
+	out := make([]PredictionGame, len(games))
+	if len(games) == 0 {
+		return out, nil
+	}
+	ids := make([]uint, len(games))
+	for i, g := range games {
+		ids[i] = g.ID
+	}
+	var teams []models.Team
+	if err := s.db.Unscoped().Where("event_id = ?", event.ID).Find(&teams).Error; err != nil {
+		return nil, err
+	}
+	names := make(map[uint]string, len(teams))
+	for _, t := range teams {
+		names[t.ID] = t.Name
+	}
+	var counts []struct {
+		GameID uint
+		N      int
+	}
+	if err := s.db.Model(&models.Prediction{}).Select("game_id, COUNT(*) AS n").
+		Where("game_id IN ?", ids).Group("game_id").Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	tips := make(map[uint]int, len(counts))
+	for _, c := range counts {
+		tips[c.GameID] = c.N
+	}
+	started, err := startedGames(s.db, ids)
+	if err != nil {
+		return nil, err
+	}
+	mine := make(map[uint]models.Prediction)
+	if userID != 0 {
+		var own []models.Prediction
+		if err := s.db.Where("user_id = ? AND game_id IN ?", userID, ids).Find(&own).Error; err != nil {
+			return nil, err
+		}
+		for _, p := range own {
+			mine[p.GameID] = p
+		}
+	}
+
+	rules, now := rulesOf(event), time.Now()
+	for i, g := range games {
+		row := PredictionGame{Game: g, Home: names[g.HomeTeamID], Away: names[g.AwayTeamID], Open: g.Open(now) && !started[g.ID], Tips: tips[g.ID]}
+		if p, ok := mine[g.ID]; ok {
+			row.Mine = &p
+			if g.Finished() {
+				row.Points, row.Hit = rules.score(g, p)
+			}
+		}
+		out[i] = row
+	}
+	return out, nil
+}
+
+func (s *predictionService) Predict(userID, gameID uint, tip models.Prediction) (*models.Prediction, error) {
+	if tip.HomeGoals < 0 || tip.AwayGoals < 0 || tip.HomeGoals > maxPredictedGoals || tip.AwayGoals > maxPredictedGoals {
+		return nil, invalid("Goals must be between 0 and %d", maxPredictedGoals)
+	}
+	var game models.Game
+	if err := s.db.First(&game, gameID).Error; err != nil {
+		return nil, lookup(err, "Game")
+	}
+	started, err := startedGames(s.db, []uint{game.ID})
+	if err != nil {
+		return nil, err
+	}
+	if !game.Open(time.Now()) || started[game.ID] {
+		return nil, conflict("Predictions for this game are closed")
+	}
+	var p models.Prediction
+	err = s.db.Where("user_id = ? AND game_id = ?", userID, gameID).First(&p).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		p = models.Prediction{UserID: userID, GameID: gameID, HomeGoals: tip.HomeGoals, AwayGoals: tip.AwayGoals}
+		if err := s.db.Create(&p).Error; err != nil {
+			return nil, write(err, "Prediction")
+		}
+	case err != nil:
+		return nil, err
+	default:
+		p.HomeGoals, p.AwayGoals = tip.HomeGoals, tip.AwayGoals
+		if err := s.db.Model(&p).Select("home_goals", "away_goals").Updates(&p).Error; err != nil {
+			return nil, write(err, "Prediction")
+		}
+	}
+	return &p, nil
+}
+
+// startedGames tells which of the games have a stat recorded: they are under
+// way even without a kick-off time, so tips are closed
+func startedGames(db *gorm.DB, gameIDs []uint) (map[uint]bool, error) {
+	var ids []uint
+	err := db.Model(&models.GamePlayerStat{}).Distinct("game_id").
+		Where("game_id IN ?", gameIDs).Pluck("game_id", &ids).Error
+	started := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		started[id] = true
+	}
+	return started, err
+}
+
+// rulesFixed tells whether the event has a finished game with tips: points
+// have been scored with its rules, so they stay
+func rulesFixed(db *gorm.DB, eventID uint) (bool, error) {
+	var n int64
+	err := db.Model(&models.Prediction{}).
+		Joins("JOIN games ON games.id = predictions.game_id AND games.deleted_at IS NULL").
+		Where("games.event_id = ? AND games.status = ?", eventID, models.GameFinished).
+		Count(&n).Error
+	return n > 0, err
+}
+
+func (s *predictionService) SetRules(eventID uint, rules PredictionRules) (*PredictionRules, error) {
+	var event models.Event
+	if err := s.db.First(&event, eventID).Error; err != nil {
+		return nil, lookup(err, "Event")
+	}
+	for _, n := range []int{rules.Exact, rules.GoalDiff, rules.Outcome} {
+		if n < 0 || n > maxPredictionPoints {
+			return nil, invalid("Points must be between 0 and %d", maxPredictionPoints)
+		}
+	}
+	if rules.Exact < rules.GoalDiff || rules.GoalDiff < rules.Outcome {
+		return nil, invalid("An exact score can't earn less than the goal difference, nor that less than the outcome")
+	}
+	fixed, err := rulesFixed(s.db, eventID)
+	if err != nil {
+		return nil, err
+	}
+	if fixed {
+		return nil, conflict("A game with predictions is finished, so the scoring can't change")
+	}
+	err = s.db.Model(&event).Updates(map[string]interface{}{
+		"predict_exact":     rules.Exact,
+		"predict_goal_diff": rules.GoalDiff,
+		"predict_outcome":   rules.Outcome,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	return &rules, nil
+}
+
+func (s *predictionService) Leaderboard(eventID uint) ([]PredictorRow, error) {
+	var event models.Event
+	if err := s.db.First(&event, eventID).Error; err != nil {
+		return nil, lookup(err, "Event")
+	}
+	var tips []struct {
+		models.Prediction
+		Name          string
+		Status        string
+		HomeTeamGoals int
+		AwayTeamGoals int
+	}
+	err := s.db.Model(&models.Prediction{}).
+		Select("predictions.*, users.name, games.status, games.home_team_goals, games.away_team_goals").
+		Joins("JOIN games ON games.id = predictions.game_id AND games.deleted_at IS NULL").
+		Joins("JOIN users ON users.id = predictions.user_id AND users.deleted_at IS NULL").
+		Where("games.event_id = ?", eventID).
+		Scan(&tips).Error
+	if err != nil {
+		return nil, err
+	}
+	rules := rulesOf(event)
+	byUser := make(map[uint]*PredictorRow)
+	for _, t := range tips {
+		row, ok := byUser[t.UserID]
+		if !ok {
+			row = &PredictorRow{UserID: t.UserID, Name: t.Name}
+			byUser[t.UserID] = row
+		}
+		game := models.Game{Status: t.Status, HomeTeamGoals: t.HomeTeamGoals, AwayTeamGoals: t.AwayTeamGoals}
+		if !game.Finished() {
+			continue
+		}
+		row.Scored++
+		points, hit := rules.score(game, t.Prediction)
+		row.Points += points
+		switch hit {
+		case HitExact:
+			row.Exact++
+		case HitGoalDiff:
+			row.GoalDiff++
+		case HitOutcome:
+			row.Outcome++
+		}
+	}
+	out := make([]PredictorRow, 0, len(byUser))
+	for _, row := range byUser {
+		out = append(out, *row)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Points != b.Points {
+			return a.Points > b.Points
+		}
+		if a.Exact != b.Exact {
+			return a.Exact > b.Exact
+		}
+		return a.Name < b.Name
+	})
+	for i := range out {
+		out[i].Rank = i + 1
+		if i > 0 && out[i].Points == out[i-1].Points && out[i].Exact == out[i-1].Exact {
+			out[i].Rank = out[i-1].Rank
+		}
+	}
+	return out, nil
+}
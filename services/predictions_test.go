@@ -0,0 +1,111 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+func TestPredictionsClose(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		user, _, err := svc.Users.Register("tipster", "secret123")
+		must(t, err)
+		game := f.game(t)
+		tip := models.Prediction{HomeGoals: 1, AwayGoals: 0}
+
+		// no kick-off time: open until the first stat
+		_, err = svc.Predictions.Predict(user.ID, game.ID, tip)
+		must(t, err)
+		f.goal(t, game.ID, f.homePlayers[0], nil)
+		_, err = svc.Predictions.Predict(user.ID, game.ID, tip)
+		wantKind(t, err, ErrConflict)
+		row, err := svc.Predictions.Game(game.ID, user.ID)
+		must(t, err)
+		if row.Open {
+			t.Fatal("game with a goal is still open for tips")
+		}
+
+		// a finished game with tips stays finished
+		f.finish(t, game.ID)
+		_, err = svc.Games.SetStatus(game.ID, models.GameScheduled)
+		wantKind(t, err, ErrConflict)
+		_, err = svc.Games.Update(game.ID, models.Game{Status: models.GameScheduled})
+		wantKind(t, err, ErrConflict)
+
+		// without tips it can be reopened
+		other := f.game(t)
+		f.finish(t, other.ID)
+		_, err = svc.Games.SetStatus(other.ID, models.GameScheduled)
+		must(t, err)
+	})
+}
+
+func TestPredictionRulesFixed(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		user, _, err := svc.Users.Register("tipster", "secret123")
+		must(t, err)
+		rules := PredictionRules{Exact: 4, GoalDiff: 2, Outcome: 1}
+
+		// a finished game without tips doesn't fix the scoring
+		f.finish(t, f.game(t).ID)
+		_, err = svc.Predictions.SetRules(f.event.ID, rules)
+		must(t, err)
+
+		game := f.game(t)
+		_, err = svc.Predictions.Predict(user.ID, game.ID, models.Prediction{HomeGoals: 1})
+		must(t, err)
+		f.finish(t, game.ID)
+		_, err = svc.Predictions.SetRules(f.event.ID, PredictionRules{Exact: 10, GoalDiff: 5, Outcome: 1})
+		wantKind(t, err, ErrConflict)
+		board, err := svc.Predictions.Board(f.event.ID, user.ID)
+		must(t, err)
+		if !board.RulesFixed || board.Rules != rules {
+			t.Fatalf("rules %+v, fixed %v", board.Rules, board.RulesFixed)
+		}
+	})
+}
+
+func TestSettledGame(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		user, _, err := svc.Users.Register("tipster", "secret123")
+		must(t, err)
+		kickoff := time.Now().Add(time.Hour)
+		game := f.game(t)
+		_, err = svc.Predictions.Predict(user.ID, game.ID, models.Prediction{HomeGoals: 1})
+		must(t, err)
+		f.goal(t, game.ID, f.homePlayers[0], &f.homePlayers[1])
+		f.finish(t, game.ID)
+
+		// the tips were scored against this result
+		_, err = svc.Games.SetKickoff(game.ID, &kickoff)
+		wantKind(t, err, ErrConflict)
+		_, err = svc.Games.Update(game.ID, models.Game{AwayTeamGoals: 3})
+		wantKind(t, err, ErrConflict)
+		_, err = svc.Stats.AddGoal(game.ID, GoalInput{PlayerID: f.awayPlayers[0].ID, TeamID: f.away.ID})
+		wantKind(t, err, ErrConflict)
+		rows, err := svc.Stats.GoalRows(game.ID)
+		must(t, err)
+		wantKind(t, svc.Stats.Delete(rows[0].ID), ErrConflict)
+		wantKind(t, svc.Players.Delete(f.homePlayers[0].ID, DeleteCascade), ErrConflict)
+		g, err := svc.Games.Get(game.ID)
+		must(t, err)
+		if g.HomeTeamGoals != 1 || g.AwayTeamGoals != 0 || g.KickoffAt != nil {
+			t.Fatalf("settled game changed: %d:%d, kick-off %v", g.HomeTeamGoals, g.AwayTeamGoals, g.KickoffAt)
+		}
+
+		// cards don't touch the score
+		must(t, svc.Stats.AddCard(game.ID, CardInput{PlayerID: f.awayPlayers[0].ID, TeamID: f.away.ID, CardType: models.StatTypeYellowCard}))
+
+		// a finished game without tips can still be corrected
+		other := f.game(t)
+		f.finish(t, other.ID)
+		f.goal(t, other.ID, f.awayPlayers[0], nil)
+		_, err = svc.Games.SetKickoff(other.ID, &kickoff)
+		must(t, err)
+	})
+}
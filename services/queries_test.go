@@ -0,0 +1,175 @@
+package services
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/yesakov/lukyasha-tracker/database"
+	"github.com/yesakov/lukyasha-tracker/database/dbtest"
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+// queryCounter counts the statements gorm runs on a database
+type queryCounter struct {
+	n atomic.Int64
+}
+
+func countQueries(tb testing.TB, db *gorm.DB) *queryCounter {
+	tb.Helper()
+	c := &queryCounter{}
+	count := func(*gorm.DB) { c.n.Add(1) }
+	cb := db.Callback()
+	must(tb, cb.Query().After("gorm:query").Register("test:count_query", count))
+	must(tb, cb.Row().After("gorm:row").Register("test:count_row", count))
+	must(tb, cb.Raw().After("gorm:raw").Register("test:count_raw", count))
+	return c
+}
+
+// during returns how many queries fn ran
+func (c *queryCounter) during(tb testing.TB, fn func() error) int64 {
+	tb.Helper()
+	before := c.n.Load()
+	must(tb, fn())
+	return c.n.Load() - before
+}
+
+// seedGoals gives the fixture an event of n goals, each with an assist, all
+// in its first game, and lets the rest of the event grow with n: a game and
+// a player per team for every ten goals. It returns the first game.
+func seedGoals(tb testing.TB, f *fixture, n int) models.Game {
+	tb.Helper()
+	first := f.game(tb)
+	for i := 1; i < n/10; i++ {
+		f.game(tb)
+		f.player(tb, f.home.ID, fmt.Sprintf("Home %d", i))
+		f.player(tb, f.away.ID, fmt.Sprintf("Away %d", i))
+	}
+	players := append(append([]models.Player{}, f.homePlayers...), f.awayPlayers...)
+	goals := make([]models.GamePlayerStat, n)
+	for i := range goals {
+		p := players[i%len(players)]
+		goals[i] = models.GamePlayerStat{GameID: first.ID, PlayerID: p.ID, TeamID: p.TeamID, Type: models.StatTypeGoal, Minute: i % 90}
+	}
+	must(tb, f.db.CreateInBatches(&goals, 100).Error)
+	assists := make([]models.GamePlayerStat, n)
+	for i, g := range goals {
+		p := players[(i+1)%len(players)]
+		if p.TeamID != g.TeamID {
+			p = players[(i+len(players)/2+1)%len(players)]
+		}
+		assists[i] = models.GamePlayerStat{GameID: first.ID, PlayerID: p.ID, TeamID: p.TeamID, Type: models.StatTypeAssist, Minute: g.Minute, GoalStatID: &goals[i].ID}
+	}
+	must(tb, f.db.CreateInBatches(&assists, 100).Error)
+	return first
+}
+
+// queryCounts runs the timeline, the leaderboards and the rosters of a
+// seeded event and counts the queries of each
+func queryCounts(t *testing.T, goals int) map[string]int64 {
+	db := dbtest.Open(t, database.DriverSQLite)
+	svc := newServices(t, db)
+	f := newFixture(t, svc, db)
+	game := seedGoals(t, f, goals)
+	c := countQueries(t, db)
+
+	counts := map[string]int64{}
+	counts["goal rows"] = c.during(t, func() error {
+		rows, err := svc.Stats.GoalRows(game.ID)
+		if err == nil && len(rows) != goals {
+			err = fmt.Errorf("%d goal rows, want %d", len(rows), goals)
+		}
+		return err
+	})
+	counts["standings"] = c.during(t, func() error {
+		_, err := svc.Standings.Standings(f.event.ID)
+		return err
+	})
+	counts["top scorers"] = c.during(t, func() error {
+		_, err := svc.Standings.TopScorers(f.event.ID, 10)
+		return err
+	})
+	counts["top assists"] = c.during(t, func() error {
+		_, err := svc.Standings.TopAssists(f.event.ID, 10)
+		return err
+	})
+	counts["teams"] = c.during(t, func() error {
+		_, err := svc.Events.Teams(f.event.ID)
+		return err
+	})
+	return counts
+}
+
+// TestQueryCounts guards against queries per row: an event of 1,000 goals
+// takes as many queries as one of 10
+func TestQueryCounts(t *testing.T) {
+	small := queryCounts(t, 10)
+	large := queryCounts(t, 1000)
+	for name, n := range small {
+		if n == 0 {
+			t.Errorf("%s: no queries counted", name)
+		}
+		if large[name] != n {
+			t.Errorf("%s: %d queries at 10 goals, %d at 1,000", name, n, large[name])
+		}
+	}
+}
+
+func benchmarkFixture(b *testing.B, goals int) (*fixture, models.Game) {
+	db := dbtest.Open(b, database.DriverSQLite)
+	f := newFixture(b, newServices(b, db), db)
+	return f, seedGoals(b, f, goals)
+}
+
+func BenchmarkGoalRows(b *testing.B) {
+	f, game := benchmarkFixture(b, 1000)
+	for b.Loop() {
+		_, err := f.svc.Stats.GoalRows(game.ID)
+		must(b, err)
+	}
+}
+
+func BenchmarkStandings(b *testing.B) {
+	f, _ := benchmarkFixture(b, 1000)
+	for b.Loop() {
+		_, err := f.svc.Standings.Standings(f.event.ID)
+		must(b, err)
+	}
+}
+
+func BenchmarkTopScorers(b *testing.B) {
+	f, _ := benchmarkFixture(b, 1000)
+	for b.Loop() {
+		_, err := f.svc.Standings.TopScorers(f.event.ID, 10)
+		must(b, err)
+	}
+}
+
+func BenchmarkTopAssists(b *testing.B) {
+	f, _ := benchmarkFixture(b, 1000)
+	for b.Loop() {
+		_, err := f.svc.Standings.TopAssists(f.event.ID, 10)
+		must(b, err)
+	}
+}
+
+// BenchmarkEventStats measures the uncached statistics page; the cache is
+// dropped before every run
+func BenchmarkEventStats(b *testing.B) {
+	f, _ := benchmarkFixture(b, 1000)
+	cache := f.svc.Standings.(*standingsService).cache
+	for b.Loop() {
+		cache.invalidate(f.event.ID)
+		_, err := f.svc.Standings.EventStats(f.event.ID, 0, 10)
+		must(b, err)
+	}
+}
+
+func BenchmarkEventTeams(b *testing.B) {
+	f, _ := benchmarkFixture(b, 1000)
+	for b.Loop() {
+		_, err := f.svc.Events.Teams(f.event.ID)
+		must(b, err)
+	}
+}
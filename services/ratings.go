@@ -0,0 +1,448 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+type RatingService interface {
+	// Person returns the person's current rating with its history, one
+	// point per finished game they played
+	Person(personID uint) (*RatingHistory, error)
+	// Current returns everyone's current rating by person
+	Current() (map[uint]float64, error)
+	// Team is the team's own rating: it starts from its lineup's average in
+	// its first finished game and moves with each result; before that it is
+	// the roster's average
+	Team(teamID uint) (int, error)
+	// Odds are a game's pre-match team ratings and win probabilities: from
+	// the ratings going into it once finished, from current ones before
+	Odds(gameID uint) (*GameOdds, error)
+}
+
+// RatingPoint is a person's rating after one game
+type RatingPoint struct {
+	GameID  uint
+	EventID uint
+	Event   string
+	Date    string
+	Rating  int
+	Delta   int
+}
+
+type RatingHistory struct {
+	PersonID uint
+	Rating   int
+	Points   []RatingPoint // oldest first
+}
+
+// GameOdds compares the two lineups of a game
+type GameOdds struct {
+	GameID   uint
+	Home     int // average rating of the lineup
+	Away     int
+	HomeWin  int // win probability in percent (the Elo expected score)
+	AwayWin  int
+	Finished bool
+	// Changes are the individual rating changes of a finished game
+	Changes []RatingChange
+}
+
+type RatingChange struct {
+	PersonID uint
+	Player   string
+	TeamID   uint
+	Before   int
+	After    int
+	Delta    int
+}
+
+// Elo settings. A lineup's rating is the average of its players'; each
+// player then gains or loses K times the goal margin factor times the
+// difference between the result and what their own rating predicted
+// against the opposing lineup. Teams move the same way against each other's
+// team rating.
+const (
+	initialRating = 1500.0
+	eloK          = 32.0
+)
+
+// marginFactor weighs bigger wins more, as the World Football Elo does
+func marginFactor(goalDiff int) float64 {
+	if goalDiff < 0 {
+		goalDiff = -goalDiff
+	}
+	switch {
+	case goalDiff <= 1:
+		return 1
+	case goalDiff == 2:
+		return 1.5
+	}
+	return (11 + float64(goalDiff)) / 8
+}
+
+// expected is the Elo expected score of a rating against another
+func expected(rating, opponent float64) float64 {
+	return 1 / (1 + math.Pow(10, (opponent-rating)/400))
+}
+
+type ratingService struct {
+	db    *gorm.DB
+	cache *eventCache
+
+	mu      sync.Mutex
+	book    *ratingBook
+	version uint64
+}
+
+// ratingBook is every finished game replayed in order of event date
+type ratingBook struct {
+	current map[uint]float64       // person -> rating
+	history map[uint][]RatingPoint // person -> points
+	teams   map[uint]float64       // team -> rating, once it played
+	games   map[uint]*GameOdds
+}
+
+func (s *ratingService) Person(personID uint) (*RatingHistory, error) {
+	if err := s.db.First(&models.Person{}, personID).Error; err != nil {
+		return nil, lookup(err, "Person")
+	}
+	b, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	h := &RatingHistory{PersonID: personID, Rating: int(math.Round(b.rating(personID))), Points: b.history[personID]}
+	if h.Points == nil {
+		h.Points = []RatingPoint{}
+	}
+	return h, nil
+}
+
+func (s *ratingService) Current() (map[uint]float64, error) {
+	b, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[uint]float64, len(b.current))
+	for id, r := range b.current {
+		out[id] = r
+	}
+	return out, nil
+}
+
+func (s *ratingService) Team(teamID uint) (int, error) {
+	b, err := s.load()
+	if err != nil {
+		return 0, err
+	}
+	if r, ok := b.teams[teamID]; ok {
+		return int(math.Round(r)), nil
+	}
+	var personIDs []uint
+	if err := s.db.Model(&models.Player{}).Where("team_id = ? AND person_id IS NOT NULL", teamID).
+		Pluck("person_id", &personIDs).Error; err != nil {
+		return 0, err
+	}
+	return int(math.Round(b.average(personIDs))), nil
+}
+
+func (s *ratingService) Odds(gameID uint) (*GameOdds, error) {
+	var game models.Game
+	if err := s.db.First(&game, gameID).Error; err != nil {
+		return nil, lookup(err, "Game")
+	}
+	b, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	if odds, ok := b.games[game.ID]; ok {
+		return odds, nil
+	}
+	// not rated (yet): the lineups as they stand, at current ratings
+	lineups, err := loadLineups(s.db, []uint{game.EventID})
+	if err != nil {
+		return nil, err
+	}
+	home, away := lineups.at(game)
+	odds := b.odds(game, home, away)
+	return odds, nil
+}
+
+// load returns the cached book while no event changed since it was built
+func (s *ratingService) load() (*ratingBook, error) {
+	v := s.cache.allVersion()
+	s.mu.Lock()
+	if s.book != nil && s.version == v {
+		b := s.book
+		s.mu.Unlock()
+		return b, nil
+	}
+	s.mu.Unlock()
+	b, err := buildRatings(s.db)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	if s.cache.allVersion() == v {
+		s.book, s.version = b, v
+	}
+	s.mu.Unlock()
+	return b, nil
+}
+
+func (b *ratingBook) rating(personID uint) float64 {
+	if r, ok := b.current[personID]; ok {
+		return r
+	}
+	return initialRating
+}
+
+func (b *ratingBook) average(personIDs []uint) float64 {
+	if len(personIDs) == 0 {
+		return initialRating
+	}
+	sum := 0.0
+	for _, id := range personIDs {
+		sum += b.rating(id)
+	}
+	return sum / float64(len(personIDs))
+}
+
+// odds rates the lineups at the book's current ratings
+func (b *ratingBook) odds(game models.Game, home, away []lineupPlayer) *GameOdds {
+	h, a := b.average(personIDsOf(home)), b.average(personIDsOf(away))
+	e := expected(h, a)
+	return &GameOdds{
+		GameID:  game.ID,
+		Home:    int(math.Round(h)),
+		Away:    int(math.Round(a)),
+		HomeWin: int(math.Round(e * 100)),
+		AwayWin: 100 - int(math.Round(e*100)),
+	}
+}
+
+// buildRatings replays every finished game of live events in date order
+func buildRatings(db *gorm.DB) (*ratingBook, error) {
+	b := &ratingBook{current: map[uint]float64{}, history: map[uint][]RatingPoint{},
+		teams: map[uint]float64{}, games: map[uint]*GameOdds{}}
+	var games []struct {
+		models.Game
+		EventName string
+		EventDate string
+	}
+	err := db.Model(&models.Game{}).
+		Select("games.*, events.name AS event_name, events.date AS event_date").
+		Joins("JOIN events ON events.id = games.event_id AND events.deleted_at IS NULL").
+		Where("games.status = ?", models.GameFinished).
+		Order("events.date ASC, games.id ASC").
+		Scan(&games).Error
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[uint]bool)
+	var eventIDs []uint
+	for _, g := range games {
+		if !seen[g.EventID] {
+			seen[g.EventID] = true
+			eventIDs = append(eventIDs, g.EventID)
+		}
+	}
+	lineups, err := loadLineups(db, eventIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, g := range games {
+		home, away := lineups.at(g.Game)
+		odds := b.odds(g.Game, home, away)
+		odds.Finished = true
+		b.games[g.ID] = odds
+		homeAvg, awayAvg := b.average(personIDsOf(home)), b.average(personIDsOf(away))
+		homeScore := 0.5
+		if g.HomeTeamGoals > g.AwayTeamGoals {
+			homeScore = 1
+		} else if g.HomeTeamGoals < g.AwayTeamGoals {
+			homeScore = 0
+		}
+		k := eloK * marginFactor(g.HomeTeamGoals-g.AwayTeamGoals)
+
+		// teams start from their lineup's average in their first game
+		homeTeam, ok := b.teams[g.HomeTeamID]
+		if !ok {
+			homeTeam = homeAvg
+		}
+		awayTeam, ok := b.teams[g.AwayTeamID]
+		if !ok {
+			awayTeam = awayAvg
+		}
+		b.teams[g.HomeTeamID] = homeTeam + k*(homeScore-expected(homeTeam, awayTeam))
+		b.teams[g.AwayTeamID] = awayTeam + k*((1-homeScore)-expected(awayTeam, homeTeam))
+		if len(home) == 0 || len(away) == 0 {
+			continue
+		}
+
+		// every rating moves against the ratings going into the game
+		type move struct {
+			p      lineupPlayer
+			team   uint
+			before float64
+			delta  float64
+		}
+		var moves []move
+		for _, p := range home {
+			r := b.rating(p.personID)
+			moves = append(moves, move{p, g.HomeTeamID, r, k * (homeScore - expected(r, awayAvg))})
+		}
+		for _, p := range away {
+			r := b.rating(p.personID)
+			moves = append(moves, move{p, g.AwayTeamID, r, k * ((1 - homeScore) - expected(r, homeAvg))})
+		}
+		for _, m := range moves {
+			after := m.before + m.delta
+			b.current[m.p.personID] = after
+			b.history[m.p.personID] = append(b.history[m.p.personID], RatingPoint{
+				GameID: g.ID, EventID: g.EventID, Event: g.EventName, Date: g.EventDate,
+				Rating: int(math.Round(after)), Delta: int(math.Round(after)) - int(math.Round(m.before)),
+			})
+			odds.Changes = append(odds.Changes, RatingChange{
+				PersonID: m.p.personID, Player: m.p.name, TeamID: m.team,
+				Before: int(math.Round(m.before)), After: int(math.Round(after)),
+				Delta: int(math.Round(after)) - int(math.Round(m.before)),
+			})
+		}
+	}
+	return b, nil
+}
+
+type lineupPlayer struct {
+	playerID uint
+	personID uint
+	name     string
+}
+
+func personIDsOf(players []lineupPlayer) []uint {
+	out := make([]uint, len(players))
+	for i, p := range players {
+		out[i] = p.personID
+	}
+	return out
+}
+
+// lineups knows who played for which team in the events' games: the team's
+// roster at the time, following transfers and guest appearances
+type lineups struct {
+	players map[uint][]lineupPlayer // event -> players with a person
+	rosters *rosters
+}
+
+func loadLineups(db *gorm.DB, eventIDs []uint) (*lineups, error) {
+	l := &lineups{players: map[uint][]lineupPlayer{}, rosters: &rosters{}}
+	if len(eventIDs) == 0 {
+		return l, nil
+	}
+	var rows []struct {
+		ID       uint
+		PersonID uint
+		Name     string
+		EventID  uint
+	}
+	err := db.Model(&models.Player{}).
+		Select("players.id, players.person_id, players.name, teams.event_id").
+		Joins("JOIN teams ON teams.id = players.team_id AND teams.deleted_at IS NULL").
+		Where("teams.event_id IN ? AND players.person_id IS NOT NULL", eventIDs).
+		Order("players.id ASC").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint, len(rows))
+	for i, r := range rows {
+		ids[i] = r.ID
+		l.players[r.EventID] = append(l.players[r.EventID], lineupPlayer{r.ID, r.PersonID, r.Name})
+	}
+	if l.rosters, err = loadRosters(db, ids); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// at returns the home and away lineups of a game
+func (l *lineups) at(game models.Game) (home, away []lineupPlayer) {
+	for _, p := range l.players[game.EventID] {
+		switch l.rosters.teamAt(p.playerID, game.ID) {
+		case game.HomeTeamID:
+			home = append(home, p)
+		case game.AwayTeamID:
+			away = append(away, p)
+		}
+	}
+	return home, away
+}
+
+// Rating chart geometry, in SVG user units
+const (
+	chartWidth  = 600
+	chartHeight = 160
+	chartPad    = 8
+)
+
+// Low and High bound the chart's rating axis, 1500 always included
+func (h RatingHistory) Low() int {
+	low := int(initialRating)
+	for _, p := range h.Points {
+		if p.Rating < low {
+			low = p.Rating
+		}
+	}
+	return low
+}
+
+func (h RatingHistory) High() int {
+	high := int(initialRating)
+	for _, p := range h.Points {
+		if p.Rating > high {
+			high = p.Rating
+		}
+	}
+	return high
+}
+
+// Polyline is the SVG points of the rating over time, starting from the
+// initial rating before the first game
+func (h RatingHistory) Polyline() string {
+	if len(h.Points) == 0 {
+		return ""
+	}
+	ratings := []int{int(initialRating)}
+	for _, p := range h.Points {
+		ratings = append(ratings, p.Rating)
+	}
+	low, high := h.Low(), h.High()
+	span := float64(high - low)
+	if span < 1 {
+		span = 1
+	}
+	step := float64(chartWidth-2*chartPad) / float64(len(ratings)-1)
+	parts := make([]string, len(ratings))
+	for i, r := range ratings {
+		x := chartPad + step*float64(i)
+		y := chartPad + float64(chartHeight-2*chartPad)*(1-float64(r-low)/span)
+		parts[i] = fmt.Sprintf("%.1f,%.1f", x, y)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Baseline is the y of the initial rating, for the chart's reference line
+func (h RatingHistory) Baseline() string {
+	span := float64(h.High() - h.Low())
+	if span < 1 {
+		span = 1
+	}
+	y := chartPad + float64(chartHeight-2*chartPad)*(1-(initialRating-float64(h.Low()))/span)
+	return fmt.Sprintf("%.1f", y)
+}
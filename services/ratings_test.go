@@ -0,0 +1,83 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+func TestRatings(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		ann, dan := f.homePlayers[0], f.awayPlayers[0]
+		rating := func(p models.Player) int {
+			t.Helper()
+			h, err := svc.Ratings.Person(*p.PersonID)
+			must(t, err)
+			return h.Rating
+		}
+		team := func(id uint) int {
+			t.Helper()
+			r, err := svc.Ratings.Team(id)
+			must(t, err)
+			return r
+		}
+
+		// scheduled games don't count
+		g1 := f.game(t)
+		f.goal(t, g1.ID, ann, nil)
+		odds, err := svc.Ratings.Odds(g1.ID)
+		must(t, err)
+		if odds.Finished || odds.HomeWin != 50 || rating(ann) != 1500 {
+			t.Fatalf("before the final whistle: odds %+v, Ann %d", odds, rating(ann))
+		}
+
+		// a 1:0 between equals moves everyone by K/2
+		f.finish(t, g1.ID)
+		if rating(ann) != 1516 || rating(dan) != 1484 || team(f.home.ID) != 1516 || team(f.away.ID) != 1484 {
+			t.Fatalf("after 1:0: Ann %d, Dan %d, teams %d/%d", rating(ann), rating(dan), team(f.home.ID), team(f.away.ID))
+		}
+		odds, err = svc.Ratings.Odds(g1.ID)
+		must(t, err)
+		if !odds.Finished || len(odds.Changes) != 6 || odds.Home != 1500 {
+			t.Fatalf("odds of the finished game %+v", odds)
+		}
+
+		// a 2:0 weighs 1.5 and the favourite gains less than half of it
+		g2 := f.game(t)
+		f.goal(t, g2.ID, ann, nil)
+		f.goal(t, g2.ID, ann, nil)
+		odds, err = svc.Ratings.Odds(g2.ID)
+		must(t, err)
+		if odds.HomeWin != 55 {
+			t.Fatalf("home win odds %d%%, want 55%%", odds.HomeWin)
+		}
+		f.finish(t, g2.ID)
+		if rating(ann) != 1538 || team(f.home.ID) != 1538 || team(f.away.ID) != 1462 {
+			t.Fatalf("after 2:0: Ann %d, teams %d/%d", rating(ann), team(f.home.ID), team(f.away.ID))
+		}
+		h, err := svc.Ratings.Person(*ann.PersonID)
+		must(t, err)
+		if len(h.Points) != 2 || h.Points[1].Delta != 22 {
+			t.Fatalf("Ann's history %+v", h.Points)
+		}
+
+		// reopening a game takes it out again
+		_, err = svc.Games.SetStatus(g2.ID, models.GameScheduled)
+		must(t, err)
+		if rating(ann) != 1516 || team(f.home.ID) != 1516 {
+			t.Fatalf("after reopening: Ann %d, Home %d", rating(ann), team(f.home.ID))
+		}
+
+		// a team that hasn't played is rated by its roster
+		event, _ := secondEvent(t, f, "Ann", ann.PersonID)
+		teams, err := svc.Teams.ListByEvent(event.ID)
+		must(t, err)
+		for _, tm := range teams {
+			if want := map[string]int{"Blue": 1516, "Green": 1500}[tm.Name]; team(tm.ID) != want {
+				t.Fatalf("%s rated %d, want %d", tm.Name, team(tm.ID), want)
+			}
+		}
+	})
+}
@@ -0,0 +1,365 @@
+package services
+
+import (
+	"sort"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+// Records are the event's derived goal metrics. Scorers' goals are normal
+// and penalty goals; own goals are only counted in OwnGoals and the buckets.
+type Records struct {
+	HatTricks    []GameFeat // three or more goals in one game
+	Braces       []GameFeat // exactly two
+	Decisive     []DecisiveRow
+	Buckets      []GoalBucket
+	Goals        int // all goals, own goals included
+	Penalties    int
+	PenaltyShare int // percent of Goals, rounded
+	// Penalty attempts: scored plus missed and saved ones
+	PenaltiesTaken    int
+	PenaltyConversion int // percent of PenaltiesTaken scored, rounded
+	PenaltyTakers     []PenaltyRow
+	PenaltySaves      []LeaderRow // per goalkeeper
+	OwnGoals          []LeaderRow
+	Duos              []Duo
+}
+
+// GameFeat is a player's haul in one game
+type GameFeat struct {
+	GameID   uint
+	PlayerID uint
+	Player   string
+	Team     string
+	Opponent string
+	Goals    int
+}
+
+// DecisiveRow counts the games a player scored the first, the last or the
+// winning goal of; the winning goal is the one that put the winner ahead
+// for good
+type DecisiveRow struct {
+	PlayerID uint
+	Player   string
+	Team     string
+	First    int
+	Last     int
+	Winning  int
+}
+
+// PenaltyRow is a taker's penalty record
+type PenaltyRow struct {
+	PlayerID uint
+	Player   string
+	Team     string
+	Scored   int
+	Missed   int
+	Saved    int
+}
+
+type GoalBucket struct {
+	Label string
+	Goals int
+}
+
+// Duo counts goals scored by Scorer from Assister's assists
+type Duo struct {
+	ScorerID   uint
+	Scorer     string
+	AssisterID uint
+	Assister   string
+	Team       string
+	Goals      int
+}
+
+type recordStat struct {
+	ID         uint
+	GameID     uint
+	PlayerID   uint
+	TeamID     uint // credited team
+	Type       string
+	Minute     int
+	GoalStatID *uint
+	Player     string
+	Team       string // the player's own team
+
+	GoalkeeperID *uint
+	Goalkeeper   string
+	KeeperTeam   string
+}
+
+func (s *standingsService) Records(eventID uint) (*Records, error) {
+	return records(s.db, eventID)
+}
+
+func records(db *gorm.DB, eventID uint) (*Records, error) {
+	r := &Records{HatTricks: []GameFeat{}, Braces: []GameFeat{}, Decisive: []DecisiveRow{},
+		Buckets: []GoalBucket{}, PenaltyTakers: []PenaltyRow{}, PenaltySaves: []LeaderRow{}, OwnGoals: []LeaderRow{}, Duos: []Duo{}}
+	var games []models.Game
+	if err := db.Where("event_id = ?", eventID).Find(&games).Error; err != nil {
+		return nil, err
+	}
+	var teams []models.Team
+	if err := db.Unscoped().Where("event_id = ?", eventID).Find(&teams).Error; err != nil {
+		return nil, err
+	}
+	var stats []recordStat
+	err := db.Model(&models.GamePlayerStat{}).
+		Select(`game_player_stats.id, game_player_stats.game_id, game_player_stats.player_id,
+			game_player_stats.team_id, game_player_stats.type, game_player_stats.minute,
+			game_player_stats.goal_stat_id, COALESCE(players.name, '') AS player, COALESCE(teams.name, '') AS team,
+			game_player_stats.goalkeeper_id, COALESCE(gk.name, '') AS goalkeeper, COALESCE(gkt.name, '') AS keeper_team`).
+		Joins("JOIN games ON games.id = game_player_stats.game_id AND games.deleted_at IS NULL").
+		Joins("LEFT JOIN players ON players.id = game_player_stats.player_id").
+		Joins("LEFT JOIN teams ON teams.id = "+playedForSQL).
+		Joins("LEFT JOIN players gk ON gk.id = game_player_stats.goalkeeper_id").
+		// the goalkeeper faced the taking team, so kept goal for the other side
+		Joins(`LEFT JOIN teams gkt ON gk.id IS NOT NULL AND gkt.id =
+			CASE WHEN games.home_team_id = game_player_stats.team_id THEN games.away_team_id ELSE games.home_team_id END`).
+		Where("games.event_id = ? AND game_player_stats.type IN ?", eventID, append([]string{models.StatTypeAssist}, timelineTypes...)).
+		Order("game_player_stats.id ASC").
+		Scan(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+
+	teamName := make(map[uint]string, len(teams))
+	for _, t := range teams {
+		teamName[t.ID] = t.Name
+	}
+	players := make(map[uint]recordStat)
+	goalsByGame := make(map[uint][]recordStat)
+	goalByID := make(map[uint]recordStat)
+	var assists []recordStat
+	ownGoals := make(map[uint]int)
+	takers := make(map[uint]*PenaltyRow)
+	taker := func(st recordStat) *PenaltyRow {
+		t := takers[st.PlayerID]
+		if t == nil {
+			t = &PenaltyRow{PlayerID: st.PlayerID, Player: st.Player, Team: st.Team}
+			takers[st.PlayerID] = t
+		}
+		return t
+	}
+	saves := make(map[uint]int)
+	buckets := make([]int, len(periods))
+	for _, st := range stats {
+		players[st.PlayerID] = st
+		switch st.Type {
+		case models.StatTypeAssist:
+			assists = append(assists, st)
+			continue
+		case models.StatTypeSave:
+			continue
+		case models.StatTypePenaltyMissed, models.StatTypePenaltySaved:
+			r.PenaltiesTaken++
+			if st.Type == models.StatTypePenaltyMissed {
+				taker(st).Missed++
+			} else {
+				taker(st).Saved++
+			}
+			if st.Type == models.StatTypePenaltySaved && st.GoalkeeperID != nil {
+				saves[*st.GoalkeeperID]++
+				players[*st.GoalkeeperID] = recordStat{PlayerID: *st.GoalkeeperID, Player: st.Goalkeeper, Team: st.KeeperTeam}
+			}
+			continue
+		}
+		goalsByGame[st.GameID] = append(goalsByGame[st.GameID], st)
+		goalByID[st.ID] = st
+		r.Goals++
+		for i, p := range periods {
+			if st.Minute >= p.from && st.Minute <= p.to {
+				buckets[i]++
+				break
+			}
+		}
+		switch st.Type {
+		case models.StatTypePenalty:
+			r.Penalties++
+			r.PenaltiesTaken++
+			taker(st).Scored++
+		case models.StatTypeOwnGoal:
+			ownGoals[st.PlayerID]++
+		}
+	}
+	if r.Goals > 0 {
+		r.PenaltyShare = (r.Penalties*100 + r.Goals/2) / r.Goals
+	}
+	if r.PenaltiesTaken > 0 {
+		r.PenaltyConversion = (r.Penalties*100 + r.PenaltiesTaken/2) / r.PenaltiesTaken
+	}
+	for _, t := range takers {
+		r.PenaltyTakers = append(r.PenaltyTakers, *t)
+	}
+	sort.Slice(r.PenaltyTakers, func(i, j int) bool {
+		a, b := r.PenaltyTakers[i], r.PenaltyTakers[j]
+		if a.Scored+a.Missed+a.Saved != b.Scored+b.Missed+b.Saved {
+			return a.Scored+a.Missed+a.Saved > b.Scored+b.Missed+b.Saved
+		}
+		if a.Scored != b.Scored {
+			return a.Scored > b.Scored
+		}
+		return a.Player < b.Player
+	})
+	for i, p := range periods {
+		if p.label == "No minute" && buckets[i] == 0 {
+			continue
+		}
+		r.Buckets = append(r.Buckets, GoalBucket{Label: p.label, Goals: buckets[i]})
+	}
+
+	decisive := make(map[uint]*DecisiveRow)
+	row := func(pid uint) *DecisiveRow {
+		d := decisive[pid]
+		if d == nil {
+			p := players[pid]
+			d = &DecisiveRow{PlayerID: pid, Player: p.Player, Team: p.Team}
+			decisive[pid] = d
+		}
+		return d
+	}
+	for _, g := range games {
+		goals := timeline(goalsByGame[g.ID])
+		opponent := func(teamID uint) string {
+			if teamID == g.HomeTeamID {
+				return teamName[g.AwayTeamID]
+			}
+			return teamName[g.HomeTeamID]
+		}
+
+		hauls := make(map[uint]int)
+		for _, st := range goals {
+			if st.Type != models.StatTypeOwnGoal {
+				hauls[st.PlayerID]++
+			}
+		}
+		for pid, n := range hauls {
+			if n < 2 {
+				continue
+			}
+			p := players[pid]
+			var credited uint
+			for _, st := range goals {
+				if st.PlayerID == pid && st.Type != models.StatTypeOwnGoal {
+					credited = st.TeamID
+				}
+			}
+			feat := GameFeat{GameID: g.ID, PlayerID: pid, Player: p.Player, Team: teamName[credited], Opponent: opponent(credited), Goals: n}
+			if n >= 3 {
+				r.HatTricks = append(r.HatTricks, feat)
+			} else {
+				r.Braces = append(r.Braces, feat)
+			}
+		}
+
+		if len(goals) > 0 {
+			if st := goals[0]; st.Type != models.StatTypeOwnGoal {
+				row(st.PlayerID).First++
+			}
+			if st := goals[len(goals)-1]; st.Type != models.StatTypeOwnGoal {
+				row(st.PlayerID).Last++
+			}
+		}
+		winner, loserGoals := g.HomeTeamID, g.AwayTeamGoals
+		if g.AwayTeamGoals > g.HomeTeamGoals {
+			winner, loserGoals = g.AwayTeamID, g.HomeTeamGoals
+		} else if g.AwayTeamGoals == g.HomeTeamGoals {
+			continue
+		}
+		n := 0
+		for _, st := range goals {
+			if st.TeamID != winner {
+				continue
+			}
+			if n++; n == loserGoals+1 {
+				if st.Type != models.StatTypeOwnGoal {
+					row(st.PlayerID).Winning++
+				}
+				break
+			}
+		}
+	}
+
+	sortFeats := func(list []GameFeat) {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Goals != list[j].Goals {
+				return list[i].Goals > list[j].Goals
+			}
+			if list[i].Player != list[j].Player {
+				return list[i].Player < list[j].Player
+			}
+			return list[i].GameID < list[j].GameID
+		})
+	}
+	sortFeats(r.HatTricks)
+	sortFeats(r.Braces)
+	for _, d := range decisive {
+		r.Decisive = append(r.Decisive, *d)
+	}
+	sort.Slice(r.Decisive, func(i, j int) bool {
+		a, b := r.Decisive[i], r.Decisive[j]
+		if a.Winning != b.Winning {
+			return a.Winning > b.Winning
+		}
+		if a.First+a.Last != b.First+b.Last {
+			return a.First+a.Last > b.First+b.Last
+		}
+		return a.Player < b.Player
+	})
+	r.OwnGoals = countRows(ownGoals, players)
+	r.PenaltySaves = countRows(saves, players)
+
+	type pair struct{ scorer, assister uint }
+	duos := make(map[pair]int)
+	for _, a := range assists {
+		if a.GoalStatID == nil {
+			continue
+		}
+		if goal, ok := goalByID[*a.GoalStatID]; ok && goal.Type != models.StatTypeOwnGoal {
+			duos[pair{goal.PlayerID, a.PlayerID}]++
+		}
+	}
+	for k, n := range duos {
+		r.Duos = append(r.Duos, Duo{ScorerID: k.scorer, Scorer: players[k.scorer].Player, AssisterID: k.assister,
+			Assister: players[k.assister].Player, Team: players[k.scorer].Team, Goals: n})
+	}
+	sort.Slice(r.Duos, func(i, j int) bool {
+		a, b := r.Duos[i], r.Duos[j]
+		if a.Goals != b.Goals {
+			return a.Goals > b.Goals
+		}
+		if a.Scorer != b.Scorer {
+			return a.Scorer < b.Scorer
+		}
+		return a.Assister < b.Assister
+	})
+	return r, nil
+}
+
+// timeline orders a game's goals by minute when every goal has one, and in
+// the order they were recorded otherwise
+func timeline(goals []recordStat) []recordStat {
+	for _, st := range goals {
+		if st.Minute == 0 {
+			return goals
+		}
+	}
+	sort.SliceStable(goals, func(i, j int) bool { return goals[i].Minute < goals[j].Minute })
+	return goals
+}
+
+// countRows turns per-player counts into leaderboard rows
+func countRows(counts map[uint]int, players map[uint]recordStat) []LeaderRow {
+	out := []LeaderRow{}
+	for pid, n := range counts {
+		out = append(out, LeaderRow{PlayerID: pid, Player: players[pid].Player, Team: players[pid].Team, Count: n})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Player < out[j].Player
+	})
+	return out
+}
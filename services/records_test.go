@@ -0,0 +1,147 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+func TestRecords(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		ann, bob := f.homePlayers[0], f.homePlayers[1]
+		dan, eve, fay := f.awayPlayers[0], f.awayPlayers[1], f.awayPlayers[2]
+		goal := func(game models.Game, p models.Player, assist *models.Player, teamID uint, minute int, goalType string) {
+			in := GoalInput{PlayerID: p.ID, TeamID: teamID, Minute: minute, GoalType: goalType}
+			if assist != nil {
+				in.AssistPlayerID = assist.ID
+			}
+			_, err := svc.Stats.AddGoal(game.ID, in)
+			must(t, err)
+		}
+
+		// Home 4:1 Away, entered out of order: Dan 10', Ann 30', Ann 60',
+		// Ann 80' (penalty), Eve 85' (own goal)
+		first := f.game(t)
+		goal(first, ann, &bob, f.home.ID, 30, models.StatTypeGoal)
+		goal(first, dan, nil, f.away.ID, 10, models.StatTypeGoal)
+		goal(first, ann, &bob, f.home.ID, 60, models.StatTypeGoal)
+		goal(first, ann, nil, f.home.ID, 80, models.StatTypePenalty)
+		goal(first, eve, nil, f.home.ID, 85, models.StatTypeOwnGoal)
+		// Home 2:1 Away: Bob 5', Bob 20', Fay 50'
+		second := f.game(t)
+		goal(second, bob, nil, f.home.ID, 5, models.StatTypeGoal)
+		goal(second, bob, nil, f.home.ID, 20, models.StatTypeGoal)
+		goal(second, fay, nil, f.away.ID, 50, models.StatTypeGoal)
+
+		r, err := svc.Standings.Records(f.event.ID)
+		must(t, err)
+		if len(r.HatTricks) != 1 || r.HatTricks[0].Player != "Ann" || r.HatTricks[0].Goals != 3 || r.HatTricks[0].Opponent != "Away" {
+			t.Fatalf("hat-tricks %+v", r.HatTricks)
+		}
+		if len(r.Braces) != 1 || r.Braces[0].Player != "Bob" || r.Braces[0].GameID != second.ID {
+			t.Fatalf("braces %+v", r.Braces)
+		}
+		if r.Goals != 8 || r.Penalties != 1 || r.PenaltyShare != 13 {
+			t.Fatalf("goals %d, penalties %d (%d%%)", r.Goals, r.Penalties, r.PenaltyShare)
+		}
+
+		// the winner is the goal that put the winner ahead for good; an own
+		// goal is nobody's last goal
+		var decisive []string
+		for _, d := range r.Decisive {
+			decisive = append(decisive, fmt.Sprintf("%s %d/%d/%d", d.Player, d.First, d.Last, d.Winning))
+		}
+		if got, want := fmt.Sprint(decisive), "[Bob 1/0/1 Ann 0/0/1 Dan 1/0/0 Fay 0/1/0]"; got != want {
+			t.Fatalf("decisive %s, want %s", got, want)
+		}
+
+		buckets := map[string]int{}
+		for _, b := range r.Buckets {
+			buckets[b.Label] = b.Goals
+		}
+		if len(r.Buckets) != 7 || buckets["1–15'"] != 2 || buckets["16–30'"] != 2 || buckets["46–60'"] != 2 || buckets["76–90'"] != 2 {
+			t.Fatalf("buckets %+v", r.Buckets)
+		}
+		if len(r.OwnGoals) != 1 || r.OwnGoals[0].Player != "Eve" {
+			t.Fatalf("own goals %+v", r.OwnGoals)
+		}
+		if len(r.Duos) != 1 || r.Duos[0].Scorer != "Ann" || r.Duos[0].Assister != "Bob" || r.Duos[0].Goals != 2 {
+			t.Fatalf("duos %+v", r.Duos)
+		}
+	})
+}
+
+func TestRecordsTimelineWithoutMinutes(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		// with a minute missing the goals keep the order they were entered
+		game := f.game(t)
+		for _, in := range []GoalInput{
+			{PlayerID: f.awayPlayers[0].ID, TeamID: f.away.ID, Minute: 70},
+			{PlayerID: f.homePlayers[0].ID, TeamID: f.home.ID},
+			{PlayerID: f.homePlayers[1].ID, TeamID: f.home.ID, Minute: 5},
+		} {
+			_, err := svc.Stats.AddGoal(game.ID, in)
+			must(t, err)
+		}
+		r, err := svc.Standings.Records(f.event.ID)
+		must(t, err)
+		got := map[string]DecisiveRow{}
+		for _, d := range r.Decisive {
+			got[d.Player] = d
+		}
+		if got["Dan"].First != 1 || got["Bob"].Last != 1 || got["Bob"].Winning != 1 {
+			t.Fatalf("decisive %+v", r.Decisive)
+		}
+	})
+}
+
+func TestPenalties(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		ann, bob, dan, eve := f.homePlayers[0], f.homePlayers[1], f.awayPlayers[0], f.awayPlayers[1]
+		game := f.game(t)
+		_, err := svc.Stats.AddGoal(game.ID, GoalInput{PlayerID: ann.ID, TeamID: f.home.ID, Minute: 10, GoalType: models.StatTypePenalty})
+		must(t, err)
+		saved := PenaltyInput{PlayerID: ann.ID, TeamID: f.home.ID, GoalkeeperID: dan.ID, Minute: 40, Outcome: models.StatTypePenaltySaved}
+		must(t, svc.Stats.AddMissedPenalty(game.ID, saved))
+		must(t, svc.Stats.AddMissedPenalty(game.ID, PenaltyInput{PlayerID: eve.ID, TeamID: f.away.ID, Minute: 70, Outcome: models.StatTypePenaltyMissed}))
+
+		// the keeper has to be on the side facing the penalty
+		for _, keeper := range []uint{ann.ID, bob.ID, 9999} {
+			in := saved
+			in.GoalkeeperID = keeper
+			wantKind(t, svc.Stats.AddMissedPenalty(game.ID, in), ErrValidation)
+		}
+		other := models.Event{Name: "League", Date: "2024-07-01", EventURL: "https://example.com"}
+		must(t, svc.Events.Create(&other))
+		team := models.Team{Name: "Away", EventID: other.ID}
+		must(t, svc.Teams.Create(&team))
+		stranger := f.player(t, team.ID, "Dan")
+		in := saved
+		in.GoalkeeperID = stranger.ID
+		wantKind(t, svc.Stats.AddMissedPenalty(game.ID, in), ErrValidation)
+		in.Outcome = "bar"
+		wantKind(t, svc.Stats.AddMissedPenalty(game.ID, in), ErrValidation)
+
+		g, err := svc.Games.Get(game.ID)
+		must(t, err)
+		if g.HomeTeamGoals != 1 || g.AwayTeamGoals != 0 {
+			t.Fatalf("score %d:%d, want 1:0", g.HomeTeamGoals, g.AwayTeamGoals)
+		}
+		r, err := svc.Standings.Records(f.event.ID)
+		must(t, err)
+		if r.PenaltiesTaken != 3 || r.PenaltyConversion != 33 {
+			t.Fatalf("penalties taken %d, conversion %d%%", r.PenaltiesTaken, r.PenaltyConversion)
+		}
+		if len(r.PenaltyTakers) != 2 || r.PenaltyTakers[0].Player != "Ann" || r.PenaltyTakers[0].Scored != 1 || r.PenaltyTakers[0].Saved != 1 || r.PenaltyTakers[1].Missed != 1 {
+			t.Fatalf("takers %+v", r.PenaltyTakers)
+		}
+		if len(r.PenaltySaves) != 1 || r.PenaltySaves[0].Player != "Dan" || r.PenaltySaves[0].Team != "Away" {
+			t.Fatalf("saves %+v", r.PenaltySaves)
+		}
+	})
+}
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+type SeasonService interface {
+	// List returns all seasons, newest first
+	List() ([]models.Season, error)
+	// Get returns the season with its events, first matchday first
+	Get(id uint) (*models.Season, error)
+	Create(season *models.Season) error
+	Update(id uint, changes models.Season) (*models.Season, error)
+	// Delete removes the season; its events stay, unassigned
+	Delete(id uint) error
+	AddEvent(seasonID, eventID uint) error
+	RemoveEvent(seasonID, eventID uint) error
+	// Table aggregates standings and leaderboards over the season's events
+	Table(id uint) (*SeasonTable, error)
+}
+
+// SeasonTable is the league table of a season. The same side is matched
+// across matchdays by club, or by name for teams not created from a club;
+// each standings row carries the side's most recent event team.
+type SeasonTable struct {
+	Season    models.Season
+	Standings []*StandRow
+	// Leaderboards count per person, so PlayerID is a person ID here
+	TopScorers  []LeaderRow
+	TopAssists  []LeaderRow
+	Progression []SeasonProgress // in final standings order
+}
+
+// SeasonProgress is where a side stood after each matchday
+type SeasonProgress struct {
+	Team      models.Team
+	Matchdays []MatchdayPlace
+}
+
+type MatchdayPlace struct {
+	Position int // 0 until the side has played
+	Points   int
+}
+
+const seasonLeaderLimit = 10
+
+type seasonService struct {
+	db *gorm.DB
+}
+
+func (s *seasonService) List() ([]models.Season, error) {
+	var seasons []models.Season
+	err := s.db.Order("created_at DESC").Find(&seasons).Error
+	return seasons, err
+}
+
+func (s *seasonService) Get(id uint) (*models.Season, error) {
+	var season models.Season
+	if err := s.db.Preload("Events", func(db *gorm.DB) *gorm.DB {
+		return db.Order("events.date ASC, events.id ASC")
+	}).First(&season, id).Error; err != nil {
+		return nil, lookup(err, "Season")
+	}
+	return &season, nil
+}
+
+func (s *seasonService) Create(season *models.Season) error {
+	season.Name = strings.TrimSpace(season.Name)
+	if season.Name == "" {
+		return invalid("Name required")
+	}
+	season.Events = nil
+	return write(s.db.Create(season).Error, "Season")
+}
+
+func (s *seasonService) Update(id uint, changes models.Season) (*models.Season, error) {
+	existing, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	changes.Name = strings.TrimSpace(changes.Name)
+	changes.Events = nil
+	if err := s.db.Model(existing).Updates(changes).Error; err != nil {
+		return nil, write(err, "Season")
+	}
+	return existing, nil
+}
+
+func (s *seasonService) Delete(id uint) error {
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&models.Event{}).Where("season_id = ?", id).
+			UpdateColumn("season_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Season{}, id).Error
+	})
+}
+
+func (s *seasonService) AddEvent(seasonID, eventID uint) error {
+	season, err := s.Get(seasonID)
+	if err != nil {
+		return err
+	}
+	var event models.Event
+	if err := s.db.First(&event, eventID).Error; err != nil {
+		return invalidLookup(err, "Event not found")
+	}
+	if event.SeasonID != nil {
+		if *event.SeasonID == season.ID {
+			return conflict("%s is already in this season", event.Name)
+		}
+		return conflict("%s belongs to another season", event.Name)
+	}
+	return s.db.Model(&event).UpdateColumn("season_id", season.ID).Error
+}
+
+func (s *seasonService) RemoveEvent(seasonID, eventID uint) error {
+	if _, err := s.Get(seasonID); err != nil {
+		return err
+	}
+	res := s.db.Model(&models.Event{}).Where("id = ? AND season_id = ?", eventID, seasonID).
+		UpdateColumn("season_id", nil)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return notFound("Event is not in this season")
+	}
+	return nil
+}
+
+func (s *seasonService) Table(id uint) (*SeasonTable, error) {
+	season, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	t := &SeasonTable{Season: *season, Standings: []*StandRow{}, TopScorers: []LeaderRow{},
+		TopAssists: []LeaderRow{}, Progression: []SeasonProgress{}}
+	if len(season.Events) == 0 {
+		return t, nil
+	}
+	eventIDs := make([]uint, len(season.Events))
+	for i, e := range season.Events {
+		eventIDs[i] = e.ID
+	}
+	var teams []models.Team
+	var games []models.Game
+	if err := s.db.Where("event_id IN ?", eventIDs).Find(&teams).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Where("event_id IN ?", eventIDs).Find(&games).Error; err != nil {
+		return nil, err
+	}
+
+	// Each side is represented by its latest event team; games are rewritten
+	// to point at the representatives so computeStandings can sum them
+	matchday := make(map[uint]int, len(season.Events))
+	for i, e := range season.Events {
+		matchday[e.ID] = i
+	}
+	reps := make(map[string]models.Team)
+	for _, team := range teams {
+		k := sideKey(team)
+		if r, ok := reps[k]; !ok || matchday[team.EventID] >= matchday[r.EventID] {
+			reps[k] = team
+		}
+	}
+	sides := make([]models.Team, 0, len(reps))
+	for _, r := range reps {
+		sides = append(sides, r)
+	}
+	repOf := make(map[uint]uint, len(teams))
+	for _, team := range teams {
+		repOf[team.ID] = reps[sideKey(team)].ID
+	}
+	byMatchday := make([][]models.Game, len(season.Events))
+	for _, g := range games {
+		g.HomeTeamID, g.AwayTeamID = repOf[g.HomeTeamID], repOf[g.AwayTeamID]
+		if g.HomeTeamID == g.AwayTeamID {
+			continue // two same-named teams of one event count as one side
+		}
+		md := matchday[g.EventID]
+		byMatchday[md] = append(byMatchday[md], g)
+	}
+
+	progress := make(map[uint]*SeasonProgress, len(sides))
+	for _, side := range sides {
+		progress[side.ID] = &SeasonProgress{Team: side, Matchdays: make([]MatchdayPlace, len(season.Events))}
+	}
+	var played []models.Game
+	for md, mdGames := range byMatchday {
+		played = append(played, mdGames...)
+		t.Standings = computeStandings(sides, played)
+		for pos, row := range t.Standings {
+			place := &progress[row.Team.ID].Matchdays[md]
+			place.Points = row.Points
+			if row.Played > 0 {
+				place.Position = pos + 1
+			}
+		}
+	}
+	for _, row := range t.Standings {
+		t.Progression = append(t.Progression, *progress[row.Team.ID])
+	}
+
+	if t.TopScorers, err = seasonLeaders(s.db, eventIDs, scorerTypes); err != nil {
+		return nil, err
+	}
+	if t.TopAssists, err = seasonLeaders(s.db, eventIDs, assistTypes); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// sideKey identifies the same side across events: by club when the team was
+// created from one, otherwise by its name ignoring case and spacing
+func sideKey(team models.Team) string {
+	if team.ClubID != nil {
+		return fmt.Sprintf("club:%d", *team.ClubID)
+	}
+	return "name:" + normalizeName(team.Name)
+}
+
+// seasonLeaders is leaders over several events, counted per person so a
+// player's entries in different matchdays add up
+func seasonLeaders(db *gorm.DB, eventIDs []uint, types []string) ([]LeaderRow, error) {
+	out := []LeaderRow{}
+	err := db.Model(&models.GamePlayerStat{}).
+		Select(`people.id AS player_id, people.name AS player,
+			COALESCE(MAX(teams.name), '') AS team, COUNT(*) AS count`).
+		Joins("JOIN games ON games.id = game_player_stats.game_id AND games.deleted_at IS NULL").
+		Joins("JOIN players ON players.id = game_player_stats.player_id").
+		Joins("JOIN people ON people.id = players.person_id").
+		Joins("LEFT JOIN teams ON teams.id = "+playedForSQL).
+		Where("games.event_id IN ? AND game_player_stats.type IN ?", eventIDs, types).
+		Group("people.id, people.name").
+		Order("count DESC, player ASC").
+		Limit(seasonLeaderLimit).
+		Scan(&out).Error
+	return out, err
+}
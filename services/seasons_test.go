@@ -0,0 +1,67 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+func TestSeasonTable(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		ann := f.homePlayers[0]
+		f.goal(t, f.game(t).ID, ann, nil) // matchday 1: Home 1:0 Away
+
+		// matchday 2 has the same sides, spelled differently: Away wins 2:1
+		event := models.Event{Name: "Matchday 2", Date: "2024-06-08", EventURL: "https://example.com"}
+		must(t, svc.Events.Create(&event))
+		home, away := models.Team{Name: "home ", EventID: event.ID}, models.Team{Name: "AWAY", EventID: event.ID}
+		must(t, svc.Teams.Create(&home))
+		must(t, svc.Teams.Create(&away))
+		ann2 := models.Player{Name: "Ann", TeamID: home.ID, PersonID: ann.PersonID}
+		must(t, svc.Players.Create(&ann2))
+		dan2 := f.player(t, away.ID, "Dan")
+		game := models.Game{EventID: event.ID, HomeTeamID: home.ID, AwayTeamID: away.ID}
+		must(t, svc.Games.Create(&game))
+		f.goal(t, game.ID, ann2, nil)
+		f.goal(t, game.ID, dan2, nil)
+		f.goal(t, game.ID, dan2, nil)
+
+		season := models.Season{Name: "2024"}
+		must(t, svc.Seasons.Create(&season))
+		// added out of order; matchdays follow the event dates
+		must(t, svc.Seasons.AddEvent(season.ID, event.ID))
+		must(t, svc.Seasons.AddEvent(season.ID, f.event.ID))
+		wantKind(t, svc.Seasons.AddEvent(season.ID, f.event.ID), ErrConflict)
+
+		table, err := svc.Seasons.Table(season.ID)
+		must(t, err)
+		if len(table.Standings) != 2 {
+			t.Fatalf("standings %+v, want the sides matched by name", table.Standings)
+		}
+		// level on points and goals, so the name decides; each row shows the
+		// side's latest event team
+		first, second := table.Standings[0], table.Standings[1]
+		if first.Team.ID != away.ID || first.Points != 3 || first.GF != 2 || second.Team.ID != home.ID || second.Points != 3 {
+			t.Fatalf("standings %+v, %+v", first, second)
+		}
+		if p := table.Progression[1].Matchdays; p[0].Position != 1 || p[1].Position != 2 || p[1].Points != 3 {
+			t.Fatalf("Home's progression %+v", p)
+		}
+		// Ann's goals add up across her roster entries
+		if len(table.TopScorers) != 2 || table.TopScorers[0].Count != 2 || table.TopScorers[1].Count != 2 ||
+			table.TopScorers[0].Player != "Ann" || table.TopScorers[0].PlayerID != *ann.PersonID {
+			t.Fatalf("top scorers %+v", table.TopScorers)
+		}
+
+		must(t, svc.Seasons.RemoveEvent(season.ID, event.ID))
+		wantKind(t, svc.Seasons.RemoveEvent(season.ID, event.ID), ErrNotFound)
+		must(t, svc.Seasons.Delete(season.ID))
+		e, err := svc.Events.Get(f.event.ID)
+		must(t, err)
+		if e.SeasonID != nil {
+			t.Fatalf("event still in deleted season %d", *e.SeasonID)
+		}
+	})
+}
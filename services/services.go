@@ -0,0 +1,59 @@
+// Package services holds the business rules of the tracker. Handlers call
+// these interfaces instead of talking to *gorm.DB, so the rules can be used
+// (and tested) without Gin and are shared by the HTML and JSON routes.
+package services
+
+import (
+	"github.com/yesakov/lukyasha-tracker/storage"
+	"gorm.io/gorm"
+)
+
+// Services bundles every service over one database connection and the
+// upload store
+type Services struct {
+	Events      EventService
+	Teams       TeamService
+	Players     PlayerService
+	Games       GameService
+	Stats       StatService
+	Standings   StandingsService
+	People      PersonService
+	Clubs       ClubService
+	Seasons     SeasonService
+	Compare     CompareService
+	Keepers     GoalkeeperService
+	Transfers   TransferService
+	Draws       DrawService
+	Ratings     RatingService
+	Users       UserService
+	Predictions PredictionService
+	MVP         MVPService
+	Awards      AwardService
+}
+
+func New(db *gorm.DB, files *storage.Store) *Services {
+	cache := newEventCache()
+	ratings := &ratingService{db: db, cache: cache}
+	mvp := &mvpService{db: db}
+	standings := &standingsService{db: db, cache: cache}
+	return &Services{
+		Events:      &eventService{db: db, cache: cache},
+		Teams:       &teamService{db: db, cache: cache},
+		Players:     &playerService{db: db, cache: cache, files: files},
+		Games:       &gameService{db: db, cache: cache},
+		Stats:       &statService{db: db, cache: cache},
+		Standings:   standings,
+		People:      &personService{db: db, cache: cache},
+		Clubs:       &clubService{db: db, files: files},
+		Seasons:     &seasonService{db: db},
+		Compare:     &compareService{db: db},
+		Keepers:     &goalkeeperService{db: db, cache: cache},
+		Transfers:   &transferService{db: db, cache: cache},
+		Draws:       &drawService{db: db, cache: cache, ratings: ratings},
+		Ratings:     ratings,
+		Users:       &userService{db: db},
+		Predictions: &predictionService{db: db},
+		MVP:         mvp,
+		Awards:      &awardService{db: db, mvp: mvp, standings: standings},
+	}
+}
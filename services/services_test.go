@@ -0,0 +1,112 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/yesakov/lukyasha-tracker/database/dbtest"
+	"github.com/yesakov/lukyasha-tracker/models"
+	"github.com/yesakov/lukyasha-tracker/storage"
+	"gorm.io/gorm"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(dbtest.Main(m))
+}
+
+// eachBackend runs the same scenario against every backend, each on a fresh
+// database migrated to the latest version
+func eachBackend(t *testing.T, scenario func(t *testing.T, svc *Services, db *gorm.DB)) {
+	dbtest.EachBackend(t, func(t *testing.T, db *gorm.DB) {
+		scenario(t, newServices(t, db), db)
+	})
+}
+
+// newServices stores uploads in a directory of the test
+func newServices(t testing.TB, db *gorm.DB) *Services {
+	return New(db, storage.New(t.TempDir()))
+}
+
+// fixture is an event with two teams of three players each
+type fixture struct {
+	svc   *Services
+	db    *gorm.DB
+	event models.Event
+	home  models.Team
+	away  models.Team
+	// players by team, in creation order
+	homePlayers []models.Player
+	awayPlayers []models.Player
+}
+
+func newFixture(t testing.TB, svc *Services, db *gorm.DB) *fixture {
+	t.Helper()
+	f := &fixture{svc: svc, db: db, event: models.Event{Name: "Cup", Date: "2024-06-01", EventURL: "https://example.com"}}
+	must(t, svc.Events.Create(&f.event))
+	f.home = f.team(t, "Home")
+	f.away = f.team(t, "Away")
+	for _, name := range []string{"Ann", "Bob", "Cid"} {
+		f.homePlayers = append(f.homePlayers, f.player(t, f.home.ID, name))
+	}
+	for _, name := range []string{"Dan", "Eve", "Fay"} {
+		f.awayPlayers = append(f.awayPlayers, f.player(t, f.away.ID, name))
+	}
+	return f
+}
+
+func (f *fixture) team(t testing.TB, name string) models.Team {
+	t.Helper()
+	team := models.Team{Name: name, EventID: f.event.ID}
+	must(t, f.svc.Teams.Create(&team))
+	return team
+}
+
+func (f *fixture) player(t testing.TB, teamID uint, name string) models.Player {
+	t.Helper()
+	p := models.Player{Name: name, TeamID: teamID}
+	must(t, f.svc.Players.Create(&p))
+	return p
+}
+
+// game adds a home-against-away game at 0:0
+func (f *fixture) game(t testing.TB) models.Game {
+	t.Helper()
+	g := models.Game{EventID: f.event.ID, HomeTeamID: f.home.ID, AwayTeamID: f.away.ID}
+	must(t, f.svc.Games.Create(&g))
+	return g
+}
+
+// goal scores for a player of either team and returns the updated game
+func (f *fixture) goal(t testing.TB, gameID uint, p models.Player, assist *models.Player) *models.Game {
+	t.Helper()
+	in := GoalInput{PlayerID: p.ID, TeamID: p.TeamID, Minute: 10, GoalType: models.StatTypeGoal}
+	if assist != nil {
+		in.AssistPlayerID = assist.ID
+	}
+	g, err := f.svc.Stats.AddGoal(gameID, in)
+	must(t, err)
+	return g
+}
+
+// finish marks a game finished, which rates it
+func (f *fixture) finish(t testing.TB, gameID uint) {
+	t.Helper()
+	_, err := f.svc.Games.SetStatus(gameID, models.GameFinished)
+	must(t, err)
+}
+
+func must(t testing.TB, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// wantKind fails unless err is a service error of the kind
+func wantKind(t testing.TB, err, kind error) {
+	t.Helper()
+	if !errors.Is(err, kind) {
+		t.Fatalf("got error %v, want %v", err, kind)
+	}
+}
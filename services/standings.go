@@ -0,0 +1,277 @@
+package services
+
+import (
+	"sort"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+type StandingsService interface {
+	// Standings sorts teams by points, goal difference, goals for, name
+	Standings(eventID uint) ([]*StandRow, error)
+	// TopScorers counts normal and penalty goals; own goals are excluded
+	TopScorers(eventID uint, limit int) ([]LeaderRow, error)
+	TopAssists(eventID uint, limit int) ([]LeaderRow, error)
+	// Involvements ranks players by goals plus assists, then goals; a
+	// limit of 0 returns everyone
+	Involvements(eventID uint, limit int) ([]InvolvementRow, error)
+	// EventStats returns standings, the scorer, assist and goalkeeper
+	// leaderboards (restricted to the players of teamID unless it is 0) and
+	// the records, cached until the event's games, stats, goalkeepers, teams
+	// or players change
+	EventStats(eventID, teamID uint, limit int) (*EventStats, error)
+	// Records derives braces, hat-tricks, decisive goals, timing and duos
+	Records(eventID uint) (*Records, error)
+	// ETag identifies the current version of the event's data
+	ETag(eventID uint) string
+}
+
+type StandRow struct {
+	Team   models.Team
+	Played int
+	Wins   int
+	Draws  int
+	Losses int
+	GF     int
+	GA     int
+	GD     int
+	Points int
+}
+
+type LeaderRow struct {
+	PlayerID uint
+	Player   string
+	Team     string
+	Count    int
+}
+
+type InvolvementRow struct {
+	Rank     int
+	PlayerID uint
+	Player   string
+	Team     string
+	Goals    int
+	Assists  int
+	Total    int
+}
+
+type standingsService struct {
+	db    *gorm.DB
+	cache *eventCache
+}
+
+func (s *standingsService) Standings(eventID uint) ([]*StandRow, error) {
+	var teams []models.Team
+	if err := s.db.Where("event_id = ?", eventID).Find(&teams).Error; err != nil {
+		return nil, err
+	}
+	var games []models.Game
+	if err := s.db.Where("event_id = ?", eventID).Find(&games).Error; err != nil {
+		return nil, err
+	}
+	return computeStandings(teams, games), nil
+}
+
+func (s *standingsService) EventStats(eventID, teamID uint, limit int) (*EventStats, error) {
+	key := cacheKey{eventID: eventID, teamID: teamID, limit: limit}
+	stats, version, ok := s.cache.get(key)
+	if ok {
+		return stats, nil
+	}
+	stats = &EventStats{}
+	var err error
+	if stats.Standings, err = s.Standings(eventID); err != nil {
+		return nil, err
+	}
+	if stats.TopScorers, err = leaders(s.db, eventID, teamID, scorerTypes, limit); err != nil {
+		return nil, err
+	}
+	if stats.TopAssists, err = leaders(s.db, eventID, teamID, assistTypes, limit); err != nil {
+		return nil, err
+	}
+	if stats.Goalkeepers, err = keeperStats(s.db, eventID, teamID); err != nil {
+		return nil, err
+	}
+	if stats.Records, err = records(s.db, eventID); err != nil {
+		return nil, err
+	}
+	s.cache.put(key, version, stats)
+	return stats, nil
+}
+
+func (s *standingsService) ETag(eventID uint) string {
+	return s.cache.etag(eventID)
+}
+
+func computeStandings(teams []models.Team, games []models.Game) []*StandRow {
+	standMap := make(map[uint]*StandRow)
+	for _, t := range teams {
+		standMap[t.ID] = &StandRow{Team: t}
+	}
+	for _, g := range games {
+		home := standMap[g.HomeTeamID]
+		away := standMap[g.AwayTeamID]
+		if home == nil || away == nil {
+			continue
+		}
+		home.Played++
+		away.Played++
+		home.GF += g.HomeTeamGoals
+		home.GA += g.AwayTeamGoals
+		away.GF += g.AwayTeamGoals
+		away.GA += g.HomeTeamGoals
+		if g.HomeTeamGoals > g.AwayTeamGoals {
+			home.Wins++
+			home.Points += 3
+			away.Losses++
+		} else if g.HomeTeamGoals < g.AwayTeamGoals {
+			away.Wins++
+			away.Points += 3
+			home.Losses++
+		} else {
+			home.Draws++
+			away.Draws++
+			home.Points++
+			away.Points++
+		}
+	}
+	standings := make([]*StandRow, 0, len(standMap))
+	for _, s := range standMap {
+		s.GD = s.GF - s.GA
+		standings = append(standings, s)
+	}
+	sort.Slice(standings, func(i, j int) bool {
+		if standings[i].Points != standings[j].Points {
+			return standings[i].Points > standings[j].Points
+		}
+		if standings[i].GD != standings[j].GD {
+			return standings[i].GD > standings[j].GD
+		}
+		if standings[i].GF != standings[j].GF {
+			return standings[i].GF > standings[j].GF
+		}
+		return standings[i].Team.Name < standings[j].Team.Name
+	})
+	return standings
+}
+
+var (
+	scorerTypes = []string{models.StatTypeGoal, models.StatTypePenalty}
+	assistTypes = []string{models.StatTypeAssist}
+)
+
+func (s *standingsService) TopScorers(eventID uint, limit int) ([]LeaderRow, error) {
+	return leaders(s.db, eventID, 0, scorerTypes, limit)
+}
+
+func (s *standingsService) TopAssists(eventID uint, limit int) ([]LeaderRow, error) {
+	return leaders(s.db, eventID, 0, assistTypes, limit)
+}
+
+// playedForSQL is the team a stat's player represented in the game: the
+// credited team, except for own goals, which are credited to the opponent
+const playedForSQL = `CASE WHEN game_player_stats.type = 'own_goal' THEN
+	CASE WHEN games.home_team_id = game_player_stats.team_id THEN games.away_team_id ELSE games.home_team_id END
+	ELSE game_player_stats.team_id END`
+
+// leaders aggregates stats of the given types across the event's games and
+// resolves player and team names in the same query. Goals count for the team
+// the player represented in that game, so a transferred player lists every
+// team. A non-zero teamID keeps only what was done for that team; a limit of
+// 0 returns everyone.
+func leaders(db *gorm.DB, eventID, teamID uint, types []string, limit int) ([]LeaderRow, error) {
+	var rows []LeaderRow
+	q := db.Model(&models.GamePlayerStat{}).
+		Select(`game_player_stats.player_id, COALESCE(players.name, '') AS player,
+			COALESCE(teams.name, '') AS team, COUNT(*) AS count`).
+		Joins("JOIN games ON games.id = game_player_stats.game_id AND games.deleted_at IS NULL").
+		Joins("LEFT JOIN players ON players.id = game_player_stats.player_id").
+		Joins("LEFT JOIN teams ON teams.id = "+playedForSQL).
+		Where("games.event_id = ? AND game_player_stats.type IN ?", eventID, types)
+	if teamID != 0 {
+		q = q.Where(playedForSQL+" = ?", teamID)
+	}
+	err := q.Group("game_player_stats.player_id, players.name, teams.id, teams.name").
+		Order("MIN(game_player_stats.game_id) ASC").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	out := []LeaderRow{}
+	index := make(map[uint]int)
+	for _, r := range rows {
+		if i, ok := index[r.PlayerID]; ok {
+			out[i].Team += " / " + r.Team
+			out[i].Count += r.Count
+			continue
+		}
+		index[r.PlayerID] = len(out)
+		out = append(out, r)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Player < out[j].Player
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (s *standingsService) Involvements(eventID uint, limit int) ([]InvolvementRow, error) {
+	return involvements(s.db, eventID, limit)
+}
+
+func involvements(db *gorm.DB, eventID uint, limit int) ([]InvolvementRow, error) {
+	var rows []InvolvementRow
+	err := db.Model(&models.GamePlayerStat{}).
+		Select(`game_player_stats.player_id, COALESCE(players.name, '') AS player,
+			COALESCE(teams.name, '') AS team,
+			SUM(CASE WHEN game_player_stats.type = ? THEN 0 ELSE 1 END) AS goals,
+			SUM(CASE WHEN game_player_stats.type = ? THEN 1 ELSE 0 END) AS assists,
+			COUNT(*) AS total`, models.StatTypeAssist, models.StatTypeAssist).
+		Joins("JOIN games ON games.id = game_player_stats.game_id AND games.deleted_at IS NULL").
+		Joins("LEFT JOIN players ON players.id = game_player_stats.player_id").
+		Joins("LEFT JOIN teams ON teams.id = "+playedForSQL).
+		Where("games.event_id = ? AND game_player_stats.type IN ?", eventID,
+			[]string{models.StatTypeGoal, models.StatTypePenalty, models.StatTypeAssist}).
+		Group("game_player_stats.player_id, players.name, teams.id, teams.name").
+		Order("MIN(game_player_stats.game_id) ASC").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	out := []InvolvementRow{}
+	index := make(map[uint]int)
+	for _, r := range rows {
+		if i, ok := index[r.PlayerID]; ok {
+			out[i].Team += " / " + r.Team
+			out[i].Goals += r.Goals
+			out[i].Assists += r.Assists
+			out[i].Total += r.Total
+			continue
+		}
+		index[r.PlayerID] = len(out)
+		out = append(out, r)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Total != b.Total {
+			return a.Total > b.Total
+		}
+		if a.Goals != b.Goals {
+			return a.Goals > b.Goals
+		}
+		return a.Player < b.Player
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	for i := range out {
+		out[i].Rank = i + 1
+	}
+	return out, nil
+}
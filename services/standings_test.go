@@ -0,0 +1,49 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+func TestStandings(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		third := f.team(t, "Third")
+		gil := f.player(t, third.ID, "Gil")
+
+		// Home beats Away 2:0, Away and Third draw 1:1
+		win := f.game(t)
+		f.goal(t, win.ID, f.homePlayers[0], &f.homePlayers[1])
+		f.goal(t, win.ID, f.homePlayers[0], nil)
+		draw := models.Game{EventID: f.event.ID, HomeTeamID: f.away.ID, AwayTeamID: third.ID}
+		must(t, svc.Games.Create(&draw))
+		f.goal(t, draw.ID, f.awayPlayers[0], nil)
+		f.goal(t, draw.ID, gil, nil)
+
+		rows, err := svc.Standings.Standings(f.event.ID)
+		must(t, err)
+		var got []string
+		for _, r := range rows {
+			got = append(got, fmt.Sprintf("%s %d %d:%d", r.Team.Name, r.Points, r.GF, r.GA))
+		}
+		want := []string{"Home 3 2:0", "Third 1 1:1", "Away 1 1:3"}
+		if strings.Join(got, ", ") != strings.Join(want, ", ") {
+			t.Fatalf("standings %v, want %v", got, want)
+		}
+
+		scorers, err := svc.Standings.TopScorers(f.event.ID, 1)
+		must(t, err)
+		if len(scorers) != 1 || scorers[0].Player != "Ann" || scorers[0].Team != "Home" || scorers[0].Count != 2 {
+			t.Fatalf("top scorers %+v", scorers)
+		}
+		assists, err := svc.Standings.TopAssists(f.event.ID, 10)
+		must(t, err)
+		if len(assists) != 1 || assists[0].Player != "Bob" {
+			t.Fatalf("top assists %+v", assists)
+		}
+	})
+}
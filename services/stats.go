@@ -0,0 +1,383 @@
+package services
+
+import (
+	"github.com/yesakov/lukyasha-tracker/database"
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+type StatService interface {
+	List() ([]models.GamePlayerStat, error)
+	Get(id uint) (*models.GamePlayerStat, error)
+	Create(stat *models.GamePlayerStat) error
+	Update(id uint, changes models.GamePlayerStat) (*models.GamePlayerStat, error)
+	// AddGoal records a goal (and optional assist) and bumps the score
+	AddGoal(gameID uint, in GoalInput) (*models.Game, error)
+	// Delete removes a stat; goals also drop their assist and the score
+	Delete(id uint) error
+	// GoalRows returns the game's goals, each with its optional assist
+	GoalRows(gameID uint) ([]GoalRow, error)
+	// AddCard records a yellow or red card for a player of either team
+	AddCard(gameID uint, in CardInput) error
+	// AddMissedPenalty records a missed or saved penalty; the score stays
+	AddMissedPenalty(gameID uint, in PenaltyInput) error
+	CardRows(gameID uint) ([]CardRow, error)
+}
+
+type GoalInput struct {
+	PlayerID       uint   `form:"player_id" json:"player_id"`
+	AssistPlayerID uint   `form:"assist_player_id" json:"assist_player_id"`
+	TeamID         uint   `form:"team_id" json:"team_id"`
+	Minute         int    `form:"minute" json:"minute"`
+	GoalType       string `form:"goal_type" json:"goal_type"`
+}
+
+type CardInput struct {
+	PlayerID uint   `form:"player_id" json:"player_id"`
+	TeamID   uint   `form:"team_id" json:"team_id"`
+	Minute   int    `form:"minute" json:"minute"`
+	CardType string `form:"card_type" json:"card_type"`
+}
+
+// PenaltyInput is a penalty that did not go in. TeamID is the taker's side;
+// the goalkeeper is optional and must be on the other side.
+type PenaltyInput struct {
+	PlayerID     uint   `form:"player_id" json:"player_id"`
+	TeamID       uint   `form:"team_id" json:"team_id"`
+	GoalkeeperID uint   `form:"goalkeeper_id" json:"goalkeeper_id"`
+	Minute       int    `form:"minute" json:"minute"`
+	Outcome      string `form:"outcome" json:"outcome"`
+}
+
+// CardRow is a booking shown under the game timeline
+type CardRow struct {
+	ID       uint
+	Minute   int
+	CardType string
+	Player   string
+	Team     string
+}
+
+// GoalRow is one timeline entry: a goal with its (optional) assist, or a
+// missed or saved penalty with the goalkeeper it was taken against
+type GoalRow struct {
+	ID           uint
+	Minute       int
+	GoalType     string
+	Scorer       string
+	ScorerNumber *int
+	ScorerThumb  string
+	ScoringTeam  string
+	AssistID     *uint
+	AssistPlayer string
+	AssistNumber *int
+	AssistTeam   string
+	Goalkeeper   string
+}
+
+// IsGoalType reports whether a stat type counts towards the score
+func IsGoalType(t string) bool {
+	return t == models.StatTypeGoal || t == models.StatTypePenalty || t == models.StatTypeOwnGoal
+}
+
+type statService struct {
+	db    *gorm.DB
+	cache *eventCache
+}
+
+func (s *statService) List() ([]models.GamePlayerStat, error) {
+	var stats []models.GamePlayerStat
+	err := s.db.Find(&stats).Error
+	return stats, err
+}
+
+func (s *statService) Get(id uint) (*models.GamePlayerStat, error) {
+	var stat models.GamePlayerStat
+	if err := s.db.First(&stat, id).Error; err != nil {
+		return nil, lookup(err, "Stat")
+	}
+	return &stat, nil
+}
+
+func (s *statService) Create(stat *models.GamePlayerStat) error {
+	if stat.GameID == 0 || stat.PlayerID == 0 || stat.TeamID == 0 || stat.Type == "" {
+		return invalid("GameID, PlayerID, TeamID and Type are required")
+	}
+	if err := s.db.Create(stat).Error; err != nil {
+		return write(err, "Stat")
+	}
+	s.cache.invalidateGame(s.db, stat.GameID)
+	return nil
+}
+
+func (s *statService) Update(id uint, changes models.GamePlayerStat) (*models.GamePlayerStat, error) {
+	existing, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	oldGameID := existing.GameID
+	if err := s.db.Model(existing).Updates(changes).Error; err != nil {
+		return nil, write(err, "Stat")
+	}
+	s.cache.invalidateGame(s.db, oldGameID)
+	if existing.GameID != oldGameID {
+		s.cache.invalidateGame(s.db, existing.GameID)
+	}
+	return existing, nil
+}
+
+func (s *statService) AddGoal(gameID uint, in GoalInput) (*models.Game, error) {
+	var game models.Game
+	if err := s.db.First(&game, gameID).Error; err != nil {
+		return nil, lookup(err, "Game")
+	}
+	if in.PlayerID == 0 {
+		return nil, invalid("Invalid data")
+	}
+	if err := checkSettled(s.db, &game); err != nil {
+		return nil, err
+	}
+
+	// Normalize/validate input
+	if in.TeamID != game.HomeTeamID && in.TeamID != game.AwayTeamID {
+		// default to home if invalid
+		in.TeamID = game.HomeTeamID
+	}
+	if in.Minute < 0 {
+		in.Minute = 0
+	}
+	if in.Minute > 200 {
+		in.Minute = 200
+	}
+	if !IsGoalType(in.GoalType) {
+		in.GoalType = models.StatTypeGoal
+	}
+
+	// Ensure scorer exists
+	var scorer models.Player
+	if err := s.db.First(&scorer, in.PlayerID).Error; err != nil {
+		return nil, invalidLookup(err, "Scorer not found")
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Create goal stat (TeamID is credited team, not necessarily player's registered team)
+		goal := models.GamePlayerStat{PlayerID: scorer.ID, GameID: game.ID, TeamID: in.TeamID, Type: in.GoalType, Minute: in.Minute}
+		if err := tx.Create(&goal).Error; err != nil {
+			return err
+		}
+
+		// Optional assist (skip for own goals)
+		if in.AssistPlayerID != 0 && in.AssistPlayerID != in.PlayerID && in.GoalType != models.StatTypeOwnGoal {
+			var assist models.Player
+			if err := tx.First(&assist, in.AssistPlayerID).Error; err == nil {
+				if err := tx.Create(&models.GamePlayerStat{PlayerID: assist.ID, GameID: game.ID, TeamID: in.TeamID, Type: models.StatTypeAssist, Minute: in.Minute, GoalStatID: &goal.ID}).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		// Update game score for credited team
+		col := scoreColumn(&game, in.TeamID)
+		return tx.Model(&game).UpdateColumn(col, database.Increment(col, 1)).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.cache.invalidate(game.EventID)
+	if err := s.db.First(&game, game.ID).Error; err != nil {
+		return nil, err
+	}
+	return &game, nil
+}
+
+func (s *statService) Delete(id uint) error {
+	// Load stat to adjust game score if needed
+	stat, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		return removeStat(tx, stat)
+	})
+	if err != nil {
+		return err
+	}
+	s.cache.invalidateGame(s.db, stat.GameID)
+	return nil
+}
+
+// removeStat deletes a stat; a goal also takes its assists and its point
+// off the score, which a settled game refuses
+func removeStat(tx *gorm.DB, stat *models.GamePlayerStat) error {
+	if IsGoalType(stat.Type) {
+		var game models.Game
+		if err := tx.First(&game, stat.GameID).Error; err == nil {
+			if err := checkSettled(tx, &game); err != nil {
+				return err
+			}
+			if col := scoreColumn(&game, stat.TeamID); col != "" {
+				if err := tx.Model(&game).UpdateColumn(col, database.Increment(col, -1)).Error; err != nil {
+					return err
+				}
+			}
+		}
+		// Delete any assists linked to this goal
+		if err := tx.Where("goal_stat_id = ?", stat.ID).Delete(&models.GamePlayerStat{}).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Delete(&models.GamePlayerStat{}, stat.ID).Error
+}
+
+func (s *statService) GoalRows(gameID uint) ([]GoalRow, error) {
+	return goalRows(s.db, gameID)
+}
+
+func (s *statService) AddCard(gameID uint, in CardInput) error {
+	var game models.Game
+	if err := s.db.First(&game, gameID).Error; err != nil {
+		return lookup(err, "Game")
+	}
+	if in.PlayerID == 0 {
+		return invalid("Invalid data")
+	}
+	if in.CardType != models.StatTypeYellowCard && in.CardType != models.StatTypeRedCard {
+		return invalid("Unknown card type")
+	}
+	if in.TeamID != game.HomeTeamID && in.TeamID != game.AwayTeamID {
+		return invalid("Team did not play in this game")
+	}
+	if in.Minute < 0 {
+		in.Minute = 0
+	}
+	if in.Minute > 200 {
+		in.Minute = 200
+	}
+	var player models.Player
+	if err := s.db.First(&player, in.PlayerID).Error; err != nil {
+		return invalidLookup(err, "Player not found")
+	}
+	card := models.GamePlayerStat{PlayerID: player.ID, GameID: game.ID, TeamID: in.TeamID, Type: in.CardType, Minute: in.Minute}
+	if err := s.db.Create(&card).Error; err != nil {
+		return err
+	}
+	s.cache.invalidate(game.EventID)
+	return nil
+}
+
+func (s *statService) AddMissedPenalty(gameID uint, in PenaltyInput) error {
+	var game models.Game
+	if err := s.db.First(&game, gameID).Error; err != nil {
+		return lookup(err, "Game")
+	}
+	if in.PlayerID == 0 {
+		return invalid("Invalid data")
+	}
+	if in.Outcome != models.StatTypePenaltyMissed && in.Outcome != models.StatTypePenaltySaved {
+		return invalid("Unknown penalty outcome")
+	}
+	if in.TeamID != game.HomeTeamID && in.TeamID != game.AwayTeamID {
+		return invalid("Team did not play in this game")
+	}
+	if in.Minute < 0 {
+		in.Minute = 0
+	}
+	if in.Minute > 200 {
+		in.Minute = 200
+	}
+	var taker models.Player
+	if err := s.db.First(&taker, in.PlayerID).Error; err != nil {
+		return invalidLookup(err, "Taker not found")
+	}
+	stat := models.GamePlayerStat{PlayerID: taker.ID, GameID: game.ID, TeamID: in.TeamID, Type: in.Outcome, Minute: in.Minute}
+	if in.GoalkeeperID != 0 {
+		var keeper models.Player
+		if err := s.db.First(&keeper, in.GoalkeeperID).Error; err != nil {
+			return invalidLookup(err, "Goalkeeper not found")
+		}
+		if keeper.ID == taker.ID {
+			return invalid("The taker cannot be the goalkeeper")
+		}
+		// the keeper played for the side facing the penalty in this game,
+		// after any transfer or as a guest
+		r, err := loadRosters(s.db, []uint{keeper.ID})
+		if err != nil {
+			return err
+		}
+		if r.teamAt(keeper.ID, game.ID) != opponentOf(&game, in.TeamID) {
+			return invalid("The goalkeeper must play for the other team")
+		}
+		stat.GoalkeeperID = &keeper.ID
+	}
+	if err := s.db.Create(&stat).Error; err != nil {
+		return err
+	}
+	s.cache.invalidate(game.EventID)
+	return nil
+}
+
+func (s *statService) CardRows(gameID uint) ([]CardRow, error) {
+	return cardRows(s.db, gameID)
+}
+
+var timelineTypes = []string{models.StatTypeGoal, models.StatTypePenalty, models.StatTypeOwnGoal,
+	models.StatTypePenaltyMissed, models.StatTypePenaltySaved, models.StatTypeSave}
+
+// opponentOf is the side the team faced in the game
+func opponentOf(game *models.Game, teamID uint) uint {
+	if teamID == game.HomeTeamID {
+		return game.AwayTeamID
+	}
+	return game.HomeTeamID
+}
+
+// scoreColumn is the score column of the credited team, or "" if it did not play
+func scoreColumn(game *models.Game, teamID uint) string {
+	switch teamID {
+	case game.HomeTeamID:
+		return "home_team_goals"
+	case game.AwayTeamID:
+		return "away_team_goals"
+	}
+	return ""
+}
+
+// goalRows loads the timeline in one query: each goal joined with its
+// scorer, credited team and (first) linked assist, plus the penalties that
+// did not go in
+func goalRows(db *gorm.DB, gameID uint) ([]GoalRow, error) {
+	rows := []GoalRow{}
+	err := db.Table("game_player_stats AS g").
+		Select(`g.id, g.minute, g.type AS goal_type,
+			COALESCE(sp.name, '') AS scorer, sp.number AS scorer_number, COALESCE(sp.photo_thumb, '') AS scorer_thumb,
+			COALESCE(st.name, '') AS scoring_team,
+			a.id AS assist_id, COALESCE(ap.name, '') AS assist_player, ap.number AS assist_number,
+			COALESCE(apt.name, '') AS assist_team,
+			COALESCE(gk.name, '') AS goalkeeper`).
+		Joins("LEFT JOIN players sp ON sp.id = g.player_id").
+		Joins("LEFT JOIN teams st ON st.id = g.team_id").
+		Joins(`LEFT JOIN game_player_stats a ON a.id = (
+			SELECT MIN(x.id) FROM game_player_stats x
+			WHERE x.goal_stat_id = g.id AND x.type = ? AND x.deleted_at IS NULL)`, models.StatTypeAssist).
+		Joins("LEFT JOIN players ap ON ap.id = a.player_id").
+		Joins("LEFT JOIN teams apt ON apt.id = a.team_id").
+		Joins("LEFT JOIN players gk ON gk.id = g.goalkeeper_id").
+		Where("g.game_id = ? AND g.type IN ? AND g.deleted_at IS NULL", gameID, timelineTypes).
+		Order("g.created_at ASC, g.id ASC").
+		Scan(&rows).Error
+	return rows, err
+}
+
+func cardRows(db *gorm.DB, gameID uint) ([]CardRow, error) {
+	rows := []CardRow{}
+	err := db.Table("game_player_stats AS c").
+		Select(`c.id, c.minute, c.type AS card_type,
+			COALESCE(p.name, '') AS player, COALESCE(t.name, '') AS team`).
+		Joins("LEFT JOIN players p ON p.id = c.player_id").
+		Joins("LEFT JOIN teams t ON t.id = c.team_id").
+		Where("c.game_id = ? AND c.type IN ? AND c.deleted_at IS NULL", gameID,
+			[]string{models.StatTypeYellowCard, models.StatTypeRedCard}).
+		Order("c.minute ASC, c.id ASC").
+		Scan(&rows).Error
+	return rows, err
+}
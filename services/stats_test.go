@@ -0,0 +1,83 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+func TestScoring(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		game := f.game(t)
+		f.goal(t, game.ID, f.homePlayers[0], &f.homePlayers[1])
+		f.goal(t, game.ID, f.awayPlayers[0], nil)
+		g := f.goal(t, game.ID, f.homePlayers[0], nil)
+		if g.HomeTeamGoals != 2 || g.AwayTeamGoals != 1 {
+			t.Fatalf("score %d:%d, want 2:1", g.HomeTeamGoals, g.AwayTeamGoals)
+		}
+
+		rows, err := svc.Stats.GoalRows(game.ID)
+		must(t, err)
+		if len(rows) != 3 || rows[0].Scorer != "Ann" || rows[0].AssistPlayer != "Bob" || rows[0].ScoringTeam != "Home" {
+			t.Fatalf("goal rows %+v", rows)
+		}
+
+		// a goal comes off the score with its assist
+		must(t, svc.Stats.Delete(rows[0].ID))
+		g, err = svc.Games.Get(game.ID)
+		must(t, err)
+		if g.HomeTeamGoals != 1 || g.AwayTeamGoals != 1 {
+			t.Fatalf("score %d:%d after delete, want 1:1", g.HomeTeamGoals, g.AwayTeamGoals)
+		}
+		assists, err := svc.Standings.TopAssists(f.event.ID, 10)
+		must(t, err)
+		if len(assists) != 0 {
+			t.Fatalf("assists %+v after their goal was deleted", assists)
+		}
+	})
+}
+
+func TestOwnGoal(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		game := f.game(t)
+		// Dan scores into his own net: the goal is Home's and gets no assist
+		g, err := svc.Stats.AddGoal(game.ID, GoalInput{
+			PlayerID: f.awayPlayers[0].ID, AssistPlayerID: f.awayPlayers[1].ID,
+			TeamID: f.home.ID, GoalType: models.StatTypeOwnGoal,
+		})
+		must(t, err)
+		if g.HomeTeamGoals != 1 || g.AwayTeamGoals != 0 {
+			t.Fatalf("score %d:%d, want 1:0", g.HomeTeamGoals, g.AwayTeamGoals)
+		}
+		scorers, err := svc.Standings.TopScorers(f.event.ID, 10)
+		must(t, err)
+		assists, err := svc.Standings.TopAssists(f.event.ID, 10)
+		must(t, err)
+		if len(scorers) != 0 || len(assists) != 0 {
+			t.Fatalf("own goal counted: scorers %+v, assists %+v", scorers, assists)
+		}
+	})
+}
+
+func TestAddGoalValidation(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		game := f.game(t)
+		_, err := svc.Stats.AddGoal(game.ID+100, GoalInput{PlayerID: f.homePlayers[0].ID})
+		wantKind(t, err, ErrNotFound)
+		_, err = svc.Stats.AddGoal(game.ID, GoalInput{})
+		wantKind(t, err, ErrValidation)
+		_, err = svc.Stats.AddGoal(game.ID, GoalInput{PlayerID: 9999})
+		wantKind(t, err, ErrValidation)
+
+		// an unknown team is credited to the home side
+		g, err := svc.Stats.AddGoal(game.ID, GoalInput{PlayerID: f.homePlayers[0].ID, TeamID: 9999})
+		must(t, err)
+		if g.HomeTeamGoals != 1 {
+			t.Fatalf("home goals %d, want 1", g.HomeTeamGoals)
+		}
+	})
+}
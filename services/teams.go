@@ -0,0 +1,386 @@
+package services
+
+import (
+	"strings"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+type TeamService interface {
+	List() ([]models.Team, error)
+	Get(id uint) (*models.Team, error)
+	// ListByEvent returns the event's teams sorted by name
+	ListByEvent(eventID uint) ([]models.Team, error)
+	Create(team *models.Team) error
+	Update(id uint, changes models.Team) (*models.Team, error)
+	// Delete refuses a team that still has games, players with stats in
+	// other teams' games or transfers, listing them; DeleteCascade removes
+	// them with the team
+	Delete(id uint, policy DeletePolicy) error
+	// Dashboard derives the team page from its games and goal stats
+	Dashboard(id uint) (*TeamDashboard, error)
+	// Roster returns the team with its players in roster order
+	Roster(id uint) (*models.Team, error)
+	// Arrange sets the team's roster order to playerIDs, moving in players
+	// listed from other teams of the event
+	Arrange(id uint, playerIDs []uint) (*models.Team, error)
+}
+
+// TeamResult is a game from the team's point of view
+type TeamResult struct {
+	GameID   uint
+	Opponent string
+	Home     bool
+	GF       int
+	GA       int
+	Outcome  string // "W", "D" or "L"
+}
+
+func (r TeamResult) Margin() int { return r.GF - r.GA }
+
+// PeriodRow counts goals scored and conceded in a window of the game
+type PeriodRow struct {
+	Label   string
+	For     int
+	Against int
+}
+
+type TeamDashboard struct {
+	Team        models.Team
+	Event       models.Event
+	Record      StandRow
+	Results     []TeamResult // in the order the games were created
+	Form        []TeamResult // the last five results, oldest first
+	Periods     []PeriodRow
+	TopScorers  []LeaderRow
+	BiggestWin  *TeamResult
+	BiggestLoss *TeamResult
+	CleanSheets int
+}
+
+// periods are the dashboard's goal windows; minute 0 means it was not recorded
+var periods = []struct {
+	label    string
+	from, to int
+}{
+	{"1–15'", 1, 15}, {"16–30'", 16, 30}, {"31–45'", 31, 45},
+	{"46–60'", 46, 60}, {"61–75'", 61, 75}, {"76–90'", 76, 90},
+	{"90+'", 91, 1 << 30}, {"No minute", 0, 0},
+}
+
+const formLength = 5
+
+type teamService struct {
+	db    *gorm.DB
+	cache *eventCache
+}
+
+func (s *teamService) List() ([]models.Team, error) {
+	var teams []models.Team
+	err := s.db.Find(&teams).Error
+	return teams, err
+}
+
+func (s *teamService) Get(id uint) (*models.Team, error) {
+	var team models.Team
+	if err := s.db.First(&team, id).Error; err != nil {
+		return nil, lookup(err, "Team")
+	}
+	return &team, nil
+}
+
+func (s *teamService) ListByEvent(eventID uint) ([]models.Team, error) {
+	var teams []models.Team
+	err := s.db.Where("event_id = ?", eventID).Order("name asc").Find(&teams).Error
+	return teams, err
+}
+
+func (s *teamService) Create(team *models.Team) error {
+	team.Name = strings.TrimSpace(team.Name)
+	if err := s.fromClub(team); err != nil {
+		return err
+	}
+	if team.Name == "" || team.EventID == 0 {
+		return invalid("Name and EventID required")
+	}
+	if err := s.db.First(&models.Event{}, team.EventID).Error; err != nil {
+		return lookup(err, "Event")
+	}
+	if err := s.checkName(team.EventID, team.Name, 0); err != nil {
+		return err
+	}
+	if err := s.db.Create(team).Error; err != nil {
+		return write(err, "Team")
+	}
+	s.cache.invalidate(team.EventID)
+	return nil
+}
+
+func (s *teamService) Update(id uint, changes models.Team) (*models.Team, error) {
+	existing, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	changes.Name = strings.TrimSpace(changes.Name)
+	if changes.Name != "" && changes.Name != existing.Name {
+		if err := s.checkName(existing.EventID, changes.Name, existing.ID); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.db.Model(existing).Updates(changes).Error; err != nil {
+		return nil, write(err, "Team")
+	}
+	s.cache.invalidate(existing.EventID)
+	return existing, nil
+}
+
+func (s *teamService) Delete(id uint, policy DeletePolicy) error {
+	team, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	if policy == DeleteAnonymize {
+		return invalid("Teams can't be anonymized")
+	}
+	blockers, err := teamBlockers(s.db, id)
+	if err != nil {
+		return err
+	}
+	if len(blockers) > 0 && policy == DeleteRestrict {
+		return blocked(blockers, "%s can't be deleted; delete its games and records too", team.Name)
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var gameIDs []uint
+		if err := tx.Model(&models.Game{}).Where("home_team_id = ? OR away_team_id = ?", id, id).
+			Pluck("id", &gameIDs).Error; err != nil {
+			return err
+		}
+		for _, gameID := range gameIDs {
+			if err := removeGame(tx, gameID); err != nil {
+				return err
+			}
+		}
+		// then its players with what they recorded elsewhere
+		var playerIDs []uint
+		if err := tx.Model(&models.Player{}).Where("team_id = ?", id).Pluck("id", &playerIDs).Error; err != nil {
+			return err
+		}
+		if err := removePlayers(tx, playerIDs); err != nil {
+			return err
+		}
+		if err := tx.Where("from_team_id = ? OR to_team_id = ?", id, id).Delete(&models.Transfer{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Team{}, id).Error
+	})
+	if err != nil {
+		return err
+	}
+	s.cache.invalidate(team.EventID)
+	return nil
+}
+
+func (s *teamService) Roster(id uint) (*models.Team, error) {
+	var team models.Team
+	if err := s.db.Preload("Players", rosterOrder).First(&team, id).Error; err != nil {
+		return nil, lookup(err, "Team")
+	}
+	return &team, nil
+}
+
+func (s *teamService) Arrange(id uint, playerIDs []uint) (*models.Team, error) {
+	team, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	var players []models.Player
+	if err := s.db.Where("id IN ?", playerIDs).Find(&players).Error; err != nil {
+		return nil, err
+	}
+	if len(players) != len(playerIDs) {
+		return nil, invalid("Unknown or repeated player in the roster")
+	}
+	byID := make(map[uint]*models.Player, len(players))
+	for i := range players {
+		byID[players[i].ID] = &players[i]
+	}
+	for _, p := range players {
+		if p.TeamID != team.ID {
+			if err := checkMove(s.db, &p, team.ID); err != nil {
+				return nil, err
+			}
+		}
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		for i, pid := range playerIDs {
+			changes := map[string]interface{}{"team_id": team.ID, "sort_order": i + 1}
+			if byID[pid].TeamID != team.ID {
+				changes["armband"] = ""
+			}
+			if err := tx.Model(byID[pid]).Updates(changes).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, write(err, "Player")
+	}
+	s.cache.invalidate(team.EventID)
+	return s.Roster(id)
+}
+
+// rosterOrder preloads players in the order of the team's roster
+func rosterOrder(db *gorm.DB) *gorm.DB {
+	return db.Order("sort_order ASC, id ASC")
+}
+
+// checkName rejects a team name already used in the event (except by team `self`)
+func (s *teamService) checkName(eventID uint, name string, self uint) error {
+	var existing models.Team
+	res := s.db.Where("event_id = ? AND name = ?", eventID, name).Limit(1).Find(&existing)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 && existing.ID != self {
+		return conflict("Team already exists")
+	}
+	return nil
+}
+
+func (s *teamService) Dashboard(id uint) (*TeamDashboard, error) {
+	team, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	d := &TeamDashboard{Team: *team, Record: StandRow{Team: *team}}
+	if err := s.db.First(&d.Event, team.EventID).Error; err != nil {
+		return nil, lookup(err, "Event")
+	}
+
+	var games []models.Game
+	if err := s.db.Where("event_id = ? AND (home_team_id = ? OR away_team_id = ?)", team.EventID, team.ID, team.ID).
+		Order("id ASC").Find(&games).Error; err != nil {
+		return nil, err
+	}
+	var teams []models.Team
+	if err := s.db.Unscoped().Where("event_id = ?", team.EventID).Find(&teams).Error; err != nil {
+		return nil, err
+	}
+	names := make(map[uint]string, len(teams))
+	for _, t := range teams {
+		names[t.ID] = t.Name
+	}
+
+	d.Results = make([]TeamResult, 0, len(games))
+	gameIDs := make([]uint, 0, len(games))
+	for _, g := range games {
+		r := TeamResult{GameID: g.ID, Home: g.HomeTeamID == team.ID}
+		if r.Home {
+			r.Opponent, r.GF, r.GA = names[g.AwayTeamID], g.HomeTeamGoals, g.AwayTeamGoals
+		} else {
+			r.Opponent, r.GF, r.GA = names[g.HomeTeamID], g.AwayTeamGoals, g.HomeTeamGoals
+		}
+		rec := &d.Record
+		rec.Played++
+		rec.GF += r.GF
+		rec.GA += r.GA
+		switch {
+		case r.GF > r.GA:
+			r.Outcome = "W"
+			rec.Wins++
+			rec.Points += 3
+		case r.GF < r.GA:
+			r.Outcome = "L"
+			rec.Losses++
+		default:
+			r.Outcome = "D"
+			rec.Draws++
+			rec.Points++
+		}
+		if r.GA == 0 {
+			d.CleanSheets++
+		}
+		d.Results = append(d.Results, r)
+		gameIDs = append(gameIDs, g.ID)
+	}
+	d.Record.GD = d.Record.GF - d.Record.GA
+	d.Form = d.Results[max(0, len(d.Results)-formLength):]
+
+	for i := range d.Results {
+		r := &d.Results[i]
+		if r.Outcome == "W" && (d.BiggestWin == nil || r.Margin() > d.BiggestWin.Margin() ||
+			r.Margin() == d.BiggestWin.Margin() && r.GF > d.BiggestWin.GF) {
+			d.BiggestWin = r
+		}
+		if r.Outcome == "L" && (d.BiggestLoss == nil || r.Margin() < d.BiggestLoss.Margin() ||
+			r.Margin() == d.BiggestLoss.Margin() && r.GA > d.BiggestLoss.GA) {
+			d.BiggestLoss = r
+		}
+	}
+
+	// Goals by period; the credited team decides for/against, so own goals count too
+	var goals []models.GamePlayerStat
+	if len(gameIDs) > 0 {
+		if err := s.db.Select("team_id", "minute").
+			Where("game_id IN ? AND type IN ?", gameIDs,
+				[]string{models.StatTypeGoal, models.StatTypePenalty, models.StatTypeOwnGoal}).
+			Find(&goals).Error; err != nil {
+			return nil, err
+		}
+	}
+	d.Periods = make([]PeriodRow, len(periods))
+	for i, p := range periods {
+		d.Periods[i].Label = p.label
+	}
+	for _, g := range goals {
+		for i, p := range periods {
+			if g.Minute < p.from || g.Minute > p.to {
+				continue
+			}
+			if g.TeamID == team.ID {
+				d.Periods[i].For++
+			} else {
+				d.Periods[i].Against++
+			}
+			break
+		}
+	}
+	if last := d.Periods[len(d.Periods)-1]; last.For == 0 && last.Against == 0 {
+		d.Periods = d.Periods[:len(d.Periods)-1]
+	}
+
+	if d.TopScorers, err = leaders(s.db, team.EventID, team.ID, scorerTypes, 0); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// fromClub fills a team created from a club: the club's name unless another
+// was typed, and a player per person of the club's default roster
+func (s *teamService) fromClub(team *models.Team) error {
+	if team.ClubID == nil || *team.ClubID == 0 {
+		team.ClubID = nil
+		return nil
+	}
+	var club models.Club
+	if err := s.db.Preload("Roster").First(&club, *team.ClubID).Error; err != nil {
+		return invalidLookup(err, "Club not found")
+	}
+	if team.Name == "" {
+		team.Name = club.Name
+	}
+	if len(team.Players) > 0 {
+		return nil
+	}
+	seen := make(map[string]bool, len(club.Roster))
+	for _, person := range club.Roster {
+		if seen[person.Name] {
+			continue
+		}
+		seen[person.Name] = true
+		team.Players = append(team.Players, models.Player{Name: person.Name, PersonID: &person.ID})
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+func TestUniqueNames(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		wantKind(t, svc.Teams.Create(&models.Team{Name: " Home ", EventID: f.event.ID}), ErrConflict)
+		wantKind(t, svc.Players.Create(&models.Player{Name: "Ann", TeamID: f.home.ID}), ErrConflict)
+		_, err := svc.Teams.Update(f.away.ID, models.Team{Name: "Home"})
+		wantKind(t, err, ErrConflict)
+
+		// the same name is fine in another team, and again once deleted
+		f.player(t, f.away.ID, "Ann")
+		team := f.team(t, "Spare")
+		must(t, svc.Teams.Delete(team.ID, DeleteRestrict))
+		f.team(t, "Spare")
+	})
+}
+
+func TestTeamDashboard(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		ann, bob, dan := f.homePlayers[0], f.homePlayers[1], f.awayPlayers[0]
+		goal := func(game models.Game, p models.Player, teamID uint, minute int, goalType string) {
+			_, err := svc.Stats.AddGoal(game.ID, GoalInput{PlayerID: p.ID, TeamID: teamID, Minute: minute, GoalType: goalType})
+			must(t, err)
+		}
+		// Home wins 3:0 (the last an own goal by Dan), loses 0:1, draws 1:1
+		win, loss, draw := f.game(t), f.game(t), f.game(t)
+		goal(win, ann, f.home.ID, 5, models.StatTypeGoal)
+		goal(win, ann, f.home.ID, 50, models.StatTypePenalty)
+		goal(win, dan, f.home.ID, 93, models.StatTypeOwnGoal)
+		goal(loss, dan, f.away.ID, 0, models.StatTypeGoal)
+		goal(draw, bob, f.home.ID, 20, models.StatTypeGoal)
+		goal(draw, dan, f.away.ID, 80, models.StatTypeGoal)
+
+		d, err := svc.Teams.Dashboard(f.home.ID)
+		must(t, err)
+		r := d.Record
+		if r.Played != 3 || r.Wins != 1 || r.Draws != 1 || r.Losses != 1 || r.Points != 4 || r.GF != 4 || r.GA != 2 {
+			t.Fatalf("record %+v", r)
+		}
+		if d.CleanSheets != 1 || d.BiggestWin.GameID != win.ID || d.BiggestLoss.GameID != loss.ID {
+			t.Fatalf("clean sheets %d, biggest win %+v, biggest loss %+v", d.CleanSheets, d.BiggestWin, d.BiggestLoss)
+		}
+		var form string
+		for _, res := range d.Form {
+			form += res.Outcome
+		}
+		if form != "WLD" {
+			t.Fatalf("form %q, want WLD", form)
+		}
+		periods := map[string][2]int{}
+		for _, p := range d.Periods {
+			periods[p.Label] = [2]int{p.For, p.Against}
+		}
+		want := map[string][2]int{"1–15'": {1, 0}, "16–30'": {1, 0}, "46–60'": {1, 0}, "76–90'": {0, 1}, "90+'": {1, 0}, "No minute": {0, 1}}
+		for label, n := range want {
+			if periods[label] != n {
+				t.Errorf("%s: for/against %v, want %v", label, periods[label], n)
+			}
+		}
+		if len(d.TopScorers) != 2 || d.TopScorers[0].Player != "Ann" || d.TopScorers[0].Count != 2 {
+			t.Fatalf("team scorers %+v", d.TopScorers)
+		}
+
+		// the event's leaderboards narrowed to the team
+		stats, err := svc.Standings.EventStats(f.event.ID, f.away.ID, 0)
+		must(t, err)
+		if len(stats.TopScorers) != 1 || stats.TopScorers[0].Player != "Dan" || stats.TopScorers[0].Count != 2 {
+			t.Fatalf("away scorers %+v", stats.TopScorers)
+		}
+	})
+}
+
+func TestRosterArrangement(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		ann, bob, cid := f.homePlayers[0], f.homePlayers[1], f.homePlayers[2]
+		dan := f.awayPlayers[0]
+
+		// a new captain takes the armband off the old one
+		_, err := svc.Players.SetArmband(ann.ID, ArmbandCaptain)
+		must(t, err)
+		_, err = svc.Players.SetArmband(bob.ID, ArmbandCaptain)
+		must(t, err)
+		_, err = svc.Players.SetArmband(cid.ID, "armband")
+		wantKind(t, err, ErrValidation)
+		roster, err := svc.Teams.Roster(f.home.ID)
+		must(t, err)
+		for _, p := range roster.Players {
+			if want := map[uint]string{bob.ID: ArmbandCaptain}[p.ID]; p.Armband != want {
+				t.Fatalf("%s wears %q, want %q", p.Name, p.Armband, want)
+			}
+		}
+
+		// the roster follows the given order and pulls Dan over from Away
+		_, err = svc.Players.SetArmband(dan.ID, ArmbandVice)
+		must(t, err)
+		team, err := svc.Teams.Arrange(f.home.ID, []uint{cid.ID, dan.ID, ann.ID, bob.ID})
+		must(t, err)
+		var names []string
+		for _, p := range team.Players {
+			names = append(names, p.Name)
+		}
+		if strings.Join(names, ",") != "Cid,Dan,Ann,Bob" {
+			t.Fatalf("roster %v", names)
+		}
+		if team.Players[1].Armband != "" || team.Players[3].Armband != ArmbandCaptain {
+			t.Fatalf("armbands after the move: %+v", team.Players)
+		}
+		_, err = svc.Teams.Arrange(f.home.ID, []uint{cid.ID, cid.ID})
+		wantKind(t, err, ErrValidation)
+
+		// players with transfers keep their history: no silent moves
+		g := f.game(t)
+		must(t, svc.Transfers.Create(&models.Transfer{PlayerID: f.awayPlayers[1].ID, ToTeamID: f.home.ID, GameID: g.ID}))
+		_, err = svc.Teams.Arrange(f.away.ID, []uint{f.awayPlayers[1].ID})
+		wantKind(t, err, ErrConflict)
+	})
+}
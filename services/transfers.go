@@ -0,0 +1,271 @@
+package services
+
+import (
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+type TransferService interface {
+	// List returns the event's transfers and guest appearances in game order
+	List(eventID uint) ([]TransferRow, error)
+	// Create moves the player to the new team from the game on, or for a
+	// guest appearance lends them to one of the game's teams
+	Create(t *models.Transfer) error
+	// Delete undoes a transfer or guest appearance; transfers are undone
+	// latest first
+	Delete(id uint) (*models.Transfer, error)
+}
+
+type TransferRow struct {
+	ID       uint
+	PlayerID uint
+	Player   string
+	FromTeam string
+	ToTeam   string
+	GameID   uint
+	Guest    bool
+}
+
+type transferService struct {
+	db    *gorm.DB
+	cache *eventCache
+}
+
+func (s *transferService) List(eventID uint) ([]TransferRow, error) {
+	out := []TransferRow{}
+	err := s.db.Table("transfers").
+		Select(`transfers.id, transfers.player_id, COALESCE(players.name, '') AS player,
+			COALESCE(ft.name, '') AS from_team, COALESCE(tt.name, '') AS to_team,
+			transfers.game_id, transfers.guest`).
+		Joins("JOIN teams tt ON tt.id = transfers.to_team_id").
+		Joins("LEFT JOIN teams ft ON ft.id = transfers.from_team_id").
+		Joins("LEFT JOIN players ON players.id = transfers.player_id").
+		Where("tt.event_id = ? AND transfers.deleted_at IS NULL", eventID).
+		Order("transfers.game_id ASC, transfers.id ASC").
+		Scan(&out).Error
+	return out, err
+}
+
+func (s *transferService) Create(t *models.Transfer) error {
+	if t.PlayerID == 0 || t.ToTeamID == 0 || t.GameID == 0 {
+		return invalid("PlayerID, ToTeamID and GameID required")
+	}
+	var player models.Player
+	if err := s.db.First(&player, t.PlayerID).Error; err != nil {
+		return invalidLookup(err, "Player not found")
+	}
+	var from models.Team
+	if err := s.db.First(&from, player.TeamID).Error; err != nil {
+		return lookup(err, "Team")
+	}
+	var game models.Game
+	if err := s.db.First(&game, t.GameID).Error; err != nil {
+		return invalidLookup(err, "Game not found")
+	}
+	var to models.Team
+	if err := s.db.First(&to, t.ToTeamID).Error; err != nil {
+		return invalidLookup(err, "Team not found")
+	}
+	if game.EventID != from.EventID || to.EventID != from.EventID {
+		return invalid("Player, team and game must be in the same event")
+	}
+	r, err := loadRosters(s.db, []uint{player.ID})
+	if err != nil {
+		return err
+	}
+	if r.teamAt(player.ID, game.ID) == to.ID {
+		return invalid("%s already plays for %s in game #%d", player.Name, to.Name, game.ID)
+	}
+
+	if t.Guest {
+		if to.ID != game.HomeTeamID && to.ID != game.AwayTeamID {
+			return invalid("%s did not play in game #%d", to.Name, game.ID)
+		}
+		if _, ok := r.guests[[2]uint{player.ID, game.ID}]; ok {
+			return conflict("%s is already a guest in game #%d", player.Name, game.ID)
+		}
+		t.FromTeamID = r.teamAt(player.ID, game.ID)
+		if err := s.db.Create(t).Error; err != nil {
+			return write(err, "Transfer")
+		}
+		s.cache.invalidate(game.EventID)
+		return nil
+	}
+
+	if moves := r.moves[player.ID]; len(moves) > 0 && moves[len(moves)-1].GameID >= game.ID {
+		return invalid("%s already moved in game #%d; transfers must come after it", player.Name, moves[len(moves)-1].GameID)
+	}
+	if err := checkRosterSpot(s.db, to.ID, player); err != nil {
+		return err
+	}
+	t.FromTeamID = player.TeamID
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(t).Error; err != nil {
+			return err
+		}
+		return tx.Model(&player).Update("team_id", to.ID).Error
+	})
+	if err != nil {
+		return write(err, "Transfer")
+	}
+	s.cache.invalidate(game.EventID)
+	return nil
+}
+
+func (s *transferService) Delete(id uint) (*models.Transfer, error) {
+	var t models.Transfer
+	if err := s.db.First(&t, id).Error; err != nil {
+		return nil, lookup(err, "Transfer")
+	}
+	if t.Guest {
+		if err := s.db.Delete(&t).Error; err != nil {
+			return nil, err
+		}
+		s.cache.invalidateGame(s.db, t.GameID)
+		return &t, nil
+	}
+
+	var player models.Player
+	if err := s.db.First(&player, t.PlayerID).Error; err != nil {
+		return nil, lookup(err, "Player")
+	}
+	r, err := loadRosters(s.db, []uint{player.ID})
+	if err != nil {
+		return nil, err
+	}
+	if moves := r.moves[player.ID]; len(moves) == 0 || moves[len(moves)-1].ID != t.ID {
+		return nil, conflict("Undo %s's later transfers first", player.Name)
+	}
+	if err := checkRosterSpot(s.db, t.FromTeamID, player); err != nil {
+		return nil, err
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&t).Error; err != nil {
+			return err
+		}
+		return tx.Model(&player).Update("team_id", t.FromTeamID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.cache.invalidateGame(s.db, t.GameID)
+	return &t, nil
+}
+
+// checkRosterSpot rejects moving the player into a team that already has
+// someone with the same name or shirt number
+func checkRosterSpot(db *gorm.DB, teamID uint, player models.Player) error {
+	var existing models.Player
+	q := db.Where("team_id = ? AND id <> ?", teamID, player.ID)
+	if player.Number != nil {
+		q = q.Where("name = ? OR number = ?", player.Name, *player.Number)
+	} else {
+		q = q.Where("name = ?", player.Name)
+	}
+	res := q.Limit(1).Find(&existing)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil
+	}
+	if existing.Name == player.Name {
+		return conflict("The team already has a player named %s", player.Name)
+	}
+	return conflict("#%d is already taken by %s", *player.Number, existing.Name)
+}
+
+// rosters tells which team a player represented in a game, following the
+// player's transfers and guest appearances
+type rosters struct {
+	current map[uint]uint              // player -> team now
+	moves   map[uint][]models.Transfer // player -> transfers in game order
+	guests  map[[2]uint]uint           // (player, game) -> guest team
+}
+
+func loadRosters(db *gorm.DB, playerIDs []uint) (*rosters, error) {
+	r := &rosters{current: map[uint]uint{}, moves: map[uint][]models.Transfer{}, guests: map[[2]uint]uint{}}
+	if len(playerIDs) == 0 {
+		return r, nil
+	}
+	var players []models.Player
+	if err := db.Unscoped().Select("id", "team_id").Where("id IN ?", playerIDs).Find(&players).Error; err != nil {
+		return nil, err
+	}
+	for _, p := range players {
+		r.current[p.ID] = p.TeamID
+	}
+	var transfers []models.Transfer
+	if err := db.Where("player_id IN ?", playerIDs).Order("game_id ASC, id ASC").Find(&transfers).Error; err != nil {
+		return nil, err
+	}
+	for _, t := range transfers {
+		if t.Guest {
+			r.guests[[2]uint{t.PlayerID, t.GameID}] = t.ToTeamID
+		} else {
+			r.moves[t.PlayerID] = append(r.moves[t.PlayerID], t)
+		}
+	}
+	return r, nil
+}
+
+// teamAt is the team the player represented in the game; games are ordered
+// by ID, so a transfer counts for its game and every later one
+func (r *rosters) teamAt(playerID, gameID uint) uint {
+	if team, ok := r.guests[[2]uint{playerID, gameID}]; ok {
+		return team
+	}
+	for _, m := range r.moves[playerID] {
+		if m.GameID > gameID {
+			return m.FromTeamID
+		}
+	}
+	return r.current[playerID]
+}
+
+// teams lists every team the players belonged to or guested for
+func (r *rosters) teams() []uint {
+	seen := make(map[uint]bool)
+	var out []uint
+	add := func(id uint) {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	for _, id := range r.current {
+		add(id)
+	}
+	for _, moves := range r.moves {
+		for _, m := range moves {
+			add(m.FromTeamID)
+		}
+	}
+	for _, id := range r.guests {
+		add(id)
+	}
+	return out
+}
+
+// playerGames counts the games each player appeared in: those of the team
+// they represented at the time
+func playerGames(db *gorm.DB, playerIDs []uint) (map[uint]int, error) {
+	out := make(map[uint]int, len(playerIDs))
+	r, err := loadRosters(db, playerIDs)
+	if err != nil || len(playerIDs) == 0 {
+		return out, err
+	}
+	teams := r.teams()
+	var games []models.Game
+	if err := db.Where("home_team_id IN ? OR away_team_id IN ?", teams, teams).Find(&games).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range playerIDs {
+		for _, g := range games {
+			if team := r.teamAt(id, g.ID); team == g.HomeTeamID || team == g.AwayTeamID {
+				out[id]++
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"gorm.io/gorm"
+)
+
+func TestTransfers(t *testing.T) {
+	eachBackend(t, func(t *testing.T, svc *Services, db *gorm.DB) {
+		f := newFixture(t, svc, db)
+		ann, bob, dan := f.homePlayers[0], f.homePlayers[1], f.awayPlayers[0]
+		third := f.team(t, "Third")
+		gil := f.player(t, third.ID, "Gil")
+		game := func(home, away uint) models.Game {
+			g := models.Game{EventID: f.event.ID, HomeTeamID: home, AwayTeamID: away}
+			must(t, svc.Games.Create(&g))
+			return g
+		}
+		g1, g2, g3 := game(f.home.ID, third.ID), game(f.away.ID, third.ID), game(f.home.ID, third.ID)
+
+		// Ann moves to Away from the second game; Bob guests for Third in it
+		move := models.Transfer{PlayerID: ann.ID, ToTeamID: f.away.ID, GameID: g2.ID}
+		must(t, svc.Transfers.Create(&move))
+		must(t, svc.Transfers.Create(&models.Transfer{PlayerID: bob.ID, ToTeamID: third.ID, GameID: g2.ID, Guest: true}))
+		f.goal(t, g1.ID, ann, nil)
+		_, err := svc.Stats.AddGoal(g2.ID, GoalInput{PlayerID: ann.ID, TeamID: f.away.ID, GoalType: models.StatTypeGoal})
+		must(t, err)
+
+		wantKind(t, svc.Transfers.Create(&models.Transfer{PlayerID: ann.ID, ToTeamID: f.home.ID, GameID: g1.ID}), ErrValidation)
+		wantKind(t, svc.Transfers.Create(&models.Transfer{PlayerID: ann.ID, ToTeamID: f.away.ID, GameID: g3.ID}), ErrValidation)
+		wantKind(t, svc.Transfers.Create(&models.Transfer{PlayerID: dan.ID, ToTeamID: f.home.ID, GameID: g2.ID, Guest: true}), ErrValidation)
+		wantKind(t, svc.Transfers.Create(&models.Transfer{PlayerID: bob.ID, ToTeamID: third.ID, GameID: g2.ID, Guest: true}), ErrValidation)
+
+		// appearances follow the team at the time: Ann misses the third
+		// game, Bob plays all three
+		for p, want := range map[models.Player]int{ann: 2, bob: 3} {
+			r, err := svc.Players.Report(f.event.ID, p.ID)
+			must(t, err)
+			if r.Tally.Appearances != want {
+				t.Errorf("%s: %d appearances, want %d", p.Name, r.Tally.Appearances, want)
+			}
+		}
+		scorers, err := svc.Standings.TopScorers(f.event.ID, 0)
+		must(t, err)
+		if len(scorers) != 1 || scorers[0].Team != "Home / Away" || scorers[0].Count != 2 {
+			t.Fatalf("top scorers %+v", scorers)
+		}
+		home, err := svc.Standings.EventStats(f.event.ID, f.home.ID, 0)
+		must(t, err)
+		if len(home.TopScorers) != 1 || home.TopScorers[0].Count != 1 {
+			t.Fatalf("Home's scorers %+v", home.TopScorers)
+		}
+
+		// the goalkeeper is checked against the team at the time: Ann kept
+		// for Home in the first game although she plays for Away now
+		penalty := PenaltyInput{PlayerID: gil.ID, TeamID: third.ID, GoalkeeperID: ann.ID, Outcome: models.StatTypePenaltySaved}
+		must(t, svc.Stats.AddMissedPenalty(g1.ID, penalty))
+		penalty.GoalkeeperID = dan.ID
+		wantKind(t, svc.Stats.AddMissedPenalty(g1.ID, penalty), ErrValidation)
+		// and a guest keeps goal for the team they guested for
+		must(t, svc.Stats.AddMissedPenalty(g2.ID, PenaltyInput{PlayerID: dan.ID, TeamID: f.away.ID, GoalkeeperID: bob.ID, Outcome: models.StatTypePenaltySaved}))
+
+		// transfers are undone latest first, and the first undo puts Ann
+		// back in Home
+		later := models.Transfer{PlayerID: ann.ID, ToTeamID: third.ID, GameID: g3.ID}
+		must(t, svc.Transfers.Create(&later))
+		_, err = svc.Transfers.Delete(move.ID)
+		wantKind(t, err, ErrConflict)
+		for _, id := range []uint{later.ID, move.ID} {
+			_, err = svc.Transfers.Delete(id)
+			must(t, err)
+		}
+		p, err := svc.Players.Get(ann.ID)
+		must(t, err)
+		if p.TeamID != f.home.ID {
+			t.Fatalf("Ann in team %d after the undo, want %d", p.TeamID, f.home.ID)
+		}
+	})
+}
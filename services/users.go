@@ -0,0 +1,128 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/yesakov/lukyasha-tracker/models"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+type UserService interface {
+	// Register creates an account and signs it in
+	Register(name, password string) (*models.User, string, error)
+	// Login checks the password and returns a new session token
+	Login(name, password string) (*models.User, string, error)
+	// Logout ends the token's session
+	Logout(token string) error
+	// ByToken returns the user signed in with a live session token
+	ByToken(token string) (*models.User, error)
+}
+
+// SessionTTL is how long a sign-in lasts
+const SessionTTL = 30 * 24 * time.Hour
+
+// Account limits; bcrypt ignores anything past 72 bytes
+const (
+	minNameLen     = 3
+	maxNameLen     = 32
+	minPasswordLen = 8
+	maxPasswordLen = 72
+)
+
+type userService struct {
+	db *gorm.DB
+}
+
+func (s *userService) Register(name, password string) (*models.User, string, error) {
+	name = strings.TrimSpace(name)
+	if n := utf8.RuneCountInString(name); n < minNameLen || n > maxNameLen {
+		return nil, "", invalid("Name must be %d to %d characters", minNameLen, maxNameLen)
+	}
+	if len(password) < minPasswordLen || len(password) > maxPasswordLen {
+		return nil, "", invalid("Password must be %d to %d characters", minPasswordLen, maxPasswordLen)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, "", err
+	}
+	user := &models.User{Name: name, PasswordHash: string(hash)}
+	if err := s.db.Create(user).Error; err != nil {
+		return nil, "", write(err, "User")
+	}
+	token, err := s.startSession(user.ID)
+	if err != nil {
+		return nil, "", err
+	}
+	return user, token, nil
+}
+
+func (s *userService) Login(name, password string) (*models.User, string, error) {
+	var user models.User
+	err := s.db.Where("name = ?", strings.TrimSpace(name)).First(&user).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, "", err
+	}
+	// the same answer for unknown names and wrong passwords
+	if err != nil || bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return nil, "", unauthorized("Wrong name or password")
+	}
+	token, err := s.startSession(user.ID)
+	if err != nil {
+		return nil, "", err
+	}
+	return &user, token, nil
+}
+
+func (s *userService) Logout(token string) error {
+	return s.db.Where("token_hash = ?", hashToken(token)).Delete(&models.Session{}).Error
+}
+
+func (s *userService) ByToken(token string) (*models.User, error) {
+	if token == "" {
+		return nil, unauthorized("Log in first")
+	}
+	var session models.Session
+	err := s.db.Where("token_hash = ? AND expires_at > ?", hashToken(token), time.Now()).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, unauthorized("Your session has expired, log in again")
+	}
+	if err != nil {
+		return nil, err
+	}
+	var user models.User
+	if err := s.db.First(&user, session.UserID).Error; err != nil {
+		return nil, unauthorized("Log in first")
+	}
+	return &user, nil
+}
+
+// startSession stores a new session and returns its token. Expired sessions
+// of the user are cleared on the way.
+func (s *userService) startSession(userID uint) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	now := time.Now()
+	if err := s.db.Where("user_id = ? AND expires_at <= ?", userID, now).Delete(&models.Session{}).Error; err != nil {
+		return "", err
+	}
+	session := models.Session{UserID: userID, TokenHash: hashToken(token), ExpiresAt: now.Add(SessionTTL)}
+	if err := s.db.Create(&session).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -58,8 +58,81 @@
     // htmx custom events
     document.body.addEventListener('game-removed', () => showToast('Game deleted'));
     document.body.addEventListener('toast', (e) => {
-      const msg = (e && e.detail) ? e.detail : 'Done';
+      // htmx wraps string HX-Trigger values as { value: "..." }
+      const d = e && e.detail;
+      const msg = d ? (typeof d === 'string' ? d : d.value || 'Done') : 'Done';
       showToast(msg);
     });
+
+    // A delete the server refused until confirmed (a player with stats):
+    // ask, then retry it with the cascade policy and the original target
+    document.body.addEventListener('confirm-delete', (e) => {
+      const d = (e && e.detail) || {};
+      const src = e.target;
+      if (!d.retry || !window.confirm(`${d.message}\n\nDelete anyway?`)) return;
+      htmx.ajax('DELETE', d.retry, { source: src, target: src.getAttribute('hx-target') || src, swap: 'delete' });
+    });
+
+    // Inline edit: the pencil swaps its [data-editable] between view and form
+    document.body.addEventListener('click', (e) => {
+      const btn = e.target.closest('[data-edit-toggle]');
+      if (!btn) return;
+      const box = btn.closest('[data-editable]');
+      box.querySelectorAll('.inline-view, .inline-edit').forEach((el) => el.classList.toggle('d-none'));
+      const input = box.querySelector('.inline-edit:not(.d-none) input');
+      if (input) input.focus();
+    });
+
+    // Certificates print from their own page
+    document.body.addEventListener('click', (e) => {
+      if (e.target.closest('[data-print]')) window.print();
+    });
+
+    // Roster drag and drop: a player row dropped into a team's list saves that
+    // team's order (moving the player in) and re-renders its card
+    let dragged = null;
+    document.body.addEventListener('dragstart', (e) => {
+      const li = e.target.closest && e.target.closest('li[data-player-id]');
+      if (!li) return;
+      dragged = li;
+      li.classList.add('dragging');
+      e.dataTransfer.effectAllowed = 'move';
+    });
+    document.body.addEventListener('dragend', () => {
+      if (dragged) dragged.classList.remove('dragging');
+      dragged = null;
+    });
+    document.body.addEventListener('dragover', (e) => {
+      const list = e.target.closest && e.target.closest('ul[data-team-id]');
+      if (!dragged || !list) return;
+      e.preventDefault();
+      const next = [...list.querySelectorAll('li[data-player-id]:not(.dragging)')]
+        .find((li) => e.clientY < li.getBoundingClientRect().top + li.offsetHeight / 2);
+      list.insertBefore(dragged, next || null);
+    });
+    document.body.addEventListener('drop', (e) => {
+      const list = e.target.closest && e.target.closest('ul[data-team-id]');
+      if (!dragged || !list) return;
+      e.preventDefault();
+      const teamId = list.dataset.teamId;
+      const body = new URLSearchParams();
+      list.querySelectorAll('li[data-player-id]').forEach((li) => body.append('player_id', li.dataset.playerId));
+      fetch(`/teams/${teamId}/roster`, { method: 'POST', headers: { 'HX-Request': 'true' }, body })
+        .then((res) => res.text().then((text) => {
+          if (!res.ok) {
+            // put everything back the way the server has it
+            showToast(text);
+            setTimeout(() => window.location.reload(), 1500);
+            return;
+          }
+          const card = document.getElementById(`team-card-${teamId}`);
+          if (card) {
+            card.outerHTML = text;
+            htmx.process(document.getElementById(`team-card-${teamId}`));
+          }
+          showToast('Roster saved');
+        }))
+        .catch(() => window.location.reload());
+    });
   });
 })();
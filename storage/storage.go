@@ -0,0 +1,205 @@
+// Package storage keeps user-supplied images (club crests, player photos)
+// on disk under one directory that the web server exposes at URLPrefix.
+// The directory is data, not source: keep it out of the repository.
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// URLPrefix is where the upload directory is served
+const URLPrefix = "/uploads"
+
+// MaxSize caps a single image
+const MaxSize = 2 << 20
+
+var (
+	ErrTooLarge = fmt.Errorf("image is larger than %d MB", MaxSize>>20)
+	ErrNotImage = errors.New("only PNG, JPEG, GIF and WebP images are accepted")
+)
+
+// extensions maps the sniffed content type to the stored file extension;
+// SVG is left out on purpose since it can carry scripts
+var extensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+type Store struct {
+	Dir string
+}
+
+func New(dir string) *Store {
+	return &Store{Dir: dir}
+}
+
+// DefaultDir is where uploads go without UPLOAD_DIR
+const DefaultDir = "data/uploads"
+
+// DirFromEnv reads UPLOAD_DIR (default DefaultDir)
+func DirFromEnv() string {
+	if v := os.Getenv("UPLOAD_DIR"); v != "" {
+		return v
+	}
+	return DefaultDir
+}
+
+// SaveImage validates an uploaded image by its content, stores it under
+// kind/ with a random name and returns its public path
+func (s *Store) SaveImage(fh *multipart.FileHeader, kind string) (string, error) {
+	data, ext, err := readImage(fh)
+	if err != nil {
+		return "", err
+	}
+	name, err := randomName()
+	if err != nil {
+		return "", err
+	}
+	return s.write(kind, name+ext, data)
+}
+
+// SaveImageWithThumb stores an image like SaveImage plus a PNG thumbnail
+// that fits in size×size. Formats the standard library cannot decode (WebP)
+// get the original as their thumbnail.
+func (s *Store) SaveImageWithThumb(fh *multipart.FileHeader, kind string, size int) (path, thumb string, err error) {
+	data, ext, err := readImage(fh)
+	if err != nil {
+		return "", "", err
+	}
+	name, err := randomName()
+	if err != nil {
+		return "", "", err
+	}
+	if path, err = s.write(kind, name+ext, data); err != nil {
+		return "", "", err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return path, path, nil
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, shrink(img, size)); err != nil {
+		s.Remove(path)
+		return "", "", err
+	}
+	if thumb, err = s.write(kind, name+"_thumb.png", buf.Bytes()); err != nil {
+		s.Remove(path)
+		return "", "", err
+	}
+	return path, thumb, nil
+}
+
+// readImage loads an upload and sniffs its type, rejecting anything that is
+// too large or not an accepted image
+func readImage(fh *multipart.FileHeader) ([]byte, string, error) {
+	if fh.Size > MaxSize {
+		return nil, "", ErrTooLarge
+	}
+	src, err := fh.Open()
+	if err != nil {
+		return nil, "", err
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(io.LimitReader(src, MaxSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > MaxSize {
+		return nil, "", ErrTooLarge
+	}
+	ext, ok := extensions[http.DetectContentType(data)]
+	if !ok {
+		return nil, "", ErrNotImage
+	}
+	return data, ext, nil
+}
+
+func (s *Store) write(kind, file string, data []byte) (string, error) {
+	dir := filepath.Join(s.Dir, kind)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, file), data, 0o644); err != nil {
+		return "", err
+	}
+	return URLPrefix + "/" + kind + "/" + file, nil
+}
+
+// shrink scales img down to fit in size×size by averaging the source pixels
+// behind each target pixel; smaller images are kept as they are
+func shrink(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size && h <= size {
+		return img
+	}
+	tw, th := size, size
+	if w > h {
+		th = max(1, h*size/w)
+	} else {
+		tw = max(1, w*size/h)
+	}
+	out := image.NewNRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := b.Min.Y+y*h/th, b.Min.Y+max((y+1)*h/th, y*h/th+1)
+		for x := 0; x < tw; x++ {
+			x0, x1 := b.Min.X+x*w/tw, b.Min.X+max((x+1)*w/tw, x*w/tw+1)
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, bl, a, n = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			i := out.PixOffset(x, y)
+			if a == 0 {
+				continue
+			}
+			// RGBA() is alpha-premultiplied; NRGBA wants it undone
+			out.Pix[i+0] = uint8(r * 0xff / a)
+			out.Pix[i+1] = uint8(g * 0xff / a)
+			out.Pix[i+2] = uint8(bl * 0xff / a)
+			out.Pix[i+3] = uint8(a / n >> 8)
+		}
+	}
+	return out
+}
+
+// Remove deletes a file previously returned by SaveImage or
+// SaveImageWithThumb; other paths are ignored
+func (s *Store) Remove(publicPath string) error {
+	rel, ok := strings.CutPrefix(publicPath, URLPrefix+"/")
+	if !ok || rel == "" || strings.Contains(rel, "..") {
+		return nil
+	}
+	err := os.Remove(filepath.Join(s.Dir, filepath.FromSlash(rel)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func randomName() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}